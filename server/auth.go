@@ -13,7 +13,7 @@ import (
 	"github.com/pocketbase/pocketbase/tools/types"
 )
 
-func registerAuthRoutes(router *router.Router[*core.RequestEvent], app *pocketbase.PocketBase) {
+func registerAuthRoutes(router *router.Router[*core.RequestEvent], app *pocketbase.PocketBase, podman *podmanService) {
 	router.GET("/auth/signup-config", func(re *core.RequestEvent) error {
 		total, err := app.CountRecords(CollectionUsers)
 		if err != nil {
@@ -211,7 +211,12 @@ func registerAuthRoutes(router *router.Router[*core.RequestEvent], app *pocketba
 			})
 		}
 
-		return re.JSON(http.StatusOK, publicUser(re.Auth))
+		user := publicUser(re.Auth)
+		if quota, err := podman.workspaceQuotaStatus(re.Auth.Id); err == nil {
+			user["workspaces"] = quota
+		}
+
+		return re.JSON(http.StatusOK, user)
 	})
 }
 
@@ -24,9 +24,9 @@ func main() {
 			return err
 		}
 
-		registerAuthRoutes(e.Router, app)
 		podman := newPodmanService()
 		podman.start(app)
+		registerAuthRoutes(e.Router, app, podman)
 		registerPodmanRoutes(e.Router, podman)
 		if assets != nil {
 			registerStaticRoutes(e.Router, assets)
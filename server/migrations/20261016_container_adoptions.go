@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		adoptions, err := app.FindCollectionByNameOrId("container_adoptions")
+		if err != nil {
+			adoptions = core.NewBaseCollection("container_adoptions")
+		}
+		adminRule := `@request.auth.role = "admin"`
+		adoptions.ListRule = types.Pointer(adminRule)
+		adoptions.ViewRule = types.Pointer(adminRule)
+		adoptions.CreateRule = types.Pointer(adminRule)
+		adoptions.UpdateRule = types.Pointer(adminRule)
+		adoptions.DeleteRule = types.Pointer(adminRule)
+
+		if adoptions.Fields.GetByName("container_id") == nil {
+			adoptions.Fields.Add(&core.TextField{
+				Name:     "container_id",
+				Required: true,
+			})
+		}
+		if adoptions.Fields.GetByName("owner") == nil {
+			adoptions.Fields.Add(&core.RelationField{
+				Name:          "owner",
+				CollectionId:  users.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			})
+		}
+		if adoptions.Fields.GetByName("adopted_by") == nil {
+			adoptions.Fields.Add(&core.RelationField{
+				Name:         "adopted_by",
+				CollectionId: users.Id,
+				MaxSelect:    1,
+			})
+		}
+		adoptions.AddIndex("idx_container_adoptions_container_id", true, "container_id", "")
+
+		return app.Save(adoptions)
+	}, func(app core.App) error {
+		if adoptions, err := app.FindCollectionByNameOrId("container_adoptions"); err == nil {
+			return app.Delete(adoptions)
+		}
+
+		return nil
+	})
+}
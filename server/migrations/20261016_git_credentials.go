@@ -0,0 +1,87 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		credentials, err := app.FindCollectionByNameOrId("git_credentials")
+		if err != nil {
+			credentials = core.NewBaseCollection("git_credentials")
+		}
+		// Secrets are only read by the server; the API goes through the
+		// /podman/workspaces/credentials routes.
+		credentials.ListRule = nil
+		credentials.ViewRule = nil
+		credentials.CreateRule = nil
+		credentials.UpdateRule = nil
+		credentials.DeleteRule = nil
+
+		if credentials.Fields.GetByName("owner") == nil {
+			credentials.Fields.Add(&core.RelationField{
+				Name:          "owner",
+				CollectionId:  users.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			})
+		}
+		if credentials.Fields.GetByName("host") == nil {
+			credentials.Fields.Add(&core.TextField{
+				Name:     "host",
+				Required: true,
+				Max:      255,
+			})
+		}
+		if credentials.Fields.GetByName("kind") == nil {
+			credentials.Fields.Add(&core.SelectField{
+				Name:      "kind",
+				Values:    []string{"token", "ssh_key"},
+				MaxSelect: 1,
+				Required:  true,
+			})
+		}
+		if credentials.Fields.GetByName("username") == nil {
+			credentials.Fields.Add(&core.TextField{
+				Name: "username",
+				Max:  128,
+			})
+		}
+		// secret holds the token or private key, encrypted with
+		// GIT_CREDENTIALS_KEY.
+		if credentials.Fields.GetByName("secret") == nil {
+			credentials.Fields.Add(&core.TextField{
+				Name:     "secret",
+				Required: true,
+				Hidden:   true,
+			})
+		}
+		if credentials.Fields.GetByName("public_key") == nil {
+			credentials.Fields.Add(&core.TextField{
+				Name: "public_key",
+			})
+		}
+		if credentials.Fields.GetByName("created") == nil {
+			credentials.Fields.Add(&core.AutodateField{
+				Name:     "created",
+				OnCreate: true,
+			})
+		}
+		credentials.AddIndex("idx_git_credentials_owner_host_kind", true, "owner, host, kind", "")
+
+		return app.Save(credentials)
+	}, func(app core.App) error {
+		if credentials, err := app.FindCollectionByNameOrId("git_credentials"); err == nil {
+			return app.Delete(credentials)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		// git_name and git_email override display_name and the account email
+		// as the identity workspaces commit with.
+		if users.Fields.GetByName("git_name") == nil {
+			users.Fields.Add(&core.TextField{
+				Name: "git_name",
+				Max:  200,
+			})
+		}
+		if users.Fields.GetByName("git_email") == nil {
+			users.Fields.Add(&core.EmailField{
+				Name: "git_email",
+			})
+		}
+		if users.Fields.GetByName("ssh_public_key") == nil {
+			users.Fields.Add(&core.TextField{
+				Name: "ssh_public_key",
+			})
+		}
+		// ssh_private_key is encrypted with GIT_CREDENTIALS_KEY.
+		if users.Fields.GetByName("ssh_private_key") == nil {
+			users.Fields.Add(&core.TextField{
+				Name:   "ssh_private_key",
+				Hidden: true,
+			})
+		}
+
+		return app.Save(users)
+	}, func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return nil
+		}
+		for _, name := range []string{"git_name", "git_email", "ssh_public_key", "ssh_private_key"} {
+			users.Fields.RemoveByName(name)
+		}
+
+		return app.Save(users)
+	})
+}
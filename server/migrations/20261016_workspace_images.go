@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		images, err := app.FindCollectionByNameOrId("workspace_images")
+		if err != nil {
+			images = core.NewBaseCollection("workspace_images")
+		}
+		authRule := `@request.auth.id != ""`
+		adminRule := `@request.auth.role = "admin"`
+		images.ListRule = types.Pointer(authRule)
+		images.ViewRule = types.Pointer(authRule)
+		images.CreateRule = types.Pointer(adminRule)
+		images.UpdateRule = types.Pointer(adminRule)
+		images.DeleteRule = types.Pointer(adminRule)
+
+		if images.Fields.GetByName("image") == nil {
+			images.Fields.Add(&core.TextField{
+				Name:     "image",
+				Required: true,
+				Max:      512,
+			})
+		}
+		if images.Fields.GetByName("display_name") == nil {
+			images.Fields.Add(&core.TextField{
+				Name: "display_name",
+				Max:  200,
+			})
+		}
+		if images.Fields.GetByName("description") == nil {
+			images.Fields.Add(&core.TextField{
+				Name: "description",
+				Max:  1000,
+			})
+		}
+		if images.Fields.GetByName("default_home") == nil {
+			images.Fields.Add(&core.TextField{
+				Name: "default_home",
+				Max:  512,
+			})
+		}
+		if images.Fields.GetByName("is_default") == nil {
+			images.Fields.Add(&core.BoolField{
+				Name: "is_default",
+			})
+		}
+		images.AddIndex("idx_workspace_images_image", true, "image", "")
+
+		if err := app.Save(images); err != nil {
+			return err
+		}
+
+		// Seed the image workspaces used before the allowlist existed.
+		total, err := app.CountRecords(images)
+		if err != nil || total > 0 {
+			return err
+		}
+		record := core.NewRecord(images)
+		record.Set("image", "mcr.microsoft.com/devcontainers/universal")
+		record.Set("display_name", "Dev Containers Universal")
+		record.Set("is_default", true)
+		return app.Save(record)
+	}, func(app core.App) error {
+		if images, err := app.FindCollectionByNameOrId("workspace_images"); err == nil {
+			return app.Delete(images)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		quotas, err := app.FindCollectionByNameOrId("workspace_quotas")
+		if err != nil {
+			quotas = core.NewBaseCollection("workspace_quotas")
+		}
+		adminRule := `@request.auth.role = "admin"`
+		quotas.ListRule = types.Pointer(adminRule)
+		quotas.ViewRule = types.Pointer(adminRule)
+		quotas.CreateRule = types.Pointer(adminRule)
+		quotas.UpdateRule = types.Pointer(adminRule)
+		quotas.DeleteRule = types.Pointer(adminRule)
+
+		// A record with a user is an override for that user; otherwise it is
+		// the default for its role.
+		if quotas.Fields.GetByName("role") == nil {
+			quotas.Fields.Add(&core.SelectField{
+				Name:      "role",
+				Values:    []string{"admin", "user"},
+				MaxSelect: 1,
+			})
+		}
+		if quotas.Fields.GetByName("user") == nil {
+			quotas.Fields.Add(&core.RelationField{
+				Name:          "user",
+				CollectionId:  users.Id,
+				MaxSelect:     1,
+				CascadeDelete: true,
+			})
+		}
+		if quotas.Fields.GetByName("max_workspaces") == nil {
+			quotas.Fields.Add(&core.NumberField{
+				Name:    "max_workspaces",
+				Min:     types.Pointer(0.0),
+				OnlyInt: true,
+			})
+		}
+		if quotas.Fields.GetByName("max_running") == nil {
+			quotas.Fields.Add(&core.NumberField{
+				Name:    "max_running",
+				Min:     types.Pointer(0.0),
+				OnlyInt: true,
+			})
+		}
+		if quotas.Fields.GetByName("max_cpus") == nil {
+			quotas.Fields.Add(&core.NumberField{
+				Name: "max_cpus",
+				Min:  types.Pointer(0.0),
+			})
+		}
+		if quotas.Fields.GetByName("max_memory_mb") == nil {
+			quotas.Fields.Add(&core.NumberField{
+				Name:    "max_memory_mb",
+				Min:     types.Pointer(0.0),
+				OnlyInt: true,
+			})
+		}
+		quotas.AddIndex("idx_workspace_quotas_user", true, "user", "user != ''")
+		quotas.AddIndex("idx_workspace_quotas_role", true, "role", "user = '' AND role != ''")
+
+		return app.Save(quotas)
+	}, func(app core.App) error {
+		if quotas, err := app.FindCollectionByNameOrId("workspace_quotas"); err == nil {
+			return app.Delete(quotas)
+		}
+
+		return nil
+	})
+}
@@ -18,12 +18,17 @@ import (
 var errPodmanUnavailable = errors.New("podman not available")
 
 const (
-	podmanUnavailableMessage       = "Podman is not available on the server."
-	podmanLoadFailedMessage        = "Failed to load Podman containers."
-	podmanRunFailedMessage         = "Failed to run container."
-	podmanStopFailedMessage        = "Failed to stop container."
-	podmanDeleteFailedMessage      = "Failed to delete container."
-	podmanContainerNotFoundMessage = "Container not found."
+	podmanUnavailableMessage         = "Podman is not available on the server."
+	podmanLoadFailedMessage          = "Failed to load Podman containers."
+	podmanRunFailedMessage           = "Failed to run container."
+	podmanStopFailedMessage          = "Failed to stop container."
+	podmanDeleteFailedMessage        = "Failed to delete container."
+	podmanInspectFailedMessage       = "Failed to inspect container."
+	podmanRestartFailedMessage       = "Failed to restart container."
+	podmanPauseFailedMessage         = "Failed to pause container."
+	podmanUnpauseFailedMessage       = "Failed to unpause container."
+	podmanContainerNotRunningMessage = "Container is not running."
+	podmanContainerNotFoundMessage   = "Container not found."
 )
 
 const (
@@ -65,9 +70,12 @@ type podmanContainer struct {
 }
 
 type podmanStreamMessage struct {
-	Type    string            `json:"type"`
-	Data    []podmanContainer `json:"data"`
-	Message string            `json:"message,omitempty"`
+	Type    string               `json:"type"`
+	Data    []podmanContainer    `json:"data"`
+	Stats   []containerStats     `json:"stats,omitempty"`
+	Build   *workspaceBuildEvent `json:"build,omitempty"`
+	Job     *workspaceJob        `json:"job,omitempty"`
+	Message string               `json:"message,omitempty"`
 }
 
 type podmanEvent struct {
@@ -79,10 +87,15 @@ type podmanEvent struct {
 }
 
 type podmanService struct {
+	runtime ContainerRuntime
+	app     core.App
+
 	mu                       sync.RWMutex
 	containers               []podmanContainer
 	tunnelStateByContainerID map[string]podmanTunnelState
 	monitors                 map[string]*tunnelMonitor
+	adoptions                map[string]string
+	stats                    []containerStats
 	hash                     uint64
 	errMessage               string
 	initialized              bool
@@ -90,11 +103,18 @@ type podmanService struct {
 	hubMu   sync.Mutex
 	clients map[*podmanClient]struct{}
 
+	// jobAdmitMu serializes workspace admission so concurrent creates see
+	// each other's pending jobs in the quota.
+	jobAdmitMu sync.Mutex
+	jobsMu     sync.Mutex
+	jobs       map[string]*workspaceJob
+
 	pollCh chan time.Duration
 	once   sync.Once
 }
 
 type podmanClient struct {
+	access    containerAccess
 	conn      *websocket.Conn
 	sendCh    chan podmanStreamMessage
 	closeCh   chan struct{}
@@ -103,10 +123,13 @@ type podmanClient struct {
 
 func newPodmanService() *podmanService {
 	return &podmanService{
+		runtime:                  newContainerRuntime(),
 		containers:               []podmanContainer{},
 		tunnelStateByContainerID: make(map[string]podmanTunnelState),
 		monitors:                 make(map[string]*tunnelMonitor),
+		adoptions:                make(map[string]string),
 		clients:                  make(map[*podmanClient]struct{}),
+		jobs:                     make(map[string]*workspaceJob),
 		pollCh:                   make(chan time.Duration, 1),
 	}
 }
@@ -119,10 +142,17 @@ func (s *podmanService) start(app core.App) {
 			return e.Next()
 		})
 
+		app.Logger().Info("Container runtime selected", "runtime", s.runtime.Name())
+		s.app = app
+		if err := s.loadAdoptions(app); err != nil {
+			app.Logger().Warn("Failed to load container adoptions", "error", err)
+		}
 		s.reconcileTunnelSessions()
 
 		go s.runPoller(ctx)
 		go s.runEventListener(ctx)
+		go s.runStatsSampler(ctx)
+		go s.runMirrorRefresher(ctx)
 	})
 }
 
@@ -146,7 +176,7 @@ func (s *podmanService) getCachedContainers() ([]podmanContainer, string) {
 		return containers, s.errMessage
 	}
 
-	containers, err := listPodmanContainers()
+	containers, err := s.runtime.List(context.Background())
 	if err != nil {
 		message := podmanLoadFailedMessage
 		if errors.Is(err, errPodmanUnavailable) {
@@ -158,7 +188,8 @@ func (s *podmanService) getCachedContainers() ([]podmanContainer, string) {
 	}
 
 	normalizeContainers(containers)
-	discoveredTunnelStates := discoverTunnelStatesForContainers(containers)
+	applyContainerAdoptions(containers, s.adoptions)
+	discoveredTunnelStates := discoverTunnelStatesForContainers(s.runtime, containers)
 	mergeTunnelStateMap(s.tunnelStateByContainerID, discoveredTunnelStates)
 	pruneTunnelStateMap(s.tunnelStateByContainerID, containers)
 	enrichContainersWithTunnelState(containers, s.tunnelStateByContainerID)
@@ -172,8 +203,9 @@ func (s *podmanService) getCachedContainers() ([]podmanContainer, string) {
 	return containers, ""
 }
 
-func (s *podmanService) addClient(conn *websocket.Conn) *podmanClient {
+func (s *podmanService) addClient(conn *websocket.Conn, access containerAccess) *podmanClient {
 	c := &podmanClient{
+		access:  access,
 		conn:    conn,
 		sendCh:  make(chan podmanStreamMessage, podmanClientBufferSize),
 		closeCh: make(chan struct{}),
@@ -203,11 +235,34 @@ func (s *podmanService) broadcast(msg podmanStreamMessage) {
 	}
 	s.hubMu.Unlock()
 
+	for _, c := range clients {
+		c.trySend(c.visible(msg))
+	}
+}
+
+func (s *podmanService) sendToOwner(owner string, msg podmanStreamMessage) {
+	s.hubMu.Lock()
+	clients := make([]*podmanClient, 0, len(s.clients))
+	for c := range s.clients {
+		if c.access.Admin || c.access.UserID == owner {
+			clients = append(clients, c)
+		}
+	}
+	s.hubMu.Unlock()
+
 	for _, c := range clients {
 		c.trySend(msg)
 	}
 }
 
+func (c *podmanClient) visible(msg podmanStreamMessage) podmanStreamMessage {
+	if msg.Type != "containers" {
+		return msg
+	}
+	msg.Data = filterContainersForAccess(msg.Data, c.access)
+	return msg
+}
+
 func (c *podmanClient) trySend(msg podmanStreamMessage) {
 	select {
 	case c.sendCh <- msg:
@@ -276,6 +331,13 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 			})
 		}
 
+		access, err := resolveContainerAccess(re)
+		if err != nil {
+			return re.JSON(http.StatusForbidden, map[string]string{
+				"message": podmanScopeForbiddenMessage,
+			})
+		}
+
 		containers, errMessage := svc.getCachedContainers()
 		if errMessage != "" {
 			status := http.StatusInternalServerError
@@ -287,7 +349,7 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 			})
 		}
 
-		return re.JSON(http.StatusOK, containers)
+		return re.JSON(http.StatusOK, filterContainersForAccess(containers, access))
 	})
 
 	rtr.GET("/podman/containers/stream", func(re *core.RequestEvent) error {
@@ -297,19 +359,29 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 			})
 		}
 
+		access, err := resolveContainerAccess(re)
+		if err != nil {
+			return re.JSON(http.StatusForbidden, map[string]string{
+				"message": podmanScopeForbiddenMessage,
+			})
+		}
+
 		conn, err := podmanStreamUpgrader.Upgrade(re.Response, re.Request, nil)
 		if err != nil {
 			return err
 		}
 
-		client := svc.addClient(conn)
+		client := svc.addClient(conn, access)
 		defer svc.removeClient(client)
 
 		containers, errMessage := svc.getCachedContainers()
 		if errMessage != "" {
 			client.trySend(podmanStreamMessage{Type: "error", Data: []podmanContainer{}, Message: errMessage})
 		} else {
-			client.trySend(podmanStreamMessage{Type: "containers", Data: containers})
+			client.trySend(client.visible(podmanStreamMessage{Type: "containers", Data: containers}))
+			if stats := svc.statsMessageFor(access); len(stats.Stats) > 0 {
+				client.trySend(stats)
+			}
 		}
 
 		svc.schedulePoll(podmanPollDebounce)
@@ -321,6 +393,45 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 		}
 	})
 
+	rtr.GET("/podman/containers/{id}", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		detail, err := svc.containerDetail(newContainerAccess(re.Auth), containerID)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": podmanInspectFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusOK, detail)
+	})
+
 	rtr.POST("/podman/containers/{id}/stop", func(re *core.RequestEvent) error {
 		if re.Auth == nil {
 			return re.JSON(http.StatusUnauthorized, map[string]string{
@@ -335,7 +446,7 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 			})
 		}
 
-		if err := svc.stopContainer(containerID); err != nil {
+		if err := svc.stopContainer(newContainerAccess(re.Auth), containerID); err != nil {
 			switch {
 			case errors.Is(err, errPodmanUnavailable):
 				return re.JSON(http.StatusServiceUnavailable, map[string]string{
@@ -345,6 +456,14 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 				return re.JSON(http.StatusNotFound, map[string]string{
 					"message": podmanContainerNotFoundMessage,
 				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
 			default:
 				return re.JSON(http.StatusInternalServerError, map[string]string{
 					"message": podmanStopFailedMessage,
@@ -371,8 +490,11 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 			})
 		}
 
-		if err := svc.startContainer(containerID); err != nil {
+		if err := svc.startContainer(newContainerAccess(re.Auth), containerID); err != nil {
+			var quotaErr *workspaceQuotaError
 			switch {
+			case errors.As(err, &quotaErr):
+				return re.JSON(quotaErrorStatus(quotaErr), quotaErr.response())
 			case errors.Is(err, errPodmanUnavailable):
 				return re.JSON(http.StatusServiceUnavailable, map[string]string{
 					"message": podmanUnavailableMessage,
@@ -381,6 +503,14 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 				return re.JSON(http.StatusNotFound, map[string]string{
 					"message": podmanContainerNotFoundMessage,
 				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
 			default:
 				return re.JSON(http.StatusInternalServerError, map[string]string{
 					"message": podmanRunFailedMessage,
@@ -393,6 +523,145 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 		})
 	})
 
+	rtr.POST("/podman/containers/{id}/restart", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		if err := svc.restartContainer(newContainerAccess(re.Auth), containerID); err != nil {
+			var quotaErr *workspaceQuotaError
+			switch {
+			case errors.As(err, &quotaErr):
+				return re.JSON(quotaErrorStatus(quotaErr), quotaErr.response())
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": podmanRestartFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusOK, map[string]string{
+			"status": "running",
+		})
+	})
+
+	rtr.POST("/podman/containers/{id}/pause", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		if err := svc.pauseContainer(newContainerAccess(re.Auth), containerID); err != nil {
+			switch {
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
+			case errors.Is(err, errContainerNotRunning):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": podmanContainerNotRunningMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": podmanPauseFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusOK, map[string]string{
+			"status": "paused",
+		})
+	})
+
+	rtr.POST("/podman/containers/{id}/unpause", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		if err := svc.unpauseContainer(newContainerAccess(re.Auth), containerID); err != nil {
+			switch {
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": podmanUnpauseFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusOK, map[string]string{
+			"status": "running",
+		})
+	})
+
 	rtr.DELETE("/podman/containers/{id}", func(re *core.RequestEvent) error {
 		if re.Auth == nil {
 			return re.JSON(http.StatusUnauthorized, map[string]string{
@@ -407,7 +676,15 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 			})
 		}
 
-		if err := svc.deleteContainer(containerID); err != nil {
+		dataMode, err := parseWorkspaceDataMode(re.Request.URL.Query().Get("data"))
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": workspaceDataModeInvalidMessage,
+			})
+		}
+
+		result, err := svc.deleteContainer(newContainerAccess(re.Auth), containerID, dataMode)
+		if err != nil {
 			switch {
 			case errors.Is(err, errPodmanUnavailable):
 				return re.JSON(http.StatusServiceUnavailable, map[string]string{
@@ -417,6 +694,14 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 				return re.JSON(http.StatusNotFound, map[string]string{
 					"message": podmanContainerNotFoundMessage,
 				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
 			default:
 				return re.JSON(http.StatusInternalServerError, map[string]string{
 					"message": podmanDeleteFailedMessage,
@@ -424,11 +709,72 @@ func registerPodmanRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanSer
 			}
 		}
 
+		if result.Archive != nil {
+			archive := result.Archive.redacted()
+			result.Archive = &archive
+		}
+		return re.JSON(http.StatusOK, result)
+	})
+
+	rtr.POST("/podman/containers/{id}/adopt", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		var payload adoptContainerPayload
+		if err := re.BindBody(&payload); err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Invalid request body.",
+			})
+		}
+
+		owner, err := svc.adoptContainer(newContainerAccess(re.Auth), containerID, payload.OwnerID)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errAdoptionOwnerNotFound):
+				return re.JSON(http.StatusBadRequest, map[string]string{
+					"message": "Owner not found.",
+				})
+			case errors.Is(err, errContainerAlreadyManaged):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": "Container is already managed by pocketpod.",
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": podmanAdoptFailedMessage,
+				})
+			}
+		}
+
 		return re.JSON(http.StatusOK, map[string]string{
-			"status": "deleted",
+			"status": "adopted",
+			"owner":  owner,
 		})
 	})
 
+	registerContainerLogRoutes(rtr, svc)
+	registerContainerTerminalRoutes(rtr, svc)
 	registerWorkspaceRoutes(rtr, svc)
 }
 
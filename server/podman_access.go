@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	labelPrefix         = "pocketpod."
+	labelWorkspaceOwner = "pocketpod.owner"
+	labelAdopted        = "pocketpod.adopted"
+
+	containerScopeAll = "all"
+
+	podmanContainerForbiddenMessage = "You do not have access to this container."
+	podmanContainerUnmanagedMessage = "Container is not managed by pocketpod. Adopt it first."
+	podmanScopeForbiddenMessage     = "Only admins can view all host containers."
+	podmanAdoptFailedMessage        = "Failed to adopt container."
+)
+
+var (
+	errContainerForbidden      = errors.New("container access forbidden")
+	errContainerUnmanaged      = errors.New("container not managed by pocketpod")
+	errContainerAlreadyManaged = errors.New("container already managed by pocketpod")
+	errContainerScopeForbidden = errors.New("container scope forbidden")
+	errAdoptionOwnerNotFound   = errors.New("adoption owner not found")
+)
+
+type containerAccess struct {
+	UserID        string
+	Admin         bool
+	AllContainers bool
+}
+
+type adoptContainerPayload struct {
+	OwnerID string `json:"ownerId"`
+}
+
+func newContainerAccess(record *core.Record) containerAccess {
+	if record == nil {
+		return containerAccess{}
+	}
+	return containerAccess{
+		UserID: record.Id,
+		Admin:  record.GetString("role") == RoleAdmin,
+	}
+}
+
+func resolveContainerAccess(re *core.RequestEvent) (containerAccess, error) {
+	access := newContainerAccess(re.Auth)
+	if strings.EqualFold(strings.TrimSpace(re.Request.URL.Query().Get("scope")), containerScopeAll) {
+		if !access.Admin {
+			return access, errContainerScopeForbidden
+		}
+		access.AllContainers = true
+	}
+	return access, nil
+}
+
+func (a containerAccess) canAccess(labels map[string]string) bool {
+	if !isManagedContainer(labels) {
+		return a.Admin && a.AllContainers
+	}
+	if a.Admin {
+		return true
+	}
+	owner := strings.TrimSpace(labels[labelWorkspaceOwner])
+	return owner != "" && owner == a.UserID
+}
+
+func isManagedContainer(labels map[string]string) bool {
+	for key := range labels {
+		if strings.HasPrefix(key, labelPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterContainersForAccess(containers []podmanContainer, access containerAccess) []podmanContainer {
+	filtered := make([]podmanContainer, 0, len(containers))
+	for _, container := range containers {
+		if access.canAccess(container.Labels) {
+			filtered = append(filtered, container)
+		}
+	}
+	return filtered
+}
+
+func (s *podmanService) authorizeContainer(access containerAccess, containerID string) (podmanInspectSummary, error) {
+	inspected, err := s.runtime.Inspect(context.Background(), containerID)
+	if err != nil {
+		return podmanInspectSummary{}, err
+	}
+
+	s.mu.RLock()
+	inspected.Config.Labels = withAdoptionLabels(inspected.ID, inspected.Config.Labels, s.adoptions)
+	s.mu.RUnlock()
+
+	if !isManagedContainer(inspected.Config.Labels) {
+		if access.Admin {
+			return podmanInspectSummary{}, errContainerUnmanaged
+		}
+		return podmanInspectSummary{}, errContainerForbidden
+	}
+	if !access.canAccess(inspected.Config.Labels) {
+		return podmanInspectSummary{}, errContainerForbidden
+	}
+	return inspected, nil
+}
+
+func (s *podmanService) authorizeContainerRead(access containerAccess, containerID string) (podmanInspectSummary, error) {
+	inspected, err := s.runtime.Inspect(context.Background(), containerID)
+	if err != nil {
+		return podmanInspectSummary{}, err
+	}
+
+	s.mu.RLock()
+	inspected.Config.Labels = withAdoptionLabels(inspected.ID, inspected.Config.Labels, s.adoptions)
+	s.mu.RUnlock()
+
+	if isManagedContainer(inspected.Config.Labels) {
+		if !access.canAccess(inspected.Config.Labels) {
+			return podmanInspectSummary{}, errContainerForbidden
+		}
+	} else if !access.Admin {
+		return podmanInspectSummary{}, errContainerForbidden
+	}
+	return inspected, nil
+}
+
+func (s *podmanService) loadAdoptions(app core.App) error {
+	records, err := app.FindAllRecords(CollectionContainerAdoptions)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range records {
+		containerID := strings.TrimSpace(record.GetString("container_id"))
+		owner := strings.TrimSpace(record.GetString("owner"))
+		if containerID != "" && owner != "" {
+			s.adoptions[containerID] = owner
+		}
+	}
+	return nil
+}
+
+func (s *podmanService) adoptContainer(access containerAccess, containerID string, ownerID string) (string, error) {
+	if !access.Admin {
+		return "", errContainerForbidden
+	}
+	if s.app == nil {
+		return "", errors.New("adoption store unavailable")
+	}
+
+	ownerID = strings.TrimSpace(ownerID)
+	if ownerID == "" {
+		ownerID = access.UserID
+	}
+	if _, err := s.app.FindRecordById(CollectionUsers, ownerID); err != nil {
+		return "", errAdoptionOwnerNotFound
+	}
+
+	inspected, err := s.runtime.Inspect(context.Background(), containerID)
+	if err != nil {
+		return "", err
+	}
+	fullID := strings.TrimSpace(inspected.ID)
+	if fullID == "" {
+		fullID = containerID
+	}
+
+	s.mu.RLock()
+	labels := withAdoptionLabels(fullID, inspected.Config.Labels, s.adoptions)
+	s.mu.RUnlock()
+	if isManagedContainer(labels) {
+		return "", errContainerAlreadyManaged
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId(CollectionContainerAdoptions)
+	if err != nil {
+		return "", err
+	}
+	record := core.NewRecord(collection)
+	record.Set("container_id", fullID)
+	record.Set("owner", ownerID)
+	record.Set("adopted_by", access.UserID)
+	if err := s.app.Save(record); err != nil {
+		return "", fmt.Errorf("save adoption: %w", err)
+	}
+
+	s.mu.Lock()
+	s.adoptions[fullID] = ownerID
+	s.mu.Unlock()
+
+	s.schedulePoll(podmanPollDebounce)
+	return ownerID, nil
+}
+
+func (s *podmanService) forgetAdoption(containerID string) {
+	s.mu.Lock()
+	var matched []string
+	for id := range s.adoptions {
+		if isContainerIDMatch(id, containerID) {
+			matched = append(matched, id)
+			delete(s.adoptions, id)
+		}
+	}
+	s.mu.Unlock()
+
+	if s.app == nil {
+		return
+	}
+	for _, id := range matched {
+		record, err := s.app.FindFirstRecordByData(CollectionContainerAdoptions, "container_id", id)
+		if err == nil {
+			_ = s.app.Delete(record)
+		}
+	}
+}
+
+func applyContainerAdoptions(containers []podmanContainer, adoptions map[string]string) {
+	if len(adoptions) == 0 {
+		return
+	}
+	for i := range containers {
+		containers[i].Labels = withAdoptionLabels(containers[i].ID, containers[i].Labels, adoptions)
+	}
+}
+
+func withAdoptionLabels(containerID string, labels map[string]string, adoptions map[string]string) map[string]string {
+	if strings.TrimSpace(containerID) == "" {
+		return labels
+	}
+	for id, owner := range adoptions {
+		if !isContainerIDMatch(id, containerID) {
+			continue
+		}
+		merged := make(map[string]string, len(labels)+2)
+		for key, value := range labels {
+			merged[key] = value
+		}
+		merged[labelWorkspaceOwner] = owner
+		merged[labelAdopted] = "true"
+		return merged
+	}
+	return labels
+}
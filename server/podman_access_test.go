@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFilterContainersForAccess(t *testing.T) {
+	containers := []podmanContainer{
+		{ID: "a", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+		{ID: "b", Labels: map[string]string{labelWorkspaceOwner: "user-2"}},
+		{ID: "c"},
+	}
+
+	owned := filterContainersForAccess(containers, containerAccess{UserID: "user-1"})
+	if len(owned) != 1 || owned[0].ID != "a" {
+		t.Fatalf("expected only owned container, got %+v", owned)
+	}
+
+	managed := filterContainersForAccess(containers, containerAccess{UserID: "admin-1", Admin: true})
+	if len(managed) != 2 {
+		t.Fatalf("expected admin to see every managed container, got %+v", managed)
+	}
+
+	all := filterContainersForAccess(containers, containerAccess{UserID: "admin-1", Admin: true, AllContainers: true})
+	if len(all) != 3 {
+		t.Fatalf("expected admin host-wide view to see every container, got %+v", all)
+	}
+
+	if none := filterContainersForAccess(containers, containerAccess{}); len(none) != 0 {
+		t.Fatalf("expected anonymous access to see nothing, got %+v", none)
+	}
+}
+
+func TestContainerActionsRejectOtherOwners(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{
+		{ID: "abc123", Name: "ws-one", Status: "running", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+		{ID: "def456", Name: "system", Status: "running"},
+	}
+	svc := newTestPodmanService(rt)
+	other := containerAccess{UserID: "user-2"}
+
+	if err := svc.stopContainer(other, "abc123"); !errors.Is(err, errContainerForbidden) {
+		t.Fatalf("expected forbidden stop, got %v", err)
+	}
+	if _, err := svc.deleteContainer(other, "abc123", workspaceDataKeep); !errors.Is(err, errContainerForbidden) {
+		t.Fatalf("expected forbidden delete, got %v", err)
+	}
+	if err := svc.startContainer(containerAccess{UserID: "user-1"}, "def456"); !errors.Is(err, errContainerForbidden) {
+		t.Fatalf("expected unowned container to be forbidden, got %v", err)
+	}
+	if len(rt.containers) != 2 || rt.containers[0].Status != "running" {
+		t.Fatalf("expected containers untouched, got %+v", rt.containers)
+	}
+
+	admin := containerAccess{UserID: "admin-1", Admin: true, AllContainers: true}
+	if err := svc.stopContainer(admin, "def456"); !errors.Is(err, errContainerUnmanaged) {
+		t.Fatalf("expected unmanaged container to be read-only, got %v", err)
+	}
+	if err := svc.stopContainer(admin, "abc123"); err != nil {
+		t.Fatalf("expected admin stop to succeed, got %v", err)
+	}
+}
+
+func TestAdoptedContainersGainOwnerLabels(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{{ID: "def456789", Name: "system", Status: "running"}}
+	svc := newTestPodmanService(rt)
+	svc.adoptions["def456"] = "user-1"
+
+	svc.poll()
+	containers, _ := svc.getCachedContainers()
+	if len(containers) != 1 || containers[0].Labels[labelWorkspaceOwner] != "user-1" || containers[0].Labels[labelAdopted] != "true" {
+		t.Fatalf("expected adoption labels, got %+v", containers)
+	}
+	if rt.containers[0].Labels != nil {
+		t.Fatalf("expected runtime labels untouched, got %+v", rt.containers[0].Labels)
+	}
+
+	if err := svc.stopContainer(containerAccess{UserID: "user-1"}, "def456789"); err != nil {
+		t.Fatalf("expected adopted owner to stop container, got %v", err)
+	}
+	if _, err := svc.deleteContainer(containerAccess{UserID: "user-1"}, "system", workspaceDataKeep); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if len(svc.adoptions) != 0 {
+		t.Fatalf("expected adoption to be forgotten, got %+v", svc.adoptions)
+	}
+}
+
+func TestAdoptContainerRequiresAdmin(t *testing.T) {
+	svc := newTestPodmanService(newFakeRuntime())
+	if _, err := svc.adoptContainer(containerAccess{UserID: "user-1"}, "abc", ""); !errors.Is(err, errContainerForbidden) {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+}
+
+func TestPodmanClientVisibleFiltersContainersMessages(t *testing.T) {
+	client := &podmanClient{access: containerAccess{UserID: "user-1"}}
+	msg := podmanStreamMessage{Type: "containers", Data: []podmanContainer{
+		{ID: "a", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+		{ID: "b", Labels: map[string]string{labelWorkspaceOwner: "user-2"}},
+	}}
+
+	visible := client.visible(msg)
+	if len(visible.Data) != 1 || visible.Data[0].ID != "a" {
+		t.Fatalf("expected filtered data, got %+v", visible.Data)
+	}
+	if len(msg.Data) != 2 {
+		t.Fatal("expected original message to be left intact")
+	}
+
+	errMsg := client.visible(podmanStreamMessage{Type: "error", Message: podmanUnavailableMessage})
+	if errMsg.Message != podmanUnavailableMessage {
+		t.Fatalf("expected error message passed through, got %+v", errMsg)
+	}
+}
@@ -1,72 +1,159 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"os/exec"
 	"strings"
 )
 
 var errPodmanContainerNotFound = errors.New("podman container not found")
 
-func (s *podmanService) stopContainer(containerID string) error {
-	output, err := runPodmanCommand("stop", containerID)
+func (s *podmanService) stopContainer(access containerAccess, containerID string) error {
+	if _, err := s.authorizeContainer(access, containerID); err != nil {
+		return err
+	}
+
+	if err := s.runtime.Stop(context.Background(), containerID); err != nil && !errors.Is(err, errContainerAlreadyStopped) {
+		return err
+	}
+
+	s.schedulePoll(podmanPollDebounce)
+	return nil
+}
+
+func (s *podmanService) checkContainerStartQuota(inspected podmanInspectSummary) error {
+	owner := strings.TrimSpace(inspected.Config.Labels[labelWorkspaceOwner])
+	if owner == "" || inspected.State.Running {
+		return nil
+	}
+	quotaStatus, err := s.workspaceQuotaStatus(owner)
 	if err != nil {
-		switch {
-		case isPodmanContainerNotFound(output):
-			return errPodmanContainerNotFound
-		case isPodmanContainerAlreadyStopped(output):
-			s.schedulePoll(podmanPollDebounce)
-			return nil
-		default:
-			return fmt.Errorf("stop container: %w", err)
+		return err
+	}
+	return checkWorkspaceStart(quotaStatus, containerLimitsFromLabels(inspected.Config.Labels))
+}
+
+func (s *podmanService) startContainer(access containerAccess, containerID string) error {
+	inspected, err := s.authorizeContainer(access, containerID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkContainerStartQuota(inspected); err != nil {
+		return err
+	}
+
+	if err := s.runtime.Start(context.Background(), containerID); err != nil {
+		if !errors.Is(err, errContainerAlreadyRunning) {
+			return err
 		}
+	} else {
+		go s.runPostStartCommand(containerID, inspected.Config.Labels)
 	}
 
 	s.schedulePoll(podmanPollDebounce)
 	return nil
 }
 
-func (s *podmanService) startContainer(containerID string) error {
-	output, err := runPodmanCommand("start", containerID)
+func (s *podmanService) deleteContainer(access containerAccess, containerID string, dataMode string) (*deleteContainerResult, error) {
+	inspected, err := s.authorizeContainer(access, containerID)
 	if err != nil {
+		return nil, err
+	}
+	var workspace *workspaceRebuild
+	if dataMode != workspaceDataKeep {
+		workspace, _ = newWorkspaceRebuild(inspected)
+	}
+
+	if err := s.runtime.Remove(context.Background(), containerID, true); err != nil {
+		return nil, err
+	}
+
+	s.stopTunnelMonitor(inspected.ID)
+	s.clearTunnelState(inspected.ID)
+	s.forgetAdoption(inspected.ID)
+	s.schedulePoll(podmanPollDebounce)
+
+	result := &deleteContainerResult{Status: "deleted"}
+	if workspace == nil {
+		return result, nil
+	}
+	result.Data = workspaceDataKeep
+	switch dataMode {
+	case workspaceDataArchive:
+		archive, err := archiveWorkspaceData(workspace)
 		switch {
-		case isPodmanContainerNotFound(output):
-			return errPodmanContainerNotFound
-		case isPodmanContainerAlreadyRunning(output):
-			s.schedulePoll(podmanPollDebounce)
-			return nil
+		case err == nil:
+			result.Data = workspaceDataArchive
+		case archive != nil:
+			result.Data = workspaceDataArchive
+			result.Warnings = append(result.Warnings, fmt.Sprintf("The repository was archived but could not be removed: %v.", err))
 		default:
-			return fmt.Errorf("start container: %w", err)
+			result.Warnings = append(result.Warnings, fmt.Sprintf("The repository could not be archived and was kept: %v.", err))
+		}
+		result.Archive = archive
+	case workspaceDataPurge:
+		if err := purgeWorkspaceData(workspace); err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("The repository could not be purged: %v.", err))
+		} else {
+			result.Data = workspaceDataPurge
 		}
 	}
+	return result, nil
+}
+
+func (s *podmanService) restartContainer(access containerAccess, containerID string) error {
+	inspected, err := s.authorizeContainer(access, containerID)
+	if err != nil {
+		return err
+	}
+
+	// Restarting a stopped container starts it.
+	if err := s.checkContainerStartQuota(inspected); err != nil {
+		return err
+	}
+
+	if err := s.runtime.Restart(context.Background(), containerID); err != nil {
+		return err
+	}
+
+	// Restarting kills the detached code tunnel process, so start a fresh
+	// one under the container's existing session. Installing the VS Code
+	// CLI can take minutes, so clients follow it over the stream instead.
+	if sessionID := strings.TrimSpace(inspected.Config.Labels[labelTunnelSession]); sessionID != "" {
+		go s.rebootstrapTunnel(containerID, inspected, sessionID)
+	}
+	go s.runPostStartCommand(containerID, inspected.Config.Labels)
 
 	s.schedulePoll(podmanPollDebounce)
 	return nil
 }
 
-func (s *podmanService) deleteContainer(containerID string) error {
-	output, err := runPodmanCommand("rm", "-f", containerID)
-	if err != nil {
-		if isPodmanContainerNotFound(output) {
-			return errPodmanContainerNotFound
-		}
-		return fmt.Errorf("delete container: %w", err)
+func (s *podmanService) pauseContainer(access containerAccess, containerID string) error {
+	if _, err := s.authorizeContainer(access, containerID); err != nil {
+		return err
+	}
+
+	if err := s.runtime.Pause(context.Background(), containerID); err != nil && !errors.Is(err, errContainerAlreadyPaused) {
+		return err
 	}
 
-	s.stopTunnelMonitor(containerID)
-	s.clearTunnelState(containerID)
 	s.schedulePoll(podmanPollDebounce)
 	return nil
 }
 
-func runPodmanCommand(args ...string) ([]byte, error) {
-	if _, err := exec.LookPath("podman"); err != nil {
-		return nil, errPodmanUnavailable
+func (s *podmanService) unpauseContainer(access containerAccess, containerID string) error {
+	if _, err := s.authorizeContainer(access, containerID); err != nil {
+		return err
 	}
 
-	cmd := exec.Command("podman", args...)
-	return cmd.CombinedOutput()
+	if err := s.runtime.Unpause(context.Background(), containerID); err != nil && !errors.Is(err, errContainerNotPaused) {
+		return err
+	}
+
+	s.schedulePoll(podmanPollDebounce)
+	return nil
 }
 
 func isPodmanContainerNotFound(output []byte) bool {
@@ -89,3 +176,32 @@ func isPodmanContainerAlreadyRunning(output []byte) bool {
 
 	return strings.Contains(text, "already running")
 }
+
+func isPodmanContainerAlreadyPaused(output []byte) bool {
+	text := strings.ToLower(string(output))
+
+	return strings.Contains(text, "already paused")
+}
+
+func isPodmanContainerNotPaused(output []byte) bool {
+	text := strings.ToLower(string(output))
+
+	return strings.Contains(text, "not paused")
+}
+
+func classifyContainerStateError(action string, output []byte) error {
+	switch action {
+	case "pause":
+		if isPodmanContainerAlreadyPaused(output) {
+			return errContainerAlreadyPaused
+		}
+		if isPodmanContainerAlreadyStopped(output) {
+			return errContainerNotRunning
+		}
+	case "unpause":
+		if isPodmanContainerNotPaused(output) {
+			return errContainerNotPaused
+		}
+	}
+	return nil
+}
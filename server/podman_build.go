@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	labelWorkspaceBuild       = "pocketpod.build"
+	labelWorkspaceBuildDigest = "pocketpod.build_digest"
+
+	workspaceBuildImagePrefix = "localhost/pocketpod/"
+
+	workspaceBuildStatusRunning   = "running"
+	workspaceBuildStatusSucceeded = "succeeded"
+	workspaceBuildStatusFailed    = "failed"
+	workspaceBuildStatusCached    = "cached"
+
+	workspaceBuildFailedMessage   = "Failed to build workspace image."
+	workspaceBuildNotFoundMessage = "Workspace build not found."
+	workspaceBuildsFailedMessage  = "Failed to load workspace builds."
+
+	workspaceBuildTimeout  = 30 * time.Minute
+	maxWorkspaceBuildLines = 1000
+)
+
+var (
+	errWorkspaceBuildNotFound = errors.New("workspace build not found")
+
+	workspaceBuildIDPattern   = regexp.MustCompile(`^[0-9]+-[0-9a-f]{8}$`)
+	workspaceBuildNamePattern = regexp.MustCompile(`[^a-z0-9]+`)
+	workspaceBuildTagPattern  = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+var workspaceBuildLocks sync.Map
+
+var workspaceBuildsDir = filepath.Join(".", "builds")
+
+type workspaceBuildSpec struct {
+	ContextDir string
+	Dockerfile string
+	Target     string
+	Args       map[string]string
+}
+
+type workspaceBuild struct {
+	ID         string    `json:"id"`
+	Owner      string    `json:"owner"`
+	RepoURL    string    `json:"repoUrl"`
+	Ref        string    `json:"ref,omitempty"`
+	Image      string    `json:"image"`
+	Digest     string    `json:"digest"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+}
+
+type workspaceBuildEvent struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Line   string `json:"line,omitempty"`
+}
+
+type workspaceBuildError struct {
+	BuildID string
+	Err     error
+}
+
+func (e *workspaceBuildError) Error() string {
+	return fmt.Sprintf("workspace build %s failed: %v", e.BuildID, e.Err)
+}
+
+func (e *workspaceBuildError) Unwrap() error {
+	return e.Err
+}
+
+func resolveWorkspaceBuildsEnabled() bool {
+	raw := strings.TrimSpace(strings.ToLower(os.Getenv("WORKSPACE_BUILDS_ENABLED")))
+	return raw != "false" && raw != "0"
+}
+
+func (c *devcontainerConfig) buildSpec(repoPath string) (*workspaceBuildSpec, error) {
+	if c == nil || c.Build == nil {
+		return nil, nil
+	}
+
+	root, err := filepath.Abs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+	configDir := filepath.Join(root, c.configDir)
+
+	contextDir := configDir
+	if c.Build.Context != "" {
+		contextDir = filepath.Join(configDir, filepath.FromSlash(c.Build.Context))
+	}
+	if !isPathWithin(root, contextDir) {
+		return nil, errors.New("build context is outside the repository")
+	}
+
+	dockerfile := filepath.Join(configDir, filepath.FromSlash(c.Build.Dockerfile))
+	if !isPathWithin(contextDir, dockerfile) {
+		return nil, errors.New("dockerfile is outside the build context")
+	}
+
+	// The checks are repeated on the resolved paths since the build follows
+	// symlinks committed to the repository.
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	if contextDir, err = filepath.EvalSymlinks(contextDir); err != nil {
+		return nil, fmt.Errorf("build context %q was not found", c.Build.Context)
+	}
+	if !isPathWithin(resolvedRoot, contextDir) {
+		return nil, errors.New("build context is outside the repository")
+	}
+	if dockerfile, err = filepath.EvalSymlinks(dockerfile); err != nil {
+		return nil, fmt.Errorf("dockerfile %q was not found", c.Build.Dockerfile)
+	}
+	if !isPathWithin(contextDir, dockerfile) {
+		return nil, errors.New("dockerfile is outside the build context")
+	}
+	info, err := os.Stat(dockerfile)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("dockerfile %q was not found", c.Build.Dockerfile)
+	}
+	relDockerfile, err := filepath.Rel(contextDir, dockerfile)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &workspaceBuildSpec{
+		ContextDir: contextDir,
+		Dockerfile: filepath.ToSlash(relDockerfile),
+		Target:     c.Build.Target,
+		Args:       map[string]string{},
+	}
+	for _, key := range sortedMapKeys(c.Build.Args) {
+		value := devcontainerContext{}.expand(c.Build.Args[key])
+		if !isValidWorkspaceEnv(key, value) {
+			return nil, fmt.Errorf("build arg %q is invalid", key)
+		}
+		spec.Args[key] = value
+	}
+	return spec, nil
+}
+
+func digestWorkspaceBuild(spec workspaceBuildSpec) (string, error) {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "dockerfile %s\ntarget %s\n", spec.Dockerfile, spec.Target)
+	for _, key := range sortedMapKeys(spec.Args) {
+		fmt.Fprintf(hash, "arg %q=%q\n", key, spec.Args[key])
+	}
+
+	err := filepath.WalkDir(spec.ContextDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(spec.ContextDir, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "file %q %o\n", filepath.ToSlash(rel), info.Mode())
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(hash, "link %q\n", link)
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			fmt.Fprintf(hash, "size %d\n", info.Size())
+			if _, err := io.Copy(hash, file); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func workspaceBuildTag(repoURL string, ref string, digest string) string {
+	name := strings.TrimSuffix(strings.ToLower(pathBase(extractRepoPath(repoURL))), ".git")
+	name = strings.Trim(workspaceBuildNamePattern.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		name = "workspace"
+	}
+	if len(name) > 64 {
+		name = strings.TrimRight(name[:64], "-")
+	}
+
+	tagRef := strings.Trim(workspaceBuildTagPattern.ReplaceAllString(ref, "-"), "-.")
+	if tagRef == "" {
+		tagRef = "default"
+	}
+	if len(tagRef) > 64 {
+		tagRef = tagRef[:64]
+	}
+
+	return fmt.Sprintf("%s%s:%s-%s", workspaceBuildImagePrefix, name, tagRef, digest[:12])
+}
+
+func lockWorkspaceBuild(image string) func() {
+	value, _ := workspaceBuildLocks.LoadOrStore(image, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+func (s *podmanService) buildWorkspaceImage(userID string, payload createWorkspacePayload, spec workspaceBuildSpec) (*workspaceBuild, error) {
+	digest, err := digestWorkspaceBuild(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	build := &workspaceBuild{
+		ID:        generateSessionID(),
+		Owner:     userID,
+		RepoURL:   payload.RepoURL,
+		Ref:       payload.Ref,
+		Image:     workspaceBuildTag(payload.RepoURL, payload.Ref, digest),
+		Digest:    digest,
+		Status:    workspaceBuildStatusRunning,
+		StartedAt: time.Now().UTC(),
+	}
+
+	unlock := lockWorkspaceBuild(build.Image)
+	defer unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), workspaceBuildTimeout)
+	defer cancel()
+
+	exists, err := s.runtime.ImageExists(ctx, build.Image)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		build.Status = workspaceBuildStatusCached
+		build.FinishedAt = build.StartedAt
+		if err := saveWorkspaceBuild(build, "Reusing "+build.Image+"\n"); err != nil {
+			return nil, err
+		}
+		return build, nil
+	}
+
+	if err := saveWorkspaceBuild(build, ""); err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(workspaceBuildLogPath(build.ID), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+	logWriter := bufio.NewWriter(logFile)
+
+	s.publishWorkspaceBuild(userID, workspaceBuildEvent{ID: build.ID, Status: build.Status})
+	buildErr := s.runtime.Build(ctx, containerBuildOptions{
+		ContextDir: spec.ContextDir,
+		Dockerfile: spec.Dockerfile,
+		Tag:        build.Image,
+		Target:     spec.Target,
+		Args:       spec.Args,
+		Labels: map[string]string{
+			labelWorkspaceRepo:        payload.RepoURL,
+			labelWorkspaceBuildDigest: digest,
+		},
+	}, func(line string) {
+		_, _ = logWriter.WriteString(line + "\n")
+		_ = logWriter.Flush()
+		s.publishWorkspaceBuild(userID, workspaceBuildEvent{ID: build.ID, Status: build.Status, Line: line})
+	})
+
+	build.FinishedAt = time.Now().UTC()
+	build.Status = workspaceBuildStatusSucceeded
+	if buildErr != nil {
+		build.Status = workspaceBuildStatusFailed
+		build.Error = buildErr.Error()
+	}
+	if err := writeWorkspaceBuildRecord(build); err != nil && buildErr == nil {
+		return nil, err
+	}
+	s.publishWorkspaceBuild(userID, workspaceBuildEvent{ID: build.ID, Status: build.Status})
+
+	if buildErr != nil {
+		return build, &workspaceBuildError{BuildID: build.ID, Err: buildErr}
+	}
+	return build, nil
+}
+
+func (s *podmanService) publishWorkspaceBuild(owner string, event workspaceBuildEvent) {
+	s.sendToOwner(owner, podmanStreamMessage{Type: "build", Data: []podmanContainer{}, Build: &event})
+}
+
+func workspaceBuildRecordPath(id string) string {
+	return filepath.Join(workspaceBuildsDir, id+".json")
+}
+
+func workspaceBuildLogPath(id string) string {
+	return filepath.Join(workspaceBuildsDir, id+".log")
+}
+
+func saveWorkspaceBuild(build *workspaceBuild, log string) error {
+	if err := os.MkdirAll(workspaceBuildsDir, 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(workspaceBuildLogPath(build.ID), []byte(log), 0o644); err != nil {
+		return err
+	}
+	return writeWorkspaceBuildRecord(build)
+}
+
+func writeWorkspaceBuildRecord(build *workspaceBuild) error {
+	encoded, err := json.MarshalIndent(build, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(workspaceBuildRecordPath(build.ID), encoded, 0o644)
+}
+
+func loadWorkspaceBuild(id string) (*workspaceBuild, error) {
+	if !workspaceBuildIDPattern.MatchString(id) {
+		return nil, errWorkspaceBuildNotFound
+	}
+	data, err := os.ReadFile(workspaceBuildRecordPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errWorkspaceBuildNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var build workspaceBuild
+	if err := json.Unmarshal(data, &build); err != nil {
+		return nil, err
+	}
+	return &build, nil
+}
+
+func listWorkspaceBuilds(access containerAccess) ([]workspaceBuild, error) {
+	entries, err := os.ReadDir(workspaceBuildsDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []workspaceBuild{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	builds := []workspaceBuild{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		build, err := loadWorkspaceBuild(id)
+		if err != nil {
+			continue
+		}
+		if access.Admin || build.Owner == access.UserID {
+			builds = append(builds, *build)
+		}
+	}
+	sort.SliceStable(builds, func(i, j int) bool {
+		return builds[i].StartedAt.After(builds[j].StartedAt)
+	})
+	return builds, nil
+}
+
+func readWorkspaceBuildLog(id string) ([]string, error) {
+	file, err := os.Open(workspaceBuildLogPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if len(lines) > maxWorkspaceBuildLines {
+			lines = lines[1:]
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func registerWorkspaceBuildRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/workspaces/builds", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		builds, err := listWorkspaceBuilds(newContainerAccess(re.Auth))
+		if err != nil {
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": workspaceBuildsFailedMessage,
+			})
+		}
+
+		return re.JSON(http.StatusOK, builds)
+	})
+
+	rtr.GET("/podman/workspaces/builds/{id}", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		access := newContainerAccess(re.Auth)
+		build, err := loadWorkspaceBuild(strings.TrimSpace(re.Request.PathValue("id")))
+		if err == nil && !access.Admin && build.Owner != access.UserID {
+			err = errWorkspaceBuildNotFound
+		}
+		var lines []string
+		if err == nil {
+			lines, err = readWorkspaceBuildLog(build.ID)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, errWorkspaceBuildNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": workspaceBuildNotFoundMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": workspaceBuildsFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusOK, struct {
+			*workspaceBuild
+			Log []string `json:"log"`
+		}{build, lines})
+	})
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sampleBuildDevcontainerJSON = `{
+	"build": {"dockerfile": "Dockerfile", "context": "..", "args": {"VARIANT": "20"}},
+	"remoteUser": "node",
+}`
+
+func writeBuildRepo(t *testing.T, repoPath string, devcontainerJSON string) {
+	t.Helper()
+	files := map[string]string{
+		".devcontainer/devcontainer.json": devcontainerJSON,
+		".devcontainer/Dockerfile":        "FROM docker.io/library/node:20\n",
+		"package.json":                    "{}\n",
+	}
+	for name, content := range files {
+		target := filepath.Join(repoPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(target, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func TestDevcontainerBuildSpec(t *testing.T) {
+	repoPath := t.TempDir()
+	writeBuildRepo(t, repoPath, sampleBuildDevcontainerJSON)
+
+	config, _ := readWorkspaceDevcontainer(repoPath)
+	spec, err := config.buildSpec(repoPath)
+	if err != nil {
+		t.Fatalf("build spec: %v", err)
+	}
+	if spec.ContextDir != repoPath || spec.Dockerfile != ".devcontainer/Dockerfile" || spec.Args["VARIANT"] != "20" {
+		t.Fatalf("unexpected spec: %+v", spec)
+	}
+
+	legacy, _, err := parseDevcontainerConfig([]byte(`{"dockerFile": "Dockerfile"}`))
+	if err != nil {
+		t.Fatalf("parse legacy: %v", err)
+	}
+	legacy.configDir = ".devcontainer"
+	if spec, err := legacy.buildSpec(repoPath); err != nil || spec.ContextDir != filepath.Join(repoPath, ".devcontainer") || spec.Dockerfile != "Dockerfile" {
+		t.Fatalf("expected legacy dockerFile to build from the config dir, got %+v, %v", spec, err)
+	}
+
+	for _, raw := range []string{
+		`{"build": {"dockerfile": "Dockerfile", "context": "../.."}}`,
+		`{"build": {"dockerfile": "../package.json"}}`,
+		`{"build": {"dockerfile": "Missing"}}`,
+	} {
+		config, _, err := parseDevcontainerConfig([]byte(raw))
+		if err != nil {
+			t.Fatalf("parse %s: %v", raw, err)
+		}
+		config.configDir = ".devcontainer"
+		if _, err := config.buildSpec(repoPath); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+
+	// Symlinks out of the repository are rejected for the context and the
+	// Dockerfile alike.
+	hostDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(hostDir, "Dockerfile"), []byte("FROM alpine\nCOPY . /host\n"), 0o644); err != nil {
+		t.Fatalf("write host dockerfile: %v", err)
+	}
+	if err := os.Symlink(hostDir, filepath.Join(repoPath, "host")); err != nil {
+		t.Fatalf("symlink context: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(hostDir, "Dockerfile"), filepath.Join(repoPath, ".devcontainer", "Host.Dockerfile")); err != nil {
+		t.Fatalf("symlink dockerfile: %v", err)
+	}
+	for _, raw := range []string{
+		`{"build": {"dockerfile": "../host/Dockerfile", "context": "../host"}}`,
+		`{"build": {"dockerfile": "Host.Dockerfile"}}`,
+	} {
+		config, _, err := parseDevcontainerConfig([]byte(raw))
+		if err != nil {
+			t.Fatalf("parse %s: %v", raw, err)
+		}
+		config.configDir = ".devcontainer"
+		if _, err := config.buildSpec(repoPath); err == nil || !strings.Contains(err.Error(), "outside") {
+			t.Fatalf("expected %s to be rejected as outside, got %v", raw, err)
+		}
+	}
+}
+
+func TestDigestWorkspaceBuild(t *testing.T) {
+	repoPath := t.TempDir()
+	writeBuildRepo(t, repoPath, sampleBuildDevcontainerJSON)
+	spec := workspaceBuildSpec{ContextDir: repoPath, Dockerfile: ".devcontainer/Dockerfile"}
+
+	first, err := digestWorkspaceBuild(spec)
+	if err != nil {
+		t.Fatalf("digest: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(repoPath, ".git"), 0o755); err != nil {
+		t.Fatalf("mkdir .git: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0o644); err != nil {
+		t.Fatalf("write HEAD: %v", err)
+	}
+	if again, _ := digestWorkspaceBuild(spec); again != first {
+		t.Fatal("expected .git to be left out of the digest")
+	}
+
+	spec.Args = map[string]string{"VARIANT": "22"}
+	if withArgs, _ := digestWorkspaceBuild(spec); withArgs == first {
+		t.Fatal("expected build args to change the digest")
+	}
+	spec.Args = nil
+
+	if err := os.WriteFile(filepath.Join(repoPath, "package.json"), []byte(`{"name":"app"}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if changed, _ := digestWorkspaceBuild(spec); changed == first {
+		t.Fatal("expected a context change to change the digest")
+	}
+}
+
+func TestWorkspaceBuildTag(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	cases := map[string][2]string{
+		"localhost/pocketpod/app:main-abababababab":          {"https://github.com/org/App.git", "main"},
+		"localhost/pocketpod/my-repo:feature-x-abababababab": {"git@github.com:org/my_repo.git", "feature/x"},
+		"localhost/pocketpod/workspace:default-abababababab": {"https://example.com/", ""},
+	}
+	for want, input := range cases {
+		if got := workspaceBuildTag(input[0], input[1], digest); got != want {
+			t.Fatalf("workspaceBuildTag(%q, %q) = %q, want %q", input[0], input[1], got, want)
+		}
+	}
+}
+
+func TestCreateWorkspaceBuildsDevcontainerImage(t *testing.T) {
+	originalWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir temp: %v", err)
+	}
+	originalRun := runWorkspaceCommand
+	originalLookPath := workspaceLookPath
+	t.Cleanup(func() {
+		_ = os.Chdir(originalWD)
+		runWorkspaceCommand = originalRun
+		workspaceLookPath = originalLookPath
+	})
+	runWorkspaceCommand = func(_ []string, name string, args ...string) ([]byte, error) {
+		if len(args) > 0 && args[0] == "clone" {
+			writeBuildRepo(t, args[len(args)-1], sampleBuildDevcontainerJSON)
+		}
+		return nil, nil
+	}
+	workspaceLookPath = func(string) (string, error) { return "git", nil }
+	stubWorkspaceImages(t, builtinWorkspaceImages)
+
+	rt := newFakeRuntime()
+	rt.passwd = "root:x:0:0:root:/root:/bin/bash\nnode:x:1000:1000::/home/node:/bin/bash"
+	rt.buildLog = []string{"STEP 1/1: FROM docker.io/library/node:20"}
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	first, err := svc.createWorkspace("user-1", createWorkspacePayload{RepoURL: "https://github.com/org/app.git", Name: "first"}, nil)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if len(rt.builds) != 1 || first.Build == nil || first.Build.Status != workspaceBuildStatusSucceeded {
+		t.Fatalf("expected one successful build, got %+v, %+v", rt.builds, first.Build)
+	}
+	spec := rt.created[len(rt.created)-1]
+	if spec.Image != first.Build.Image || spec.Labels[labelWorkspaceBuild] != first.Build.ID {
+		t.Fatalf("expected container to use the built image, got %q and %v", spec.Image, spec.Labels)
+	}
+	if rt.builds[0].Args["VARIANT"] != "20" || rt.builds[0].Labels[labelWorkspaceBuildDigest] != first.Build.Digest {
+		t.Fatalf("unexpected build options: %+v", rt.builds[0])
+	}
+	lines, err := readWorkspaceBuildLog(first.Build.ID)
+	if err != nil || len(lines) != 1 || lines[0] != rt.buildLog[0] {
+		t.Fatalf("expected stored build output, got %v, %v", lines, err)
+	}
+
+	second, err := svc.createWorkspace("user-1", createWorkspacePayload{RepoURL: "https://github.com/org/app.git", Name: "second"}, nil)
+	if err != nil {
+		t.Fatalf("create second workspace: %v", err)
+	}
+	if len(rt.builds) != 1 || second.Build.Status != workspaceBuildStatusCached || second.Build.Image != first.Build.Image {
+		t.Fatalf("expected the image to be reused, got %+v", second.Build)
+	}
+
+	rt.buildErr = errors.New("image build: exit status 1")
+	_, err = svc.createWorkspace("user-1", createWorkspacePayload{RepoURL: "https://github.com/org/app.git", Name: "third", Ref: "v2"}, nil)
+	var buildErr *workspaceBuildError
+	if !errors.As(err, &buildErr) {
+		t.Fatalf("expected build error, got %v", err)
+	}
+	failed, err := loadWorkspaceBuild(buildErr.BuildID)
+	if err != nil || failed.Status != workspaceBuildStatusFailed || failed.Error == "" {
+		t.Fatalf("expected failed build record, got %+v, %v", failed, err)
+	}
+
+	mine, err := listWorkspaceBuilds(containerAccess{UserID: "user-1"})
+	if err != nil || len(mine) != 3 {
+		t.Fatalf("expected three builds for the owner, got %d, %v", len(mine), err)
+	}
+	if others, _ := listWorkspaceBuilds(containerAccess{UserID: "user-2"}); len(others) != 0 {
+		t.Fatalf("expected no builds for another user, got %+v", others)
+	}
+}
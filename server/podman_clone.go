@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	labelWorkspaceCloneDepth   = "pocketpod.clone_depth"
+	labelWorkspaceSingleBranch = "pocketpod.single_branch"
+	labelWorkspaceSubmodules   = "pocketpod.submodules"
+	labelWorkspaceLFS          = "pocketpod.lfs"
+	labelWorkspaceBranch       = "pocketpod.branch"
+
+	maxWorkspaceCloneDepth = 1000000
+)
+
+var (
+	errWorkspaceSubmodulesFailed = errors.New("workspace submodule update failed")
+	errWorkspaceLFSMissing       = errors.New("git-lfs unavailable")
+	errWorkspaceLFSFailed        = errors.New("workspace lfs fetch failed")
+
+	workspaceBranchPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]*$`)
+	commitRefPattern       = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+)
+
+type workspaceCloneOptions struct {
+	Depth        int
+	SingleBranch bool
+	Submodules   bool
+	LFS          bool
+	Branch       string
+	Reference    string
+}
+
+func validateWorkspaceCloneOptions(payload *createWorkspacePayload) (workspaceCloneOptions, error) {
+	payload.Branch = strings.TrimSpace(payload.Branch)
+
+	switch {
+	case payload.Depth < 0:
+		return workspaceCloneOptions{}, errors.New("depth must not be negative")
+	case payload.Depth > maxWorkspaceCloneDepth:
+		return workspaceCloneOptions{}, fmt.Errorf("depth must be at most %d", maxWorkspaceCloneDepth)
+	}
+
+	if payload.Branch != "" && !isValidWorkspaceBranchName(payload.Branch) {
+		return workspaceCloneOptions{}, errors.New("branch must be a valid git branch name")
+	}
+
+	return workspaceCloneOptions{
+		Depth:        payload.Depth,
+		SingleBranch: payload.SingleBranch,
+		Submodules:   payload.Submodules,
+		LFS:          payload.LFS,
+		Branch:       payload.Branch,
+	}, nil
+}
+
+func isValidWorkspaceBranchName(name string) bool {
+	switch {
+	case len(name) > maxWorkspaceRefLength:
+		return false
+	case !workspaceBranchPattern.MatchString(name):
+		return false
+	case strings.Contains(name, ".."), strings.Contains(name, "//"), strings.Contains(name, "/."):
+		return false
+	case strings.HasSuffix(name, "/"), strings.HasSuffix(name, "."), strings.HasSuffix(name, ".lock"):
+		return false
+	case name == "HEAD":
+		return false
+	}
+	return true
+}
+
+func (o workspaceCloneOptions) shallow() bool {
+	return o.Depth > 0 || o.SingleBranch
+}
+
+func (o workspaceCloneOptions) labels() map[string]string {
+	labels := map[string]string{}
+	if o.Depth > 0 {
+		labels[labelWorkspaceCloneDepth] = strconv.Itoa(o.Depth)
+	}
+	if o.SingleBranch {
+		labels[labelWorkspaceSingleBranch] = "true"
+	}
+	if o.Submodules {
+		labels[labelWorkspaceSubmodules] = "true"
+	}
+	if o.LFS {
+		labels[labelWorkspaceLFS] = "true"
+	}
+	if o.Branch != "" {
+		labels[labelWorkspaceBranch] = o.Branch
+	}
+	return labels
+}
+
+func (o workspaceCloneOptions) cloneArgs(repoURL string, ref string, repoPath string) []string {
+	args := []string{"clone"}
+	if o.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(o.Depth))
+	}
+	if o.SingleBranch {
+		args = append(args, "--single-branch")
+	}
+	if o.clonesRef(ref) {
+		args = append(args, "--branch", ref)
+	}
+	if o.Reference != "" {
+		// --dissociate copies the borrowed objects so the clone keeps
+		// working inside the container and after the mirror is evicted.
+		args = append(args, "--reference-if-able", o.Reference, "--dissociate")
+	}
+	return append(args, "--", repoURL, repoPath)
+}
+
+func (o workspaceCloneOptions) clonesRef(ref string) bool {
+	return ref != "" && o.shallow() && !commitRefPattern.MatchString(ref)
+}
+
+func checkoutWorkspaceRef(repoPath string, ref string, options workspaceCloneOptions, env []string) error {
+	if ref != "" && options.shallow() && commitRefPattern.MatchString(ref) {
+		args := []string{"-C", repoPath, "fetch"}
+		if options.Depth > 0 {
+			args = append(args, "--depth", strconv.Itoa(options.Depth))
+		}
+		args = append(args, "origin", ref)
+		if output, err := runWorkspaceCommand(env, "git", args...); err != nil {
+			return fmt.Errorf("%w: %s", errWorkspaceRefFailed, strings.TrimSpace(string(output)))
+		}
+	}
+
+	var checkout []string
+	switch {
+	case options.Branch != "":
+		start := ref
+		if start == "" || options.clonesRef(ref) {
+			start = "HEAD"
+		}
+		checkout = []string{"-C", repoPath, "checkout", "-b", options.Branch, start}
+	case ref != "" && !options.clonesRef(ref):
+		checkout = []string{"-C", repoPath, "checkout", "--detach", ref}
+	}
+	if checkout != nil {
+		if output, err := runWorkspaceCommand(env, "git", checkout...); err != nil {
+			return fmt.Errorf("%w: %s", errWorkspaceRefFailed, strings.TrimSpace(string(output)))
+		}
+	}
+
+	if options.Submodules {
+		if output, err := runWorkspaceCommand(env, "git", "-C", repoPath, "submodule", "update", "--init", "--recursive"); err != nil {
+			return fmt.Errorf("%w: %s", errWorkspaceSubmodulesFailed, strings.TrimSpace(string(output)))
+		}
+	}
+	if options.LFS {
+		if output, err := runWorkspaceCommand(env, "git", "-C", repoPath, "lfs", "pull"); err != nil {
+			return fmt.Errorf("%w: %s", errWorkspaceLFSFailed, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+func checkWorkspaceLFS(options workspaceCloneOptions) error {
+	if !options.LFS {
+		return nil
+	}
+	if _, err := runWorkspaceCommand(nil, "git", "lfs", "version"); err != nil {
+		return errWorkspaceLFSMissing
+	}
+	return nil
+}
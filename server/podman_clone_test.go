@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func recordWorkspaceCommands(t *testing.T, fail func(args []string) bool) *[][]string {
+	t.Helper()
+	original := runWorkspaceCommand
+	t.Cleanup(func() {
+		runWorkspaceCommand = original
+	})
+	calls := [][]string{}
+	runWorkspaceCommand = func(_ []string, name string, args ...string) ([]byte, error) {
+		calls = append(calls, append([]string{name}, args...))
+		if fail != nil && fail(args) {
+			return []byte("fatal: failed"), errors.New("exit status 128")
+		}
+		return nil, nil
+	}
+	return &calls
+}
+
+func TestValidateWorkspaceCloneOptions(t *testing.T) {
+	payload := createWorkspacePayload{
+		RepoURL:      "https://github.com/org/repo.git",
+		Depth:        1,
+		SingleBranch: true,
+		Submodules:   true,
+		LFS:          true,
+		Branch:       " feature/login ",
+	}
+	if err := validateCreateWorkspacePayload(&payload); err != nil {
+		t.Fatalf("expected valid payload, got %v", err)
+	}
+	want := workspaceCloneOptions{Depth: 1, SingleBranch: true, Submodules: true, LFS: true, Branch: "feature/login"}
+	if payload.clone != want {
+		t.Fatalf("expected %+v, got %+v", want, payload.clone)
+	}
+
+	for _, invalid := range []createWorkspacePayload{
+		{Depth: -1},
+		{Depth: maxWorkspaceCloneDepth + 1},
+		{Branch: "-delete"},
+		{Branch: "feature..x"},
+		{Branch: "feature/"},
+		{Branch: "topic.lock"},
+		{Branch: "with space"},
+		{Branch: "HEAD"},
+	} {
+		invalid.RepoURL = "https://github.com/org/repo.git"
+		if err := validateCreateWorkspacePayload(&invalid); err == nil {
+			t.Fatalf("expected %+v to be rejected", invalid)
+		}
+	}
+}
+
+func TestWorkspaceCloneOptionsCloneArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		options workspaceCloneOptions
+		ref     string
+		want    []string
+	}{
+		{
+			name: "full clone",
+			ref:  "main",
+			want: []string{"clone", "--", "url", "path"},
+		},
+		{
+			name:    "shallow branch",
+			options: workspaceCloneOptions{Depth: 1, SingleBranch: true},
+			ref:     "main",
+			want:    []string{"clone", "--depth", "1", "--single-branch", "--branch", "main", "--", "url", "path"},
+		},
+		{
+			name:    "shallow commit",
+			options: workspaceCloneOptions{Depth: 5},
+			ref:     strings.Repeat("a", 40),
+			want:    []string{"clone", "--depth", "5", "--", "url", "path"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.options.cloneArgs("url", tt.ref, "path"); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestCheckoutWorkspaceRef(t *testing.T) {
+	commit := strings.Repeat("b", 40)
+	tests := []struct {
+		name    string
+		ref     string
+		options workspaceCloneOptions
+		want    [][]string
+	}{
+		{
+			name: "detached ref",
+			ref:  "v1.0.0",
+			want: [][]string{{"git", "-C", "repo", "checkout", "--detach", "v1.0.0"}},
+		},
+		{
+			name:    "new branch from ref",
+			ref:     "main",
+			options: workspaceCloneOptions{Branch: "feature/x"},
+			want:    [][]string{{"git", "-C", "repo", "checkout", "-b", "feature/x", "main"}},
+		},
+		{
+			name:    "new branch from shallow branch",
+			ref:     "main",
+			options: workspaceCloneOptions{Depth: 1, Branch: "feature/x"},
+			want:    [][]string{{"git", "-C", "repo", "checkout", "-b", "feature/x", "HEAD"}},
+		},
+		{
+			name:    "shallow commit with submodules and lfs",
+			ref:     commit,
+			options: workspaceCloneOptions{Depth: 1, Submodules: true, LFS: true},
+			want: [][]string{
+				{"git", "-C", "repo", "fetch", "--depth", "1", "origin", commit},
+				{"git", "-C", "repo", "checkout", "--detach", commit},
+				{"git", "-C", "repo", "submodule", "update", "--init", "--recursive"},
+				{"git", "-C", "repo", "lfs", "pull"},
+			},
+		},
+		{
+			name:    "shallow branch is already checked out",
+			ref:     "main",
+			options: workspaceCloneOptions{SingleBranch: true},
+			want:    [][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		calls := recordWorkspaceCommands(t, nil)
+		if err := checkoutWorkspaceRef("repo", tt.ref, tt.options, nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(*calls, tt.want) {
+			t.Fatalf("%s: expected calls %v, got %v", tt.name, tt.want, *calls)
+		}
+	}
+}
+
+func TestCheckoutWorkspaceRefReportsFailedStep(t *testing.T) {
+	recordWorkspaceCommands(t, func(args []string) bool { return args[2] == "submodule" })
+	err := checkoutWorkspaceRef("repo", "", workspaceCloneOptions{Submodules: true}, nil)
+	if !errors.Is(err, errWorkspaceSubmodulesFailed) {
+		t.Fatalf("expected submodule failure, got %v", err)
+	}
+
+	recordWorkspaceCommands(t, func(args []string) bool { return args[0] == "lfs" })
+	if err := checkWorkspaceLFS(workspaceCloneOptions{LFS: true}); !errors.Is(err, errWorkspaceLFSMissing) {
+		t.Fatalf("expected missing git-lfs, got %v", err)
+	}
+}
+
+func TestCreateWorkspaceLabelsCloneOptions(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	payload := createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-one",
+		Ref:     "main",
+		Depth:   10,
+		LFS:     true,
+		Branch:  "feature/x",
+	}
+	if err := validateCreateWorkspacePayload(&payload); err != nil {
+		t.Fatalf("validate payload: %v", err)
+	}
+	result, err := svc.createWorkspace("user-1", payload, nil)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if result.Branch != "feature/x" {
+		t.Fatalf("expected branch in result, got %+v", result)
+	}
+
+	labels := rt.created[len(rt.created)-1].Labels
+	for key, want := range map[string]string{
+		labelWorkspaceCloneDepth: "10",
+		labelWorkspaceLFS:        "true",
+		labelWorkspaceBranch:     "feature/x",
+	} {
+		if labels[key] != want {
+			t.Fatalf("expected label %s=%q, got %q", key, want, labels[key])
+		}
+	}
+	if _, ok := labels[labelWorkspaceSubmodules]; ok {
+		t.Fatalf("expected no submodules label, got %v", labels)
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/security"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	gitCredentialKindToken  = "token"
+	gitCredentialKindSSHKey = "ssh_key"
+
+	// defaultGitTokenUsername is sent with tokens saved without a username;
+	// GitHub and GitLab accept any non-empty name alongside a token.
+	defaultGitTokenUsername = "x-access-token"
+
+	maxGitCredentialHostLength     = 255
+	maxGitCredentialUsernameLength = 128
+	maxGitCredentialTokenLength    = 4096
+
+	gitCredentialsDisabledMessage = "Git credential storage is not configured on the server."
+	gitCredentialsFailedMessage   = "Failed to load Git credentials."
+	gitCredentialNotFoundMessage  = "Git credential not found."
+	gitCredentialConflictMessage  = "A Git credential of this kind already exists for the host."
+
+	// gitAskpassScript answers git's username and password prompts from the
+	// environment so the token never touches the disk.
+	gitAskpassScript = "#!/bin/sh\ncase \"$1\" in\nUsername*) printf '%s\\n' \"$POCKETPOD_GIT_USERNAME\" ;;\n*) printf '%s\\n' \"$POCKETPOD_GIT_PASSWORD\" ;;\nesac\n"
+)
+
+var (
+	errGitCredentialsDisabled = errors.New("git credentials disabled")
+	errGitCredentialNotFound  = errors.New("git credential not found")
+	errGitCredentialConflict  = errors.New("git credential already exists")
+	errGitCredentialFailed    = errors.New("git credential unavailable")
+
+	gitCredentialHostPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?(:[0-9]{1,5})?$`)
+)
+
+type gitCredential struct {
+	ID        string `json:"id"`
+	Host      string `json:"host"`
+	Kind      string `json:"kind"`
+	Username  string `json:"username,omitempty"`
+	PublicKey string `json:"publicKey,omitempty"`
+	Created   string `json:"created"`
+
+	secret string
+}
+
+type createGitCredentialPayload struct {
+	Host     string `json:"host"`
+	Kind     string `json:"kind"`
+	Username string `json:"username"`
+	Token    string `json:"token"`
+}
+
+func resolveGitCredentialsKey() (string, error) {
+	raw := strings.TrimSpace(os.Getenv("GIT_CREDENTIALS_KEY"))
+	if raw == "" {
+		return "", errGitCredentialsDisabled
+	}
+	sum := sha256.Sum256([]byte(raw))
+	return string(sum[:]), nil
+}
+
+func gitCredentialTarget(repoURL string) (string, string) {
+	if scpLikeGitPattern.MatchString(repoURL) {
+		host := strings.TrimPrefix(repoURL[:strings.Index(repoURL, ":")], "git@")
+		return strings.ToLower(host), gitCredentialKindSSHKey
+	}
+
+	parsed, err := url.Parse(repoURL)
+	if err != nil {
+		return "", ""
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "https", "http":
+		return strings.ToLower(parsed.Host), gitCredentialKindToken
+	case "ssh":
+		return strings.ToLower(parsed.Host), gitCredentialKindSSHKey
+	default:
+		return "", ""
+	}
+}
+
+func gitCredentialFromRecord(record *core.Record) gitCredential {
+	return gitCredential{
+		ID:        record.Id,
+		Host:      record.GetString("host"),
+		Kind:      record.GetString("kind"),
+		Username:  record.GetString("username"),
+		PublicKey: record.GetString("public_key"),
+		Created:   record.GetDateTime("created").String(),
+	}
+}
+
+var lookupGitCredential = func(app core.App, userID string, host string, kind string) (*gitCredential, error) {
+	if app == nil || host == "" {
+		return nil, nil
+	}
+
+	record, err := app.FindFirstRecordByFilter(
+		CollectionGitCredentials,
+		"owner = {:owner} && host = {:host} && kind = {:kind}",
+		dbx.Params{"owner": userID, "host": host, "kind": kind},
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := resolveGitCredentialsKey()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := security.Decrypt(record.GetString("secret"), key)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt git credential: %w", err)
+	}
+
+	credential := gitCredentialFromRecord(record)
+	credential.secret = string(secret)
+	return &credential, nil
+}
+
+func listGitCredentials(app core.App, userID string) ([]gitCredential, error) {
+	records, err := app.FindRecordsByFilter(CollectionGitCredentials, "owner = {:owner}", "host,kind", 0, 0, dbx.Params{"owner": userID})
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]gitCredential, 0, len(records))
+	for _, record := range records {
+		credentials = append(credentials, gitCredentialFromRecord(record))
+	}
+	return credentials, nil
+}
+
+func validateCreateGitCredentialPayload(payload *createGitCredentialPayload) error {
+	payload.Host = strings.ToLower(strings.TrimSpace(payload.Host))
+	payload.Kind = strings.TrimSpace(payload.Kind)
+	payload.Username = strings.TrimSpace(payload.Username)
+	payload.Token = strings.TrimSpace(payload.Token)
+
+	switch {
+	case payload.Host == "":
+		return errors.New("host is required")
+	case len(payload.Host) > maxGitCredentialHostLength || !gitCredentialHostPattern.MatchString(payload.Host):
+		return errors.New("host must be a hostname such as github.com")
+	}
+
+	switch payload.Kind {
+	case gitCredentialKindToken:
+		switch {
+		case payload.Token == "":
+			return errors.New("token is required")
+		case len(payload.Token) > maxGitCredentialTokenLength:
+			return errors.New("token is too long")
+		case hasUnsafeControlChars(payload.Token):
+			return errors.New("token contains unsupported characters")
+		}
+		if payload.Username != "" && (len(payload.Username) > maxGitCredentialUsernameLength || hasUnsafeControlChars(payload.Username)) {
+			return errors.New("username is invalid")
+		}
+	case gitCredentialKindSSHKey:
+		if payload.Token != "" || payload.Username != "" {
+			return errors.New("ssh keys are generated by the server and take no token or username")
+		}
+	default:
+		return errors.New("kind must be token or ssh_key")
+	}
+	return nil
+}
+
+func generateGitDeployKey(comment string) (string, string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, comment)
+	if err != nil {
+		return "", "", err
+	}
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return "", "", err
+	}
+	authorized := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))) + " " + comment
+	return string(pem.EncodeToMemory(block)), authorized, nil
+}
+
+func createGitCredential(app core.App, userID string, payload createGitCredentialPayload) (*gitCredential, error) {
+	key, err := resolveGitCredentialsKey()
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := app.FindFirstRecordByFilter(
+		CollectionGitCredentials,
+		"owner = {:owner} && host = {:host} && kind = {:kind}",
+		dbx.Params{"owner": userID, "host": payload.Host, "kind": payload.Kind},
+	)
+	if err == nil && existing != nil {
+		return nil, errGitCredentialConflict
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	collection, err := app.FindCollectionByNameOrId(CollectionGitCredentials)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := payload.Token
+	publicKey := ""
+	username := payload.Username
+	if payload.Kind == gitCredentialKindSSHKey {
+		secret, publicKey, err = generateGitDeployKey("pocketpod-" + userID + "@" + payload.Host)
+		if err != nil {
+			return nil, err
+		}
+	} else if username == "" {
+		username = defaultGitTokenUsername
+	}
+
+	encrypted, err := security.Encrypt([]byte(secret), key)
+	if err != nil {
+		return nil, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("owner", userID)
+	record.Set("host", payload.Host)
+	record.Set("kind", payload.Kind)
+	record.Set("username", username)
+	record.Set("secret", encrypted)
+	record.Set("public_key", publicKey)
+	if err := app.Save(record); err != nil {
+		return nil, err
+	}
+
+	credential := gitCredentialFromRecord(record)
+	return &credential, nil
+}
+
+func deleteGitCredential(app core.App, userID string, id string) error {
+	record, err := app.FindRecordById(CollectionGitCredentials, id)
+	if err != nil || record.GetString("owner") != userID {
+		return errGitCredentialNotFound
+	}
+	return app.Delete(record)
+}
+
+func (s *podmanService) workspaceGitEnv(userID string, repoURL string) ([]string, func(), error) {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	noop := func() {}
+
+	host, kind := gitCredentialTarget(repoURL)
+	credential, err := lookupGitCredential(s.app, userID, host, kind)
+	if errors.Is(err, errGitCredentialsDisabled) {
+		return env, noop, nil
+	}
+	if err != nil {
+		return nil, noop, fmt.Errorf("%w: %v", errGitCredentialFailed, err)
+	}
+	if credential == nil {
+		return env, noop, nil
+	}
+
+	dir, err := os.MkdirTemp("", "pocketpod-git-")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+
+	// Ignore credential helpers configured on the server so the secret is
+	// not stored anywhere by git itself.
+	env = append(env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=credential.helper", "GIT_CONFIG_VALUE_0=")
+
+	switch credential.Kind {
+	case gitCredentialKindToken:
+		askpassPath := filepath.Join(dir, "askpass.sh")
+		if err := os.WriteFile(askpassPath, []byte(gitAskpassScript), 0o700); err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		env = append(env,
+			"GIT_ASKPASS="+askpassPath,
+			"POCKETPOD_GIT_USERNAME="+credential.Username,
+			"POCKETPOD_GIT_PASSWORD="+credential.secret,
+		)
+	case gitCredentialKindSSHKey:
+		keyPath := filepath.Join(dir, "id_ed25519")
+		if err := os.WriteFile(keyPath, []byte(credential.secret), 0o600); err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		env = append(env, "GIT_SSH_COMMAND="+buildGitSSHCommand(keyPath))
+	}
+	return env, cleanup, nil
+}
+
+func buildGitSSHCommand(keyPath string) string {
+	return fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new -o BatchMode=yes", shellSingleQuote(keyPath))
+}
+
+func registerGitCredentialRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/workspaces/credentials", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		credentials, err := listGitCredentials(svc.app, re.Auth.Id)
+		if err != nil {
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": gitCredentialsFailedMessage,
+			})
+		}
+
+		return re.JSON(http.StatusOK, credentials)
+	})
+
+	rtr.POST("/podman/workspaces/credentials", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		var payload createGitCredentialPayload
+		if err := re.BindBody(&payload); err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Invalid credential payload.",
+			})
+		}
+		if err := validateCreateGitCredentialPayload(&payload); err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": err.Error(),
+			})
+		}
+
+		credential, err := createGitCredential(svc.app, re.Auth.Id, payload)
+		if err != nil {
+			switch {
+			case errors.Is(err, errGitCredentialsDisabled):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": gitCredentialsDisabledMessage,
+				})
+			case errors.Is(err, errGitCredentialConflict):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": gitCredentialConflictMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": gitCredentialsFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusCreated, credential)
+	})
+
+	rtr.DELETE("/podman/workspaces/credentials/{id}", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		if err := deleteGitCredential(svc.app, re.Auth.Id, strings.TrimSpace(re.Request.PathValue("id"))); err != nil {
+			switch {
+			case errors.Is(err, errGitCredentialNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": gitCredentialNotFoundMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": gitCredentialsFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusOK, map[string]string{
+			"status": "deleted",
+		})
+	})
+}
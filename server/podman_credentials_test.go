@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+	"golang.org/x/crypto/ssh"
+)
+
+func stubGitCredential(t *testing.T, credential *gitCredential, err error) {
+	t.Helper()
+	original := lookupGitCredential
+	t.Cleanup(func() {
+		lookupGitCredential = original
+	})
+	lookupGitCredential = func(_ core.App, _ string, host string, kind string) (*gitCredential, error) {
+		if credential == nil || credential.Host != host || credential.Kind != kind {
+			return nil, err
+		}
+		return credential, err
+	}
+}
+
+func envValue(env []string, key string) (string, bool) {
+	for _, entry := range env {
+		if value, ok := strings.CutPrefix(entry, key+"="); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func TestGitCredentialTarget(t *testing.T) {
+	tests := []struct {
+		repoURL  string
+		wantHost string
+		wantKind string
+	}{
+		{"https://GitHub.com/org/repo.git", "github.com", gitCredentialKindToken},
+		{"http://git.internal:8080/org/repo", "git.internal:8080", gitCredentialKindToken},
+		{"ssh://git@gitlab.com/org/repo.git", "gitlab.com", gitCredentialKindSSHKey},
+		{"git@github.com:org/repo.git", "github.com", gitCredentialKindSSHKey},
+		{"file:///tmp/repo", "", ""},
+	}
+
+	for _, tt := range tests {
+		host, kind := gitCredentialTarget(tt.repoURL)
+		if host != tt.wantHost || kind != tt.wantKind {
+			t.Fatalf("%s: expected %q/%q, got %q/%q", tt.repoURL, tt.wantHost, tt.wantKind, host, kind)
+		}
+	}
+}
+
+func TestValidateCreateGitCredentialPayload(t *testing.T) {
+	valid := createGitCredentialPayload{Host: " GitHub.com ", Kind: gitCredentialKindToken, Token: "ghp_abc"}
+	if err := validateCreateGitCredentialPayload(&valid); err != nil || valid.Host != "github.com" {
+		t.Fatalf("expected valid token payload, got %v (%+v)", err, valid)
+	}
+
+	invalid := []createGitCredentialPayload{
+		{Kind: gitCredentialKindToken, Token: "x"},
+		{Host: "github.com/org", Kind: gitCredentialKindToken, Token: "x"},
+		{Host: "github.com", Kind: gitCredentialKindToken},
+		{Host: "github.com", Kind: gitCredentialKindToken, Token: "a\nb"},
+		{Host: "github.com", Kind: gitCredentialKindSSHKey, Token: "x"},
+		{Host: "github.com", Kind: "password", Token: "x"},
+	}
+	for _, payload := range invalid {
+		if err := validateCreateGitCredentialPayload(&payload); err == nil {
+			t.Fatalf("expected %+v to be rejected", payload)
+		}
+	}
+}
+
+func TestGenerateGitDeployKey(t *testing.T) {
+	privateKey, publicKey, err := generateGitDeployKey("pocketpod-user-1@github.com")
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+	if err != nil {
+		t.Fatalf("parse private key: %v", err)
+	}
+	parsed, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		t.Fatalf("parse public key: %v", err)
+	}
+	if comment != "pocketpod-user-1@github.com" || string(parsed.Marshal()) != string(signer.PublicKey().Marshal()) {
+		t.Fatalf("public key %q does not match the private key", publicKey)
+	}
+}
+
+func TestWorkspaceGitEnvUsesTokenThroughAskpass(t *testing.T) {
+	stubGitCredential(t, &gitCredential{Host: "github.com", Kind: gitCredentialKindToken, Username: "octocat", secret: "ghp_secret"}, nil)
+	svc := newTestPodmanService(newFakeRuntime())
+
+	env, cleanup, err := svc.workspaceGitEnv("user-1", "https://github.com/org/private.git")
+	if err != nil {
+		t.Fatalf("git env: %v", err)
+	}
+	askpass, ok := envValue(env, "GIT_ASKPASS")
+	if !ok {
+		t.Fatalf("expected GIT_ASKPASS in %v", env)
+	}
+	script, err := os.ReadFile(askpass)
+	if err != nil || strings.Contains(string(script), "ghp_secret") {
+		t.Fatalf("expected askpass script without the token, got %q (%v)", script, err)
+	}
+	if helper, _ := envValue(env, "GIT_CONFIG_KEY_0"); helper != "credential.helper" {
+		t.Fatalf("expected credential helpers disabled, got %v", env)
+	}
+
+	if _, err := exec.LookPath("sh"); err == nil {
+		for prompt, want := range map[string]string{
+			"Username for 'https://github.com': ":         "octocat",
+			"Password for 'https://octocat@github.com': ": "ghp_secret",
+		} {
+			cmd := exec.Command(askpass, prompt)
+			cmd.Env = append(os.Environ(), env...)
+			output, err := cmd.Output()
+			if err != nil || strings.TrimSpace(string(output)) != want {
+				t.Fatalf("askpass %q: expected %q, got %q (%v)", prompt, want, output, err)
+			}
+		}
+	}
+
+	cleanup()
+	if _, err := os.Stat(askpass); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected askpass removed, got %v", err)
+	}
+}
+
+func TestWorkspaceGitEnvUsesSSHKey(t *testing.T) {
+	stubGitCredential(t, &gitCredential{Host: "github.com", Kind: gitCredentialKindSSHKey, secret: "PRIVATE KEY"}, nil)
+	svc := newTestPodmanService(newFakeRuntime())
+
+	env, cleanup, err := svc.workspaceGitEnv("user-1", "git@github.com:org/private.git")
+	if err != nil {
+		t.Fatalf("git env: %v", err)
+	}
+	defer cleanup()
+
+	sshCommand, ok := envValue(env, "GIT_SSH_COMMAND")
+	if !ok || !strings.Contains(sshCommand, "IdentitiesOnly=yes") {
+		t.Fatalf("expected GIT_SSH_COMMAND in %v", env)
+	}
+	keyPath := strings.Trim(strings.Fields(sshCommand)[2], "'")
+	info, err := os.Stat(keyPath)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected private key with mode 0600, got %v (%v)", info, err)
+	}
+	if _, ok := envValue(env, "GIT_ASKPASS"); ok {
+		t.Fatalf("expected no askpass for ssh clones, got %v", env)
+	}
+}
+
+func TestWorkspaceGitEnvWithoutCredential(t *testing.T) {
+	stubGitCredential(t, nil, nil)
+	svc := newTestPodmanService(newFakeRuntime())
+
+	env, cleanup, err := svc.workspaceGitEnv("user-1", "https://github.com/org/public.git")
+	if err != nil {
+		t.Fatalf("git env: %v", err)
+	}
+	cleanup()
+	if !slices.Equal(env, []string{"GIT_TERMINAL_PROMPT=0"}) {
+		t.Fatalf("expected only prompts disabled, got %v", env)
+	}
+
+	stubGitCredential(t, nil, errors.New("decrypt failed"))
+	if _, _, err := svc.workspaceGitEnv("user-1", "https://github.com/org/public.git"); !errors.Is(err, errGitCredentialFailed) {
+		t.Fatalf("expected credential failure, got %v", err)
+	}
+}
+
+func TestCreateWorkspaceClonesWithStoredCredential(t *testing.T) {
+	stubWorkspaceClone(t)
+	stubGitCredential(t, &gitCredential{Host: "github.com", Kind: gitCredentialKindToken, Username: "octocat", secret: "ghp_secret"}, nil)
+	var cloneEnv []string
+	var cloneArgs []string
+	runWorkspaceCommand = func(env []string, name string, args ...string) ([]byte, error) {
+		if args[0] == "clone" {
+			cloneEnv = env
+			cloneArgs = args
+		}
+		return nil, nil
+	}
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	if _, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/private.git",
+		Name:    "ws-private",
+	}, nil); err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if password, _ := envValue(cloneEnv, "POCKETPOD_GIT_PASSWORD"); password != "ghp_secret" {
+		t.Fatalf("expected token passed through the environment, got %v", cloneEnv)
+	}
+	for _, arg := range cloneArgs {
+		if strings.Contains(arg, "ghp_secret") {
+			t.Fatalf("expected token kept out of clone arguments, got %v", cloneArgs)
+		}
+	}
+	askpass, _ := envValue(cloneEnv, "GIT_ASKPASS")
+	if _, err := os.Stat(askpass); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected askpass removed after the clone, got %v", err)
+	}
+}
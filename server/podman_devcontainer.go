@@ -0,0 +1,694 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	labelWorkspaceRemoteUser   = "pocketpod.remote_user"
+	labelWorkspaceRemoteEnv    = "pocketpod.remote_env"
+	labelWorkspaceForwardPorts = "pocketpod.forward_ports"
+	labelWorkspacePostStart    = "pocketpod.post_start_command"
+
+	maxDevcontainerFileSize      = 1 << 20
+	devcontainerLifecycleTimeout = 15 * time.Minute
+)
+
+var devcontainerConfigPaths = []string{
+	filepath.Join(".devcontainer", "devcontainer.json"),
+	".devcontainer.json",
+}
+
+var devcontainerSupportedKeys = map[string]struct{}{
+	"$schema":           {},
+	"name":              {},
+	"image":             {},
+	"build":             {},
+	"dockerFile":        {},
+	"context":           {},
+	"containerEnv":      {},
+	"remoteEnv":         {},
+	"remoteUser":        {},
+	"mounts":            {},
+	"forwardPorts":      {},
+	"runArgs":           {},
+	"postCreateCommand": {},
+	"postStartCommand":  {},
+}
+
+var (
+	devcontainerVariablePattern = regexp.MustCompile(`\$\{([A-Za-z]+)(?::([^}:]+))?(?::([^}]*))?\}`)
+	devcontainerUserPattern     = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,31}$`)
+	devcontainerPortPattern     = regexp.MustCompile(`^(?:[A-Za-z0-9.-]+:)?[0-9]{1,5}$`)
+)
+
+type devcontainerConfig struct {
+	Image             string             `json:"image"`
+	Build             *devcontainerBuild `json:"build"`
+	DockerFile        string             `json:"dockerFile"`
+	Context           string             `json:"context"`
+	ContainerEnv      map[string]string  `json:"containerEnv"`
+	RemoteEnv         map[string]*string `json:"remoteEnv"`
+	RemoteUser        string             `json:"remoteUser"`
+	Mounts            []json.RawMessage  `json:"mounts"`
+	ForwardPorts      []json.RawMessage  `json:"forwardPorts"`
+	RunArgs           []string           `json:"runArgs"`
+	PostCreateCommand json.RawMessage    `json:"postCreateCommand"`
+	PostStartCommand  json.RawMessage    `json:"postStartCommand"`
+
+	configDir string
+}
+
+type devcontainerBuild struct {
+	Dockerfile string            `json:"dockerfile"`
+	Context    string            `json:"context"`
+	Args       map[string]string `json:"args"`
+	Target     string            `json:"target"`
+}
+
+type devcontainerCommandStep struct {
+	Name string   `json:"name,omitempty"`
+	Cmd  []string `json:"cmd"`
+}
+
+type devcontainerContext struct {
+	UserID          string
+	LocalFolder     string
+	ContainerFolder string
+}
+
+type workspaceDevcontainer struct {
+	Env          map[string]string
+	RemoteEnv    map[string]string
+	Mounts       []string
+	ForwardPorts []string
+	PostCreate   []devcontainerCommandStep
+	PostStart    []devcontainerCommandStep
+	Warnings     []string
+}
+
+func readWorkspaceDevcontainer(repoPath string) (*devcontainerConfig, []string) {
+	root, err := filepath.EvalSymlinks(repoPath)
+	if err != nil {
+		return nil, nil
+	}
+	for _, relPath := range devcontainerConfigPaths {
+		// Symlinks are resolved so a committed link cannot read host files.
+		configPath, err := filepath.EvalSymlinks(filepath.Join(repoPath, relPath))
+		if err != nil {
+			continue
+		}
+		if !isPathWithin(root, configPath) {
+			return nil, []string{relPath + " points outside the repository and was ignored."}
+		}
+		info, err := os.Stat(configPath)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if info.Size() > maxDevcontainerFileSize {
+			return nil, []string{relPath + " is too large and was ignored."}
+		}
+
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			return nil, []string{relPath + " could not be read and was ignored."}
+		}
+		config, warnings, err := parseDevcontainerConfig(data)
+		if err != nil {
+			return nil, []string{fmt.Sprintf("%s could not be parsed and was ignored: %v", relPath, err)}
+		}
+		config.configDir = filepath.Dir(relPath)
+		return config, warnings
+	}
+	return nil, nil
+}
+
+func parseDevcontainerConfig(data []byte) (*devcontainerConfig, []string, error) {
+	data = stripJSONC(data)
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, err
+	}
+	var warnings []string
+	for _, key := range sortedMapKeys(raw) {
+		if _, ok := devcontainerSupportedKeys[key]; !ok {
+			warnings = append(warnings, fmt.Sprintf("devcontainer.json property %q is not supported and was ignored.", key))
+		}
+	}
+
+	var config devcontainerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, nil, err
+	}
+	config.Image = strings.TrimSpace(config.Image)
+	config.RemoteUser = strings.TrimSpace(config.RemoteUser)
+
+	if config.Build == nil && strings.TrimSpace(config.DockerFile) != "" {
+		config.Build = &devcontainerBuild{Dockerfile: config.DockerFile, Context: config.Context}
+	}
+	if config.Build != nil {
+		config.Build.Dockerfile = strings.TrimSpace(config.Build.Dockerfile)
+		config.Build.Context = strings.TrimSpace(config.Build.Context)
+		config.Build.Target = strings.TrimSpace(config.Build.Target)
+		if config.Build.Dockerfile == "" {
+			config.Build = nil
+		}
+	}
+	return &config, warnings, nil
+}
+
+func stripJSONC(data []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(data); i++ {
+		ch := data[i]
+		if inString {
+			out.WriteByte(ch)
+			switch ch {
+			case '\\':
+				if i+1 < len(data) {
+					i++
+					out.WriteByte(data[i])
+				}
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case ch == '"':
+			inString = true
+			out.WriteByte(ch)
+		case ch == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+			if i < len(data) {
+				out.WriteByte('\n')
+			}
+		case ch == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+			out.WriteByte(' ')
+		default:
+			out.WriteByte(ch)
+		}
+	}
+
+	return removeTrailingCommas(out.Bytes())
+}
+
+func removeTrailingCommas(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	inString := false
+	for i := 0; i < len(data); i++ {
+		ch := data[i]
+		if inString {
+			out = append(out, ch)
+			switch ch {
+			case '\\':
+				if i+1 < len(data) {
+					i++
+					out = append(out, data[i])
+				}
+			case '"':
+				inString = false
+			}
+			continue
+		}
+		if ch == '"' {
+			inString = true
+		}
+		if ch == ',' {
+			next := i + 1
+			for next < len(data) && isJSONSpace(data[next]) {
+				next++
+			}
+			if next < len(data) && (data[next] == '}' || data[next] == ']') {
+				continue
+			}
+		}
+		out = append(out, ch)
+	}
+	return out
+}
+
+func isJSONSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+func (c *devcontainerConfig) remoteUser() (string, []string) {
+	if c == nil || c.RemoteUser == "" {
+		return "", nil
+	}
+	if !devcontainerUserPattern.MatchString(c.RemoteUser) {
+		return "", []string{fmt.Sprintf("devcontainer.json remoteUser %q is invalid and was ignored.", c.RemoteUser)}
+	}
+	return c.RemoteUser, nil
+}
+
+func (c *devcontainerConfig) resolve(ctx devcontainerContext) workspaceDevcontainer {
+	resolved := workspaceDevcontainer{
+		Env:       map[string]string{},
+		RemoteEnv: map[string]string{},
+	}
+	if c == nil {
+		return resolved
+	}
+	warn := func(format string, args ...any) {
+		resolved.Warnings = append(resolved.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	for _, key := range sortedMapKeys(c.ContainerEnv) {
+		value := ctx.expand(c.ContainerEnv[key])
+		if !isValidWorkspaceEnv(key, value) {
+			warn("devcontainer.json containerEnv %q is invalid and was ignored.", key)
+			continue
+		}
+		resolved.Env[key] = value
+	}
+
+	// remoteEnv may refer to the container's own environment, which is only
+	// known once it runs, so ${containerEnv:...} is left for exec time.
+	for _, key := range sortedMapKeys(c.RemoteEnv) {
+		if c.RemoteEnv[key] == nil {
+			continue
+		}
+		value := ctx.expand(*c.RemoteEnv[key])
+		if !isValidWorkspaceEnv(key, value) {
+			warn("devcontainer.json remoteEnv %q is invalid and was ignored.", key)
+			continue
+		}
+		resolved.RemoteEnv[key] = value
+	}
+
+	for _, raw := range c.Mounts {
+		mount, err := ctx.parseMount(raw)
+		if err != nil {
+			warn("devcontainer.json mount was ignored: %v.", err)
+			continue
+		}
+		resolved.Mounts = append(resolved.Mounts, mount)
+	}
+
+	for _, raw := range c.ForwardPorts {
+		port, ok := parseDevcontainerPort(raw)
+		if !ok {
+			warn("devcontainer.json forwardPorts entry %s is invalid and was ignored.", string(raw))
+			continue
+		}
+		resolved.ForwardPorts = append(resolved.ForwardPorts, port)
+	}
+
+	var err error
+	if resolved.PostCreate, err = parseDevcontainerCommand(c.PostCreateCommand, ctx); err != nil {
+		warn("devcontainer.json postCreateCommand was ignored: %v.", err)
+	}
+	if resolved.PostStart, err = parseDevcontainerCommand(c.PostStartCommand, ctx); err != nil {
+		warn("devcontainer.json postStartCommand was ignored: %v.", err)
+	}
+
+	return resolved
+}
+
+func isValidWorkspaceEnv(key string, value string) bool {
+	return len(key) <= maxWorkspaceEnvKeyLength &&
+		envKeyPattern.MatchString(key) &&
+		len(value) <= maxWorkspaceEnvValLength &&
+		!hasUnsafeControlChars(value)
+}
+
+func (ctx devcontainerContext) expand(value string) string {
+	return devcontainerVariablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		parts := devcontainerVariablePattern.FindStringSubmatch(match)
+		switch parts[1] {
+		case "localWorkspaceFolder":
+			return ctx.LocalFolder
+		case "localWorkspaceFolderBasename":
+			return path.Base(filepath.ToSlash(ctx.LocalFolder))
+		case "containerWorkspaceFolder":
+			return ctx.ContainerFolder
+		case "containerWorkspaceFolderBasename":
+			return path.Base(ctx.ContainerFolder)
+		case "localEnv":
+			return parts[3]
+		default:
+			return match
+		}
+	})
+}
+
+func (ctx devcontainerContext) parseMount(raw json.RawMessage) (string, error) {
+	var mount containerMountSpec
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		// --mount defaults to a volume when no type is given.
+		mount = parseMountArg(ctx.expand(value))
+		if !strings.Contains(value, "type=") {
+			mount.Type = "volume"
+		}
+	} else {
+		var object struct {
+			Type   string `json:"type"`
+			Source string `json:"source"`
+			Target string `json:"target"`
+		}
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return "", fmt.Errorf("%s is not a mount", string(raw))
+		}
+		mount = containerMountSpec{
+			Type:   object.Type,
+			Source: ctx.expand(object.Source),
+			Target: ctx.expand(object.Target),
+		}
+		if mount.Type == "" {
+			mount.Type = "volume"
+		}
+	}
+
+	target := strings.TrimSpace(mount.Target)
+	if !strings.HasPrefix(target, "/") || strings.ContainsAny(target, ",=") || hasUnsafeControlChars(target) {
+		return "", fmt.Errorf("target %q must be an absolute path", mount.Target)
+	}
+	target = path.Clean(target)
+
+	switch strings.ToLower(strings.TrimSpace(mount.Type)) {
+	case "volume":
+		source := invalidDirNameChars.ReplaceAllString(strings.TrimSpace(mount.Source), "-")
+		if strings.Trim(source, "-._") == "" {
+			return "", fmt.Errorf("volume for %s needs a source name", target)
+		}
+		name := "pocketpod-" + invalidDirNameChars.ReplaceAllString(ctx.UserID, "-") + "-" + source
+		arg := "type=volume,src=" + name + ",dst=" + target
+		if mount.ReadOnly {
+			arg += ",ro=true"
+		}
+		return arg, nil
+	case "tmpfs":
+		return "type=tmpfs,dst=" + target, nil
+	case "bind":
+		return "", fmt.Errorf("bind mounts are not allowed (%s)", target)
+	default:
+		return "", fmt.Errorf("mount type %q is not supported (%s)", mount.Type, target)
+	}
+}
+
+func parseDevcontainerPort(raw json.RawMessage) (string, bool) {
+	var number int
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return strconv.Itoa(number), number > 0 && number <= 65535
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", false
+	}
+	value = strings.TrimSpace(value)
+	if !devcontainerPortPattern.MatchString(value) {
+		return "", false
+	}
+	_, portText, found := strings.Cut(value, ":")
+	if !found {
+		portText = value
+	}
+	port, err := strconv.Atoi(portText)
+	return value, err == nil && port > 0 && port <= 65535
+}
+
+func parseDevcontainerCommand(raw json.RawMessage, ctx devcontainerContext) ([]devcontainerCommandStep, error) {
+	if len(bytes.TrimSpace(raw)) == 0 || string(bytes.TrimSpace(raw)) == "null" {
+		return nil, nil
+	}
+
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &named); err == nil {
+		steps := make([]devcontainerCommandStep, 0, len(named))
+		for _, name := range sortedMapKeys(named) {
+			cmd, err := parseDevcontainerCommandValue(named[name], ctx)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if len(cmd) > 0 {
+				steps = append(steps, devcontainerCommandStep{Name: name, Cmd: cmd})
+			}
+		}
+		return steps, nil
+	}
+
+	cmd, err := parseDevcontainerCommandValue(raw, ctx)
+	if err != nil || len(cmd) == 0 {
+		return nil, err
+	}
+	return []devcontainerCommandStep{{Cmd: cmd}}, nil
+}
+
+func parseDevcontainerCommandValue(raw json.RawMessage, ctx devcontainerContext) ([]string, error) {
+	var script string
+	if err := json.Unmarshal(raw, &script); err == nil {
+		script = strings.TrimSpace(ctx.expand(script))
+		if script == "" {
+			return nil, nil
+		}
+		return []string{"sh", "-c", script}, nil
+	}
+
+	var args []string
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, fmt.Errorf("expected a string, an array of strings or an object")
+	}
+	for i := range args {
+		args[i] = ctx.expand(args[i])
+	}
+	return args, nil
+}
+
+func applyDevcontainerRunArgs(args []string, payload *createWorkspacePayload, env map[string]string) []string {
+	var warnings []string
+	for i := 0; i < len(args); i++ {
+		arg := strings.TrimSpace(args[i])
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+
+		flag, value, hasValue := strings.Cut(arg, "=")
+		takesValue := true
+		switch flag {
+		case "--cpus", "--memory", "-m", "--pids-limit", "--shm-size", "--env", "-e":
+		default:
+			takesValue = false
+		}
+		if takesValue && !hasValue {
+			if i+1 >= len(args) {
+				warnings = append(warnings, fmt.Sprintf("devcontainer.json runArgs %q is missing a value.", flag))
+				continue
+			}
+			i++
+			value = args[i]
+		}
+		value = strings.TrimSpace(value)
+
+		switch flag {
+		case "--cpus":
+			cpus, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("devcontainer.json runArgs --cpus %q is invalid.", value))
+			} else if payload.CPUs == 0 {
+				payload.CPUs = cpus
+			}
+		case "--memory", "-m":
+			if payload.Memory == "" {
+				payload.Memory = value
+			}
+		case "--pids-limit":
+			pids, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				warnings = append(warnings, fmt.Sprintf("devcontainer.json runArgs --pids-limit %q is invalid.", value))
+			} else if payload.PidsLimit == 0 {
+				payload.PidsLimit = pids
+			}
+		case "--shm-size":
+			if payload.ShmSize == "" {
+				payload.ShmSize = value
+			}
+		case "--env", "-e":
+			key, envValue, _ := strings.Cut(value, "=")
+			if !isValidWorkspaceEnv(key, envValue) {
+				warnings = append(warnings, fmt.Sprintf("devcontainer.json runArgs env %q is invalid.", key))
+				continue
+			}
+			env[key] = envValue
+		default:
+			warnings = append(warnings, fmt.Sprintf("devcontainer.json runArgs %q is not supported and was ignored.", flag))
+		}
+	}
+	return warnings
+}
+
+func isPathWithin(root string, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func (d workspaceDevcontainer) labels() (map[string]string, error) {
+	labels := map[string]string{}
+	if len(d.RemoteEnv) > 0 {
+		encoded, err := json.Marshal(d.RemoteEnv)
+		if err != nil {
+			return nil, err
+		}
+		labels[labelWorkspaceRemoteEnv] = string(encoded)
+	}
+	if len(d.ForwardPorts) > 0 {
+		labels[labelWorkspaceForwardPorts] = strings.Join(d.ForwardPorts, ",")
+	}
+	if len(d.PostStart) > 0 {
+		encoded, err := json.Marshal(d.PostStart)
+		if err != nil {
+			return nil, err
+		}
+		labels[labelWorkspacePostStart] = string(encoded)
+	}
+	return labels, nil
+}
+
+func resolveRemoteEnv(labels map[string]string, containerEnv []string) map[string]string {
+	raw := strings.TrimSpace(labels[labelWorkspaceRemoteEnv])
+	if raw == "" {
+		return nil
+	}
+	var remoteEnv map[string]string
+	if err := json.Unmarshal([]byte(raw), &remoteEnv); err != nil {
+		return nil
+	}
+
+	current := make(map[string]string, len(containerEnv))
+	for _, entry := range containerEnv {
+		if key, value, ok := strings.Cut(entry, "="); ok {
+			current[key] = value
+		}
+	}
+	for key, value := range remoteEnv {
+		remoteEnv[key] = devcontainerVariablePattern.ReplaceAllStringFunc(value, func(match string) string {
+			parts := devcontainerVariablePattern.FindStringSubmatch(match)
+			if parts[1] != "containerEnv" {
+				return match
+			}
+			if envValue, ok := current[parts[2]]; ok {
+				return envValue
+			}
+			return parts[3]
+		})
+	}
+	return remoteEnv
+}
+
+type workspaceExecContext struct {
+	User string
+	Dir  string
+	Env  map[string]string
+}
+
+func resolveWorkspaceExecContext(rt ContainerRuntime, containerID string) (workspaceExecContext, error) {
+	inspected, err := rt.Inspect(context.Background(), containerID)
+	if err != nil {
+		return workspaceExecContext{}, err
+	}
+
+	execCtx := workspaceExecContext{
+		Dir: containerWorkspaceFolder(inspected.Config.Labels),
+		Env: resolveRemoteEnv(inspected.Config.Labels, inspected.Config.Env),
+	}
+	if execUser, err := resolveWorkspaceExecUser(rt, containerID, inspected.Config.Labels); err == nil {
+		execCtx.User = execUser.Name
+	}
+	return execCtx, nil
+}
+
+func containerWorkspaceFolder(labels map[string]string) string {
+	home := strings.TrimRight(strings.TrimSpace(labels[labelWorkspaceHome]), "/")
+	dir := strings.TrimSpace(labels[labelWorkspaceDir])
+	if home == "" || dir == "" {
+		return ""
+	}
+	return home + "/workspaces/" + dir
+}
+
+func (c workspaceExecContext) command(step devcontainerCommandStep) []string {
+	dir := c.Dir
+	if dir == "" {
+		dir = "."
+	}
+	cmd := []string{"env"}
+	for _, key := range sortedMapKeys(c.Env) {
+		cmd = append(cmd, key+"="+c.Env[key])
+	}
+	cmd = append(cmd, "sh", "-c", `cd "$0" || exit 1; exec "$@"`, dir)
+	return append(cmd, step.Cmd...)
+}
+
+func (s *podmanService) runDevcontainerCommands(containerID string, hook string, steps []devcontainerCommandStep) []string {
+	if len(steps) == 0 {
+		return nil
+	}
+	execCtx, err := resolveWorkspaceExecContext(s.runtime, containerID)
+	if err != nil {
+		return []string{fmt.Sprintf("%s could not run: %v", hook, err)}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), devcontainerLifecycleTimeout)
+	defer cancel()
+	for _, step := range steps {
+		output, err := s.runtime.Exec(ctx, containerID, containerExecOptions{
+			User: execCtx.User,
+			Cmd:  execCtx.command(step),
+		})
+		if err == nil {
+			continue
+		}
+		name := hook
+		if step.Name != "" {
+			name += " " + strconv.Quote(step.Name)
+		}
+		detail := latestNonEmptyLine(string(output))
+		if detail == "" {
+			detail = err.Error()
+		}
+		return []string{fmt.Sprintf("%s failed: %s", name, detail)}
+	}
+	return nil
+}
+
+func (s *podmanService) runPostStartCommand(containerID string, labels map[string]string) {
+	raw := strings.TrimSpace(labels[labelWorkspacePostStart])
+	if raw == "" {
+		return
+	}
+	var steps []devcontainerCommandStep
+	if err := json.Unmarshal([]byte(raw), &steps); err != nil {
+		return
+	}
+
+	for _, warning := range s.runDevcontainerCommands(containerID, "postStartCommand", steps) {
+		if s.app != nil {
+			s.app.Logger().Warn("Workspace lifecycle command failed", "container", containerID, "message", warning)
+		}
+	}
+}
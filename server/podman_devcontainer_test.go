@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const sampleDevcontainerJSON = `{
+	// Comments and trailing commas are allowed.
+	"name": "sample",
+	"image": "docker.io/library/node:20",
+	"containerEnv": {"API_URL": "http://example.com/*not-a-comment*/", "WORKDIR": "${containerWorkspaceFolder}"},
+	"remoteEnv": {"PATH": "${containerEnv:PATH}:/opt/bin", "SECRET": "${localEnv:HOME}", "UNSET": null},
+	"remoteUser": "node",
+	/* block
+	   comment */
+	"mounts": [
+		"source=${localWorkspaceFolderBasename}-node_modules,target=${containerWorkspaceFolder}/node_modules,type=volume",
+		{"source": "/var/run/docker.sock", "target": "/var/run/docker.sock", "type": "bind"},
+		{"target": "/tmp/cache", "type": "tmpfs"},
+	],
+	"forwardPorts": [3000, "db:5432", "nope"],
+	"runArgs": ["--cpus=2", "-e", "FROM_RUN_ARGS=1", "--privileged"],
+	"postCreateCommand": "npm install",
+	"postStartCommand": {"server": ["npm", "start"], "watch": "npm run watch"},
+	"features": {},
+}`
+
+func TestParseDevcontainerConfig(t *testing.T) {
+	config, warnings, err := parseDevcontainerConfig([]byte(sampleDevcontainerJSON))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if config.Image != "docker.io/library/node:20" || config.RemoteUser != "node" {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+	if config.ContainerEnv["API_URL"] != "http://example.com/*not-a-comment*/" {
+		t.Fatalf("expected comment markers inside strings to survive, got %q", config.ContainerEnv["API_URL"])
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], `"features"`) {
+		t.Fatalf("expected unsupported key warning, got %v", warnings)
+	}
+}
+
+func TestDevcontainerResolve(t *testing.T) {
+	config, _, err := parseDevcontainerConfig([]byte(sampleDevcontainerJSON))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	resolved := config.resolve(devcontainerContext{
+		UserID:          "user-1",
+		LocalFolder:     "/srv/workspaces/user-1/app",
+		ContainerFolder: "/home/node/workspaces/app",
+	})
+
+	if resolved.Env["WORKDIR"] != "/home/node/workspaces/app" {
+		t.Fatalf("expected containerWorkspaceFolder expanded, got %v", resolved.Env)
+	}
+	wantRemoteEnv := map[string]string{"PATH": "${containerEnv:PATH}:/opt/bin", "SECRET": ""}
+	if !reflect.DeepEqual(resolved.RemoteEnv, wantRemoteEnv) {
+		t.Fatalf("unexpected remoteEnv: %v", resolved.RemoteEnv)
+	}
+	wantMounts := []string{
+		"type=volume,src=pocketpod-user-1-app-node_modules,dst=/home/node/workspaces/app/node_modules",
+		"type=tmpfs,dst=/tmp/cache",
+	}
+	if !reflect.DeepEqual(resolved.Mounts, wantMounts) {
+		t.Fatalf("unexpected mounts: %v", resolved.Mounts)
+	}
+	if !reflect.DeepEqual(resolved.ForwardPorts, []string{"3000", "db:5432"}) {
+		t.Fatalf("unexpected ports: %v", resolved.ForwardPorts)
+	}
+	if len(resolved.PostCreate) != 1 || !reflect.DeepEqual(resolved.PostCreate[0].Cmd, []string{"sh", "-c", "npm install"}) {
+		t.Fatalf("unexpected postCreate: %+v", resolved.PostCreate)
+	}
+	if len(resolved.PostStart) != 2 || resolved.PostStart[0].Name != "server" || resolved.PostStart[1].Cmd[2] != "npm run watch" {
+		t.Fatalf("unexpected postStart: %+v", resolved.PostStart)
+	}
+
+	joined := strings.Join(resolved.Warnings, "\n")
+	if !strings.Contains(joined, "bind mounts are not allowed") || !strings.Contains(joined, `"nope"`) {
+		t.Fatalf("expected bind mount and port warnings, got %v", resolved.Warnings)
+	}
+}
+
+func TestApplyDevcontainerRunArgs(t *testing.T) {
+	payload := createWorkspacePayload{Memory: "1g"}
+	env := map[string]string{}
+
+	warnings := applyDevcontainerRunArgs([]string{"--cpus", "2", "--memory=4g", "-e", "A=1", "--env=B=2", "--privileged", "--cap-add=SYS_ADMIN"}, &payload, env)
+
+	if payload.CPUs != 2 || payload.Memory != "1g" {
+		t.Fatalf("expected runArgs cpus without overriding request memory, got %+v", payload)
+	}
+	if env["A"] != "1" || env["B"] != "2" {
+		t.Fatalf("unexpected env: %v", env)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "--privileged") || !strings.Contains(warnings[1], "--cap-add") {
+		t.Fatalf("unexpected warnings: %v", warnings)
+	}
+}
+
+func TestReadWorkspaceDevcontainerIgnoresLinksOutsideRepo(t *testing.T) {
+	outside := filepath.Join(t.TempDir(), "host.json")
+	if err := os.WriteFile(outside, []byte(`{"image": "alpine"}`), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	repoPath := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(repoPath, ".devcontainer.json")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	config, warnings := readWorkspaceDevcontainer(repoPath)
+	if config != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "outside the repository") {
+		t.Fatalf("expected linked config ignored, got %+v %v", config, warnings)
+	}
+}
+
+func TestResolveRemoteEnv(t *testing.T) {
+	encoded, _ := json.Marshal(map[string]string{"PATH": "${containerEnv:PATH}:/opt/bin", "EDITOR": "${containerEnv:EDITOR:vim}"})
+	labels := map[string]string{labelWorkspaceRemoteEnv: string(encoded)}
+
+	env := resolveRemoteEnv(labels, []string{"PATH=/usr/bin:/bin"})
+	if env["PATH"] != "/usr/bin:/bin:/opt/bin" || env["EDITOR"] != "vim" {
+		t.Fatalf("unexpected remote env: %v", env)
+	}
+	if resolveRemoteEnv(map[string]string{}, nil) != nil {
+		t.Fatal("expected no remote env without label")
+	}
+}
+
+func TestCreateWorkspaceAppliesDevcontainer(t *testing.T) {
+	originalWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir temp: %v", err)
+	}
+	originalRun := runWorkspaceCommand
+	originalLookPath := workspaceLookPath
+	t.Cleanup(func() {
+		_ = os.Chdir(originalWD)
+		runWorkspaceCommand = originalRun
+		workspaceLookPath = originalLookPath
+	})
+	runWorkspaceCommand = func(_ []string, name string, args ...string) ([]byte, error) {
+		if len(args) > 0 && args[0] == "clone" {
+			repoPath := args[len(args)-1]
+			if err := os.MkdirAll(filepath.Join(repoPath, ".devcontainer"), 0o755); err != nil {
+				return nil, err
+			}
+			return nil, os.WriteFile(filepath.Join(repoPath, ".devcontainer", "devcontainer.json"), []byte(sampleDevcontainerJSON), 0o644)
+		}
+		return nil, nil
+	}
+	workspaceLookPath = func(string) (string, error) { return "git", nil }
+	stubWorkspaceImages(t, []workspaceImage{
+		{Image: defaultWorkspaceImage, IsDefault: true},
+		{Image: "docker.io/library/node:20"},
+	})
+
+	rt := newFakeRuntime()
+	rt.passwd = "root:x:0:0:root:/root:/bin/bash\nnode:x:1000:1000::/home/node:/bin/bash"
+	svc := newTestPodmanService(rt)
+
+	result, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/app.git",
+		Env:     map[string]string{"FROM_RUN_ARGS": "request"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	t.Cleanup(func() {
+		svc.stopTunnelMonitor(rt.containers[0].ID)
+	})
+
+	spec := rt.created[len(rt.created)-1]
+	if spec.Image != "docker.io/library/node:20" || result.Image != spec.Image {
+		t.Fatalf("expected devcontainer image, got %q", spec.Image)
+	}
+	if spec.Labels[labelWorkspaceHome] != "/home/node" || spec.Labels[labelWorkspaceRemoteUser] != "node" {
+		t.Fatalf("expected remoteUser home, got %v", spec.Labels)
+	}
+	if spec.Env["API_URL"] == "" || spec.Env["FROM_RUN_ARGS"] != "request" {
+		t.Fatalf("expected merged env with request precedence, got %v", spec.Env)
+	}
+	if spec.Limits.CPUs != 2 {
+		t.Fatalf("expected runArgs cpus, got %+v", spec.Limits)
+	}
+	if len(spec.Mounts) != 4 {
+		t.Fatalf("expected workspace, vscode and devcontainer mounts, got %v", spec.Mounts)
+	}
+	if spec.Labels[labelWorkspacePostStart] == "" || spec.Labels[labelWorkspaceForwardPorts] != "3000,db:5432" {
+		t.Fatalf("expected lifecycle and port labels, got %v", spec.Labels)
+	}
+
+	var hooks []containerExecOptions
+	for _, opts := range rt.execs {
+		if len(opts.Cmd) > 0 && opts.Cmd[0] == "env" {
+			hooks = append(hooks, opts)
+		}
+	}
+	if len(hooks) != 3 {
+		t.Fatalf("expected postCreate and two postStart commands, got %+v", hooks)
+	}
+	if hooks[0].User != "node" || hooks[0].Cmd[len(hooks[0].Cmd)-1] != "npm install" {
+		t.Fatalf("unexpected postCreate exec: %+v", hooks[0])
+	}
+	if !slices.Contains(hooks[0].Cmd, "/home/node/workspaces/app") {
+		t.Fatalf("expected hook to run in workspace folder, got %v", hooks[0].Cmd)
+	}
+
+	joined := strings.Join(result.Warnings, "\n")
+	for _, want := range []string{`"features"`, "--privileged", "bind mounts"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected warning mentioning %s, got %v", want, result.Warnings)
+		}
+	}
+}
@@ -0,0 +1,623 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	workspaceExportVersion      = 1
+	workspaceExportManifestName = "manifest.json"
+	workspaceExportRepoPrefix   = "repo/"
+	workspaceExportImagePrefix  = "image/"
+
+	maxWorkspaceExportManifestSize = 1 << 20
+	defaultWorkspaceImportMaxSize  = 32 << 30
+
+	workspaceExportFailedMessage    = "Failed to export workspace."
+	workspaceImportFailedMessage    = "Failed to import workspace."
+	workspaceImportTooLargeMessage  = "Workspace archive is too large."
+	workspaceImportsDisabledMessage = "Workspace imports are disabled."
+)
+
+var (
+	errWorkspaceImportInvalid   = errors.New("invalid workspace archive")
+	errWorkspaceImportsDisabled = errors.New("workspace imports are disabled")
+)
+
+type workspaceExportManifest struct {
+	Version    int               `json:"version"`
+	Name       string            `json:"name"`
+	RepoURL    string            `json:"repoUrl"`
+	Ref        string            `json:"ref,omitempty"`
+	Dir        string            `json:"dir"`
+	Image      string            `json:"image"`
+	ExportedAt time.Time         `json:"exportedAt"`
+	Labels     map[string]string `json:"labels"`
+	Env        map[string]string `json:"env,omitempty"`
+	Mounts     []string          `json:"mounts,omitempty"`
+	Limits     containerLimits   `json:"limits"`
+}
+
+type workspaceExport struct {
+	manifest workspaceExportManifest
+	repoPath string
+	image    string
+}
+
+func resolveWorkspaceImportsEnabled() bool {
+	raw := strings.TrimSpace(strings.ToLower(os.Getenv("WORKSPACE_IMPORTS_ENABLED")))
+	return raw != "false" && raw != "0"
+}
+
+func resolveWorkspaceImportMaxSize() int64 {
+	raw := strings.TrimSpace(os.Getenv("WORKSPACE_IMPORT_MAX_SIZE"))
+	if raw == "" {
+		return defaultWorkspaceImportMaxSize
+	}
+	size, err := parseWorkspaceSize(raw)
+	if err != nil {
+		return defaultWorkspaceImportMaxSize
+	}
+	return size
+}
+
+func (s *podmanService) prepareWorkspaceExport(access containerAccess, containerID string) (*workspaceExport, error) {
+	if !s.runtime.Available() {
+		return nil, errPodmanUnavailable
+	}
+	inspected, err := s.authorizeContainer(access, containerID)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := newWorkspaceRebuild(inspected)
+	if err != nil {
+		return nil, err
+	}
+	repoPath, err := resolveWorkspaceRepoPath(workspace.Owner, workspace.Labels[labelWorkspaceDir])
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(repoPath); err != nil || !info.IsDir() {
+		return nil, errWorkspaceRepoMissing
+	}
+
+	labels := map[string]string{}
+	for key, value := range workspace.Labels {
+		if strings.HasPrefix(key, labelPrefix) {
+			labels[key] = value
+		}
+	}
+	for _, key := range []string{labelWorkspaceOwner, labelTunnelSession, labelWorkspaceSnapshot} {
+		delete(labels, key)
+	}
+
+	volumePrefix := "pocketpod-" + invalidDirNameChars.ReplaceAllString(workspace.Owner, "-") + "-"
+	mounts := make([]string, 0, len(workspace.Mounts))
+	for _, arg := range workspace.Mounts {
+		mount := parseMountArg(arg)
+		if mount.Type == "volume" {
+			arg = "type=volume,src=" + strings.TrimPrefix(mount.Source, volumePrefix) + ",dst=" + mount.Target
+			if mount.ReadOnly {
+				arg += ",ro=true"
+			}
+		}
+		mounts = append(mounts, arg)
+	}
+
+	export := &workspaceExport{
+		manifest: workspaceExportManifest{
+			Version:    workspaceExportVersion,
+			Name:       workspace.Name,
+			RepoURL:    labels[labelWorkspaceRepo],
+			Ref:        labels[labelWorkspaceRef],
+			Dir:        labels[labelWorkspaceDir],
+			Image:      workspace.Image,
+			ExportedAt: time.Now().UTC(),
+			Labels:     labels,
+			Env:        workspace.Env,
+			Mounts:     mounts,
+			Limits:     containerLimitsFromLabels(labels),
+		},
+		repoPath: repoPath,
+		image:    fmt.Sprintf("localhost/pocketpod-exports/%s:%s", workspaceImageOwner(workspace.Owner), generateSessionID()),
+	}
+	if err := s.runtime.Commit(context.Background(), inspected.ID, export.image); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+func (s *podmanService) writeWorkspaceExport(ctx context.Context, export *workspaceExport, w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(export.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     workspaceExportManifestName,
+		Typeflag: tar.TypeReg,
+		Mode:     0o644,
+		Size:     int64(len(manifest)),
+		ModTime:  export.manifest.ExportedAt,
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	if err := addDirectoryToTar(tw, export.repoPath, workspaceExportRepoPrefix, nil); err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(s.runtime.SaveImage(ctx, export.image, writer))
+	}()
+	defer reader.Close()
+
+	image := tar.NewReader(reader)
+	for {
+		header, err := image.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		header.Name = workspaceExportImagePrefix + header.Name
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, image); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+func (s *podmanService) importWorkspace(ctx context.Context, userID string, name string, r io.Reader) (*workspaceJob, error) {
+	if !resolveWorkspaceImportsEnabled() {
+		return nil, errWorkspaceImportsDisabled
+	}
+	if !s.runtime.Available() {
+		return nil, errPodmanUnavailable
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a gzip stream", errWorkspaceImportInvalid)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	manifest, err := readWorkspaceExportManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = manifest.Name
+	}
+	snapshot, limits, err := newImportedWorkspaceSnapshot(userID, name, manifest)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range []string{manifest.Image, snapshot.BaseImage} {
+		if err := s.checkImportedWorkspaceImage(image); err != nil {
+			return nil, err
+		}
+	}
+	// Both checks run again once the upload is read; checking now avoids
+	// reading gigabytes only to reject them.
+	if err := checkWorkspaceSnapshotLimit(userID); err != nil {
+		return nil, err
+	}
+	if err := s.checkWorkspaceAdmission(userID, limits); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(workspaceSnapshotsPath(userID), 0o755); err != nil {
+		return nil, err
+	}
+	tarballPath := workspaceSnapshotTarballPath(userID, snapshot.ID)
+	err = s.unpackWorkspaceImport(ctx, tr, tarballPath, snapshot.Image)
+	if err == nil {
+		err = checkWorkspaceSnapshotLimit(userID)
+	}
+	if err == nil {
+		if info, statErr := os.Stat(tarballPath); statErr == nil {
+			snapshot.SizeBytes = info.Size()
+		}
+		err = writeWorkspaceSnapshotRecord(snapshot)
+	}
+	if err != nil {
+		_ = os.Remove(tarballPath)
+		_ = s.runtime.RemoveImage(context.Background(), snapshot.Image)
+		return nil, err
+	}
+
+	return s.startWorkspaceFromSnapshot(userID, snapshot.ID, createWorkspaceFromSnapshotPayload{Name: name})
+}
+
+func (s *podmanService) checkImportedWorkspaceImage(image string) error {
+	if resolveWorkspaceBuildsEnabled() && strings.HasPrefix(image, workspaceBuildImagePrefix) {
+		return nil
+	}
+	if image == "" {
+		return errWorkspaceImageNotAllowed
+	}
+	_, err := s.resolveWorkspaceImage(image)
+	return err
+}
+
+func readWorkspaceExportManifest(tr *tar.Reader) (*workspaceExportManifest, error) {
+	header, err := tr.Next()
+	if err != nil || header.Name != workspaceExportManifestName {
+		return nil, fmt.Errorf("%w: %s must come first", errWorkspaceImportInvalid, workspaceExportManifestName)
+	}
+
+	var manifest workspaceExportManifest
+	if err := json.NewDecoder(io.LimitReader(tr, maxWorkspaceExportManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: unreadable %s", errWorkspaceImportInvalid, workspaceExportManifestName)
+	}
+	if manifest.Version != workspaceExportVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", errWorkspaceImportInvalid, manifest.Version)
+	}
+	return &manifest, nil
+}
+
+func newImportedWorkspaceSnapshot(userID string, name string, manifest *workspaceExportManifest) (*workspaceSnapshot, containerLimits, error) {
+	labels := map[string]string{}
+	for key, value := range manifest.Labels {
+		if strings.HasPrefix(key, labelPrefix) {
+			labels[key] = value
+		}
+	}
+	for _, key := range []string{labelTunnelSession, labelAdopted, labelWorkspaceSnapshot, labelWorkspaceBuild} {
+		delete(labels, key)
+	}
+	labels[labelWorkspaceOwner] = userID
+	home := labels[labelWorkspaceHome]
+	if labels[labelWorkspaceRepo] == "" || labels[labelWorkspaceDir] == "" || !strings.HasPrefix(home, "/") || strings.Contains(home, ",") || hasUnsafeControlChars(home) {
+		return nil, containerLimits{}, fmt.Errorf("%w: missing workspace labels", errWorkspaceImportInvalid)
+	}
+
+	payload := createWorkspacePayload{
+		RepoURL:   labels[labelWorkspaceRepo],
+		Name:      name,
+		Ref:       labels[labelWorkspaceRef],
+		Env:       manifest.Env,
+		CPUs:      manifest.Limits.CPUs,
+		PidsLimit: manifest.Limits.PidsLimit,
+	}
+	if manifest.Limits.Memory > 0 {
+		payload.Memory = strconv.FormatInt(manifest.Limits.Memory, 10)
+	}
+	if manifest.Limits.ShmSize > 0 {
+		payload.ShmSize = strconv.FormatInt(manifest.Limits.ShmSize, 10)
+	}
+	if err := validateCreateWorkspacePayload(&payload); err != nil {
+		return nil, containerLimits{}, fmt.Errorf("%w: %v", errWorkspaceImportInvalid, err)
+	}
+	for _, key := range []string{labelWorkspaceCPUs, labelWorkspaceMemory, labelWorkspacePidsLimit, labelWorkspaceShmSize} {
+		delete(labels, key)
+	}
+	for key, value := range payload.limits.labels() {
+		labels[key] = value
+	}
+
+	mountContext := devcontainerContext{UserID: userID}
+	mounts := make([]string, 0, len(manifest.Mounts))
+	for _, value := range manifest.Mounts {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, containerLimits{}, err
+		}
+		arg, err := mountContext.parseMount(raw)
+		if err != nil {
+			return nil, containerLimits{}, fmt.Errorf("%w: %v", errWorkspaceImportInvalid, err)
+		}
+		mounts = append(mounts, arg)
+	}
+
+	id := generateSessionID()
+	return &workspaceSnapshot{
+		ID:        id,
+		Owner:     userID,
+		Workspace: manifest.Name,
+		RepoURL:   payload.RepoURL,
+		Ref:       payload.Ref,
+		Dir:       labels[labelWorkspaceDir],
+		Image:     workspaceSnapshotImage(userID, id),
+		BaseImage: labels[labelWorkspaceImage],
+		CreatedAt: time.Now().UTC(),
+		Labels:    labels,
+		Env:       payload.Env,
+		Mounts:    mounts,
+		Imported:  true,
+	}, payload.limits, nil
+}
+
+func (s *podmanService) unpackWorkspaceImport(ctx context.Context, tr *tar.Reader, tarballPath string, imageRef string) error {
+	file, err := os.OpenFile(tarballPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	repoGz := gzip.NewWriter(file)
+	repo := tar.NewWriter(repoGz)
+
+	var image *workspaceImageLoad
+	defer func() {
+		if image != nil {
+			image.abort()
+		}
+	}()
+	tagged := false
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", errWorkspaceImportInvalid, err)
+		}
+
+		if name, ok := strings.CutPrefix(header.Name, workspaceExportRepoPrefix); ok {
+			if name == "" {
+				continue
+			}
+			header.Name = name
+			if err := repo.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := io.Copy(repo, tr); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, ok := strings.CutPrefix(header.Name, workspaceExportImagePrefix)
+		if !ok {
+			return fmt.Errorf("%w: unexpected entry %q", errWorkspaceImportInvalid, header.Name)
+		}
+		if image == nil {
+			image = s.startWorkspaceImageLoad(ctx)
+		}
+		switch name {
+		case "", "repositories", "index.json", "oci-layout":
+			// Only the tag written into manifest.json may name the image.
+			continue
+		case "manifest.json":
+			manifest, err := retagDockerArchiveManifest(tr, imageRef)
+			if err != nil {
+				return err
+			}
+			if err := image.tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(manifest))}); err != nil {
+				return err
+			}
+			if _, err := image.tw.Write(manifest); err != nil {
+				return err
+			}
+			tagged = true
+		default:
+			header.Name = name
+			if err := image.tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := io.Copy(image.tw, tr); err != nil {
+				return err
+			}
+		}
+	}
+	if !tagged {
+		return fmt.Errorf("%w: no image", errWorkspaceImportInvalid)
+	}
+
+	loaded := image
+	image = nil
+	if err := loaded.finish(); err != nil {
+		return err
+	}
+	if err := repo.Close(); err != nil {
+		return err
+	}
+	if err := repoGz.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func retagDockerArchiveManifest(r io.Reader, imageRef string) ([]byte, error) {
+	var manifest []map[string]json.RawMessage
+	if err := json.NewDecoder(io.LimitReader(r, maxWorkspaceExportManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: unreadable image manifest", errWorkspaceImportInvalid)
+	}
+	if len(manifest) != 1 {
+		return nil, fmt.Errorf("%w: the image archive must hold one image", errWorkspaceImportInvalid)
+	}
+	tags, err := json.Marshal([]string{imageRef})
+	if err != nil {
+		return nil, err
+	}
+	manifest[0]["RepoTags"] = tags
+	return json.Marshal(manifest)
+}
+
+type workspaceImageLoad struct {
+	writer *io.PipeWriter
+	tw     *tar.Writer
+	done   chan error
+}
+
+func (s *podmanService) startWorkspaceImageLoad(ctx context.Context) *workspaceImageLoad {
+	reader, writer := io.Pipe()
+	load := &workspaceImageLoad{writer: writer, tw: tar.NewWriter(writer), done: make(chan error, 1)}
+	go func() {
+		err := s.runtime.LoadImage(ctx, reader)
+		// Writes fail once the runtime stops reading instead of blocking.
+		reader.CloseWithError(err)
+		load.done <- err
+	}()
+	return load
+}
+
+func (l *workspaceImageLoad) finish() error {
+	err := l.tw.Close()
+	l.writer.CloseWithError(err)
+	if loadErr := <-l.done; loadErr != nil {
+		return loadErr
+	}
+	return err
+}
+
+func (l *workspaceImageLoad) abort() {
+	l.writer.CloseWithError(errWorkspaceImportInvalid)
+	<-l.done
+}
+
+func registerWorkspaceExportRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/containers/{id}/export", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		export, err := svc.prepareWorkspaceExport(newContainerAccess(re.Auth), containerID)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
+			case errors.Is(err, errWorkspaceNotRebuildable):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": workspaceNotRebuildableMessage,
+				})
+			case errors.Is(err, errWorkspaceRepoMissing):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": workspaceRepoMissingMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": workspaceExportFailedMessage,
+				})
+			}
+		}
+		defer func() {
+			_ = svc.runtime.RemoveImage(context.Background(), export.image)
+		}()
+
+		re.Response.Header().Set("Content-Type", "application/gzip")
+		re.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.manifest.Name+".tar.gz"))
+		re.Response.WriteHeader(http.StatusOK)
+		// The status is sent, so a failure can only cut the download short.
+		if err := svc.writeWorkspaceExport(re.Request.Context(), export, re.Response); err != nil && svc.app != nil {
+			svc.app.Logger().Warn("Workspace export failed", "container", containerID, "error", err)
+		}
+		return nil
+	})
+
+	rtr.POST("/podman/workspaces/import", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		name := strings.TrimSpace(re.Request.URL.Query().Get("name"))
+		if err := validateCreateWorkspaceFromSnapshotPayload(&createWorkspaceFromSnapshotPayload{Name: name}); err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": err.Error(),
+			})
+		}
+
+		// The router keeps a copy of everything read from a request body so
+		// it can be read again; read the raw body so an upload is never held
+		// in memory.
+		var body io.ReadCloser = re.Request.Body
+		if rereadable, ok := body.(*router.RereadableReadCloser); ok {
+			body = rereadable.ReadCloser
+		}
+		body = http.MaxBytesReader(re.Response, body, resolveWorkspaceImportMaxSize())
+
+		job, err := svc.importWorkspace(re.Request.Context(), re.Auth.Id, name, body)
+		if err != nil {
+			var quotaErr *workspaceQuotaError
+			var maxBytesErr *http.MaxBytesError
+			switch {
+			case errors.As(err, &quotaErr):
+				return re.JSON(quotaErrorStatus(quotaErr), quotaErr.response())
+			case errors.As(err, &maxBytesErr):
+				return re.JSON(http.StatusRequestEntityTooLarge, map[string]string{
+					"message": workspaceImportTooLargeMessage,
+				})
+			case errors.Is(err, errWorkspaceImportsDisabled):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": workspaceImportsDisabledMessage,
+				})
+			case errors.Is(err, errWorkspaceImportInvalid):
+				return re.JSON(http.StatusBadRequest, map[string]string{
+					"message": err.Error(),
+				})
+			case errors.Is(err, errWorkspaceSnapshotLimit):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": workspaceSnapshotLimitMessage,
+				})
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			}
+			status, message := workspaceCreateErrorStatus(err)
+			if status == http.StatusInternalServerError {
+				message = workspaceImportFailedMessage
+			}
+			return re.JSON(status, map[string]string{
+				"message": message,
+			})
+		}
+
+		re.Response.Header().Set("Location", "/podman/workspaces/jobs/"+job.ID)
+		return re.JSON(http.StatusAccepted, job)
+	}).Unbind(apis.DefaultBodyLimitMiddlewareId)
+}
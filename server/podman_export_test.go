@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExportAndImportWorkspace(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	old := createRebuildableWorkspace(t, rt, svc)
+	writeWorkspaceRepoFiles(t, filepath.Join("volumes", "user-1", "workspaces", old.Labels[labelWorkspaceDir]))
+
+	if _, err := svc.prepareWorkspaceExport(containerAccess{UserID: "user-2"}, old.ID); !errors.Is(err, errContainerForbidden) {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+	export, err := svc.prepareWorkspaceExport(containerAccess{UserID: "user-1"}, old.ID)
+	if err != nil {
+		t.Fatalf("prepare export: %v", err)
+	}
+	var archive bytes.Buffer
+	if err := svc.writeWorkspaceExport(context.Background(), export, &archive); err != nil {
+		t.Fatalf("write export: %v", err)
+	}
+	if !reflect.DeepEqual(rt.commits, []string{export.image}) {
+		t.Fatalf("expected the container committed for export, got %v", rt.commits)
+	}
+	if _, ok := export.manifest.Labels[labelWorkspaceOwner]; ok || export.manifest.Env["APP_ENV"] != "dev" {
+		t.Fatalf("unexpected manifest %+v", export.manifest)
+	}
+
+	rt.pulls, rt.pullPolicies = nil, nil
+	started, err := svc.importWorkspace(context.Background(), "user-1", "ws-moved", &archive)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	job := waitForWorkspaceJob(t, svc, started.ID)
+	if job.Status != workspaceJobStatusSucceeded {
+		t.Fatalf("expected succeeded import job, got %+v", job)
+	}
+
+	snapshots, err := listWorkspaceSnapshots("user-1")
+	if err != nil || len(snapshots) != 1 || !snapshots[0].Imported || snapshots[0].Workspace != "ws-one" {
+		t.Fatalf("expected one imported snapshot, got %+v (%v)", snapshots, err)
+	}
+	if !reflect.DeepEqual(rt.loads, []string{snapshots[0].Image}) {
+		t.Fatalf("expected the image loaded only under the snapshot tag, got %v", rt.loads)
+	}
+	spec := rt.created[len(rt.created)-1]
+	if spec.Name != "ws-moved" || spec.Image != snapshots[0].Image || spec.Env["APP_ENV"] != "dev" || spec.Labels[labelWorkspaceOwner] != "user-1" {
+		t.Fatalf("expected ws-moved on the imported image, got %+v", spec)
+	}
+	repoPath := filepath.Join("volumes", "user-1", "workspaces", "ws-moved")
+	if head, err := os.ReadFile(filepath.Join(repoPath, ".git", "HEAD")); err != nil || string(head) != "ref: refs/heads/main\n" {
+		t.Fatalf("expected repository imported, got %q (%v)", head, err)
+	}
+	if link, err := os.Readlink(filepath.Join(repoPath, "start")); err != nil || link != "run.sh" {
+		t.Fatalf("expected symlink imported, got %q (%v)", link, err)
+	}
+}
+
+func TestImportWorkspaceRejectsInvalidArchives(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+
+	if _, err := svc.importWorkspace(context.Background(), "user-1", "", bytes.NewReader([]byte("not an archive"))); !errors.Is(err, errWorkspaceImportInvalid) {
+		t.Fatalf("expected invalid archive, got %v", err)
+	}
+
+	rt.containers = []podmanContainer{{ID: "abc123", Name: "ws-one", Image: "alpine", Labels: map[string]string{
+		labelWorkspaceOwner: "user-1",
+		labelWorkspaceRepo:  "https://github.com/org/repo.git",
+		labelWorkspaceDir:   "repo",
+		labelWorkspaceHome:  "/home/ubuntu",
+		labelWorkspaceImage: defaultWorkspaceImage,
+	}}}
+	if err := os.MkdirAll(filepath.Join("volumes", "user-1", "workspaces", "repo"), 0o755); err != nil {
+		t.Fatalf("mkdir repo: %v", err)
+	}
+	export, err := svc.prepareWorkspaceExport(containerAccess{UserID: "user-1"}, "abc123")
+	if err != nil {
+		t.Fatalf("prepare export: %v", err)
+	}
+	// Without the image the archive holds only the manifest and repository.
+	var archive bytes.Buffer
+	delete(rt.images, export.image)
+	if err := svc.writeWorkspaceExport(context.Background(), export, &archive); err == nil {
+		t.Fatal("expected export without an image to fail")
+	}
+	if _, err := svc.importWorkspace(context.Background(), "user-1", "", &archive); !errors.Is(err, errWorkspaceImportInvalid) {
+		t.Fatalf("expected truncated archive to be invalid, got %v", err)
+	}
+	if snapshots, _ := listWorkspaceSnapshots("user-1"); len(snapshots) != 0 {
+		t.Fatalf("expected no snapshot left behind, got %+v", snapshots)
+	}
+	if entries, _ := os.ReadDir(workspaceSnapshotsPath("user-1")); len(entries) != 0 {
+		t.Fatalf("expected no files left behind, got %v", entries)
+	}
+
+	rt.containers[0].Labels[labelWorkspaceImage] = "docker.io/someone/else:latest"
+	export, err = svc.prepareWorkspaceExport(containerAccess{UserID: "user-1"}, "abc123")
+	if err != nil {
+		t.Fatalf("prepare export: %v", err)
+	}
+	archive.Reset()
+	if err := svc.writeWorkspaceExport(context.Background(), export, &archive); err != nil {
+		t.Fatalf("write export: %v", err)
+	}
+	if _, err := svc.importWorkspace(context.Background(), "user-1", "", bytes.NewReader(archive.Bytes())); !errors.Is(err, errWorkspaceImageNotAllowed) {
+		t.Fatalf("expected image outside the allowlist to be rejected, got %v", err)
+	}
+	if len(rt.loads) != 0 {
+		t.Fatalf("expected no image loaded, got %v", rt.loads)
+	}
+
+	t.Setenv("WORKSPACE_IMPORTS_ENABLED", "false")
+	if _, err := svc.importWorkspace(context.Background(), "user-1", "", bytes.NewReader(archive.Bytes())); !errors.Is(err, errWorkspaceImportsDisabled) {
+		t.Fatalf("expected imports disabled, got %v", err)
+	}
+}
+
+func TestNewImportedWorkspaceSnapshotScopesToImporter(t *testing.T) {
+	manifest := &workspaceExportManifest{
+		Version: workspaceExportVersion,
+		Name:    "ws-one",
+		Labels: map[string]string{
+			labelWorkspaceOwner:    "user-1",
+			labelWorkspaceRepo:     "https://github.com/org/repo.git",
+			labelWorkspaceDir:      "repo",
+			labelWorkspaceHome:     "/home/ubuntu",
+			labelWorkspaceSnapshot: "123-abcdef12",
+			labelTunnelSession:     "123-abcdef12",
+			"com.example.other":    "dropped",
+		},
+		Mounts: []string{"type=volume,src=cache,dst=/cache", "type=tmpfs,dst=/scratch"},
+	}
+
+	snapshot, _, err := newImportedWorkspaceSnapshot("user-2", "ws-one", manifest)
+	if err != nil {
+		t.Fatalf("new snapshot: %v", err)
+	}
+	want := map[string]string{
+		labelWorkspaceOwner: "user-2",
+		labelWorkspaceRepo:  "https://github.com/org/repo.git",
+		labelWorkspaceDir:   "repo",
+		labelWorkspaceHome:  "/home/ubuntu",
+	}
+	if snapshot.Owner != "user-2" || !reflect.DeepEqual(snapshot.Labels, want) {
+		t.Fatalf("expected labels %v for user-2, got %+v", want, snapshot)
+	}
+	if want := []string{"type=volume,src=pocketpod-user-2-cache,dst=/cache", "type=tmpfs,dst=/scratch"}; !reflect.DeepEqual(snapshot.Mounts, want) {
+		t.Fatalf("expected mounts %v, got %v", want, snapshot.Mounts)
+	}
+
+	manifest.Mounts = []string{"type=bind,src=/etc,dst=/host-etc"}
+	if _, _, err := newImportedWorkspaceSnapshot("user-2", "ws-one", manifest); !errors.Is(err, errWorkspaceImportInvalid) {
+		t.Fatalf("expected bind mount rejected, got %v", err)
+	}
+
+	t.Setenv("WORKSPACE_MAX_CPUS", "2")
+	manifest.Mounts = nil
+	manifest.Limits = containerLimits{CPUs: 4}
+	if _, _, err := newImportedWorkspaceSnapshot("user-2", "ws-one", manifest); !errors.Is(err, errWorkspaceImportInvalid) {
+		t.Fatalf("expected limits above the maximum rejected, got %v", err)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+const (
+	workspaceIdentityKeyName = "id_ed25519"
+
+	maxWorkspaceIdentityNameLength = 200
+
+	workspaceIdentityFailedMessage = "Failed to load workspace identity."
+)
+
+type workspaceIdentity struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	PublicKey string `json:"publicKey,omitempty"`
+
+	privateKey string
+}
+
+func (i workspaceIdentity) isZero() bool {
+	return i.Name == "" && i.Email == "" && i.privateKey == ""
+}
+
+type updateWorkspaceIdentityPayload struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+var lookupWorkspaceIdentity = func(app core.App, userID string) (workspaceIdentity, error) {
+	if app == nil {
+		return workspaceIdentity{}, nil
+	}
+	record, err := app.FindRecordById(CollectionUsers, userID)
+	if err != nil {
+		return workspaceIdentity{}, err
+	}
+
+	key, err := resolveGitCredentialsKey()
+	if errors.Is(err, errGitCredentialsDisabled) {
+		identity := workspaceIdentityFromRecord(record)
+		identity.PublicKey = ""
+		return identity, nil
+	}
+	if err != nil {
+		return workspaceIdentity{}, err
+	}
+	if record.GetString("ssh_private_key") == "" {
+		if err := setWorkspaceSSHKey(app, record, key); err != nil {
+			return workspaceIdentity{}, err
+		}
+	}
+
+	identity := workspaceIdentityFromRecord(record)
+	privateKey, err := security.Decrypt(record.GetString("ssh_private_key"), key)
+	if err != nil {
+		return workspaceIdentity{}, fmt.Errorf("decrypt ssh key: %w", err)
+	}
+	identity.privateKey = string(privateKey)
+	return identity, nil
+}
+
+func workspaceIdentityFromRecord(record *core.Record) workspaceIdentity {
+	identity := workspaceIdentity{
+		Name:      strings.TrimSpace(record.GetString("git_name")),
+		Email:     strings.TrimSpace(record.GetString("git_email")),
+		PublicKey: record.GetString("ssh_public_key"),
+	}
+	if identity.Name == "" {
+		identity.Name = strings.TrimSpace(record.GetString("display_name"))
+	}
+	if identity.Email == "" {
+		identity.Email = record.Email()
+	}
+	return identity
+}
+
+func validateUpdateWorkspaceIdentityPayload(payload *updateWorkspaceIdentityPayload) error {
+	payload.Name = strings.TrimSpace(payload.Name)
+	payload.Email = strings.TrimSpace(payload.Email)
+
+	if len(payload.Name) > maxWorkspaceIdentityNameLength || hasUnsafeControlChars(payload.Name) {
+		return errors.New("name is invalid")
+	}
+	if payload.Email != "" {
+		address, err := mail.ParseAddress(payload.Email)
+		if err != nil || address.Address != payload.Email {
+			return errors.New("email is invalid")
+		}
+	}
+	return nil
+}
+
+func updateWorkspaceIdentity(app core.App, userID string, payload updateWorkspaceIdentityPayload) (workspaceIdentity, error) {
+	record, err := app.FindRecordById(CollectionUsers, userID)
+	if err != nil {
+		return workspaceIdentity{}, err
+	}
+	record.Set("git_name", payload.Name)
+	record.Set("git_email", payload.Email)
+	if err := app.Save(record); err != nil {
+		return workspaceIdentity{}, err
+	}
+	return workspaceIdentityFromRecord(record), nil
+}
+
+func rotateWorkspaceSSHKey(app core.App, userID string) (workspaceIdentity, error) {
+	key, err := resolveGitCredentialsKey()
+	if err != nil {
+		return workspaceIdentity{}, err
+	}
+	record, err := app.FindRecordById(CollectionUsers, userID)
+	if err != nil {
+		return workspaceIdentity{}, err
+	}
+	if err := setWorkspaceSSHKey(app, record, key); err != nil {
+		return workspaceIdentity{}, err
+	}
+	return workspaceIdentityFromRecord(record), nil
+}
+
+func setWorkspaceSSHKey(app core.App, record *core.Record, key string) error {
+	privateKey, publicKey, err := generateGitDeployKey("pocketpod-" + record.Id)
+	if err != nil {
+		return err
+	}
+	encrypted, err := security.Encrypt([]byte(privateKey), key)
+	if err != nil {
+		return err
+	}
+	record.Set("ssh_public_key", publicKey)
+	record.Set("ssh_private_key", encrypted)
+	return app.Save(record)
+}
+
+func (s *podmanService) installWorkspaceIdentity(containerID string, identity workspaceIdentity) []string {
+	var labels map[string]string
+	if inspected, err := s.runtime.Inspect(context.Background(), containerID); err == nil {
+		labels = inspected.Config.Labels
+	}
+	execUser, err := resolveWorkspaceExecUser(s.runtime, containerID, labels)
+	if err != nil {
+		execUser = tunnelExecUser{Name: "root", Home: defaultWorkspaceHome}
+	}
+
+	output, err := s.runtime.Exec(context.Background(), containerID, containerExecOptions{
+		User: "root",
+		Cmd:  []string{"sh", "-c", buildWorkspaceIdentityCommand(execUser, identity)},
+	})
+	if err != nil {
+		detail := latestNonEmptyLine(string(output))
+		if detail == "" {
+			detail = err.Error()
+		}
+		return []string{fmt.Sprintf("Git identity could not be installed: %s", detail)}
+	}
+	return nil
+}
+
+func buildWorkspaceIdentityCommand(execUser tunnelExecUser, identity workspaceIdentity) string {
+	lines := []string{
+		"set -e",
+		"home=" + shellSingleQuote(execUser.Home),
+		"user=" + shellSingleQuote(execUser.Name),
+		`group=$(id -g "$user")`,
+	}
+	if identity.privateKey != "" {
+		privateKeyPath := `"$home/.ssh/` + workspaceIdentityKeyName + `"`
+		publicKeyPath := `"$home/.ssh/` + workspaceIdentityKeyName + `.pub"`
+		lines = append(lines,
+			`mkdir -p "$home/.ssh"`,
+			`chmod 700 "$home/.ssh"`,
+			"(umask 077 && printf '%s\\n' "+shellSingleQuote(strings.TrimSpace(identity.privateKey))+" > "+privateKeyPath+")",
+			"printf '%s\\n' "+shellSingleQuote(strings.TrimSpace(identity.PublicKey))+" > "+publicKeyPath,
+			"chmod 600 "+privateKeyPath,
+			"chmod 644 "+publicKeyPath,
+			`chown -R "$user:$group" "$home/.ssh"`,
+		)
+	}
+	if identity.Name != "" || identity.Email != "" {
+		lines = append(lines, `command -v git >/dev/null 2>&1 || { echo "git is not installed in the image" >&2; exit 1; }`)
+		if identity.Name != "" {
+			lines = append(lines, `git config --file "$home/.gitconfig" user.name `+shellSingleQuote(identity.Name))
+		}
+		if identity.Email != "" {
+			lines = append(lines, `git config --file "$home/.gitconfig" user.email `+shellSingleQuote(identity.Email))
+		}
+		lines = append(lines, `chown "$user:$group" "$home/.gitconfig"`)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func registerWorkspaceIdentityRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/workspaces/identity", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		return re.JSON(http.StatusOK, workspaceIdentityFromRecord(re.Auth))
+	})
+
+	rtr.PUT("/podman/workspaces/identity", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		var payload updateWorkspaceIdentityPayload
+		if err := re.BindBody(&payload); err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Invalid identity payload.",
+			})
+		}
+		if err := validateUpdateWorkspaceIdentityPayload(&payload); err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": err.Error(),
+			})
+		}
+
+		identity, err := updateWorkspaceIdentity(svc.app, re.Auth.Id, payload)
+		if err != nil {
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": workspaceIdentityFailedMessage,
+			})
+		}
+
+		return re.JSON(http.StatusOK, identity)
+	})
+
+	rtr.POST("/podman/workspaces/identity/ssh-key", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		identity, err := rotateWorkspaceSSHKey(svc.app, re.Auth.Id)
+		if err != nil {
+			if errors.Is(err, errGitCredentialsDisabled) {
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": gitCredentialsDisabledMessage,
+				})
+			}
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": workspaceIdentityFailedMessage,
+			})
+		}
+
+		return re.JSON(http.StatusOK, identity)
+	})
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func stubWorkspaceIdentity(t *testing.T, identity workspaceIdentity, err error) {
+	t.Helper()
+	original := lookupWorkspaceIdentity
+	t.Cleanup(func() {
+		lookupWorkspaceIdentity = original
+	})
+	lookupWorkspaceIdentity = func(core.App, string) (workspaceIdentity, error) {
+		return identity, err
+	}
+}
+
+func TestWorkspaceIdentityFromRecordFallsBack(t *testing.T) {
+	record := core.NewRecord(core.NewAuthCollection("users"))
+	record.SetEmail("dev@example.com")
+	record.Set("display_name", "Dev Person")
+
+	identity := workspaceIdentityFromRecord(record)
+	if identity.Name != "Dev Person" || identity.Email != "dev@example.com" {
+		t.Fatalf("expected profile fallbacks, got %+v", identity)
+	}
+
+	record.Set("git_name", "Dev")
+	record.Set("git_email", "dev@users.noreply.github.com")
+	identity = workspaceIdentityFromRecord(record)
+	if identity.Name != "Dev" || identity.Email != "dev@users.noreply.github.com" {
+		t.Fatalf("expected git overrides, got %+v", identity)
+	}
+}
+
+func TestValidateUpdateWorkspaceIdentityPayload(t *testing.T) {
+	valid := updateWorkspaceIdentityPayload{Name: " Dev Person ", Email: "dev@example.com"}
+	if err := validateUpdateWorkspaceIdentityPayload(&valid); err != nil || valid.Name != "Dev Person" {
+		t.Fatalf("expected valid payload, got %v (%+v)", err, valid)
+	}
+	for _, payload := range []updateWorkspaceIdentityPayload{
+		{Name: "Dev\nPerson"},
+		{Email: "not an email"},
+		{Email: "Dev <dev@example.com>"},
+	} {
+		if err := validateUpdateWorkspaceIdentityPayload(&payload); err == nil {
+			t.Fatalf("expected %+v to be rejected", payload)
+		}
+	}
+}
+
+func TestBuildWorkspaceIdentityCommandInstallsFiles(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	current, err := user.Current()
+	if err != nil {
+		t.Fatalf("current user: %v", err)
+	}
+	privateKey, publicKey, err := generateGitDeployKey("pocketpod-user-1")
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	home := t.TempDir()
+
+	script := buildWorkspaceIdentityCommand(tunnelExecUser{Name: current.Username, Home: home}, workspaceIdentity{
+		Name:       "Dev O'Person",
+		Email:      "dev@example.com",
+		PublicKey:  publicKey,
+		privateKey: privateKey,
+	})
+	if output, err := exec.Command("sh", "-c", script).CombinedOutput(); err != nil {
+		t.Fatalf("run identity command: %v: %s", err, output)
+	}
+
+	for path, wantMode := range map[string]os.FileMode{
+		filepath.Join(home, ".ssh"):                   os.ModeDir | 0o700,
+		filepath.Join(home, ".ssh", "id_ed25519"):     0o600,
+		filepath.Join(home, ".ssh", "id_ed25519.pub"): 0o644,
+	} {
+		info, err := os.Stat(path)
+		if err != nil || info.Mode() != wantMode {
+			t.Fatalf("%s: expected mode %v, got %v (%v)", path, wantMode, info, err)
+		}
+	}
+	installedKey, err := os.ReadFile(filepath.Join(home, ".ssh", "id_ed25519"))
+	if err != nil || string(installedKey) != privateKey {
+		t.Fatalf("expected private key installed unchanged, got %q (%v)", installedKey, err)
+	}
+
+	output, err := exec.Command("git", "config", "--file", filepath.Join(home, ".gitconfig"), "--get", "user.name").Output()
+	if err != nil || strings.TrimSpace(string(output)) != "Dev O'Person" {
+		t.Fatalf("expected git user.name, got %q (%v)", output, err)
+	}
+}
+
+func TestCreateWorkspaceInstallsIdentity(t *testing.T) {
+	stubWorkspaceClone(t)
+	stubWorkspaceIdentity(t, workspaceIdentity{
+		Name:       "Dev Person",
+		Email:      "dev@example.com",
+		PublicKey:  "ssh-ed25519 AAAA pocketpod-user-1",
+		privateKey: "PRIVATE KEY",
+	}, nil)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	result, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-one",
+	}, nil)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", result.Warnings)
+	}
+
+	var script string
+	for _, execOpts := range rt.execs {
+		if execOpts.User == "root" && strings.Contains(strings.Join(execOpts.Cmd, " "), "id_ed25519") {
+			script = execOpts.Cmd[len(execOpts.Cmd)-1]
+		}
+	}
+	for _, want := range []string{"home='/home/ubuntu'", "user='ubuntu'", "'PRIVATE KEY'", "user.email 'dev@example.com'", `chown -R "$user:$group"`} {
+		if !strings.Contains(script, want) {
+			t.Fatalf("expected identity command to contain %q, got %q", want, script)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	labelWorkspaceImage = "pocketpod.image"
+
+	maxWorkspaceImageLength = 512
+
+	workspaceImageNotAllowedMessage = "Workspace image is not allowed."
+	workspaceImagesFailedMessage    = "Failed to load workspace images."
+)
+
+var errWorkspaceImageNotAllowed = errors.New("workspace image not allowed")
+
+type workspaceImage struct {
+	Image       string `json:"image"`
+	DisplayName string `json:"displayName"`
+	Description string `json:"description,omitempty"`
+	DefaultHome string `json:"defaultHome,omitempty"`
+	IsDefault   bool   `json:"isDefault"`
+}
+
+var builtinWorkspaceImages = []workspaceImage{{
+	Image:       defaultWorkspaceImage,
+	DisplayName: "Dev Containers Universal",
+	IsDefault:   true,
+}}
+
+var lookupWorkspaceImages = func(app core.App) ([]workspaceImage, error) {
+	if app == nil {
+		return builtinWorkspaceImages, nil
+	}
+
+	records, err := app.FindAllRecords(CollectionWorkspaceImages)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return builtinWorkspaceImages, nil
+	}
+
+	images := make([]workspaceImage, 0, len(records))
+	for _, record := range records {
+		image := workspaceImage{
+			Image:       strings.TrimSpace(record.GetString("image")),
+			DisplayName: strings.TrimSpace(record.GetString("display_name")),
+			Description: strings.TrimSpace(record.GetString("description")),
+			DefaultHome: strings.TrimRight(strings.TrimSpace(record.GetString("default_home")), "/"),
+			IsDefault:   record.GetBool("is_default"),
+		}
+		if image.Image == "" {
+			continue
+		}
+		if image.DisplayName == "" {
+			image.DisplayName = image.Image
+		}
+		images = append(images, image)
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].IsDefault != images[j].IsDefault {
+			return images[i].IsDefault
+		}
+		return images[i].DisplayName < images[j].DisplayName
+	})
+	return images, nil
+}
+
+func (s *podmanService) resolveWorkspaceImage(requested string) (workspaceImage, error) {
+	images, err := lookupWorkspaceImages(s.app)
+	if err != nil {
+		return workspaceImage{}, err
+	}
+
+	if requested == "" {
+		for _, image := range images {
+			if image.IsDefault {
+				return image, nil
+			}
+		}
+		if len(images) > 0 {
+			return images[0], nil
+		}
+		return workspaceImage{}, errWorkspaceImageNotAllowed
+	}
+
+	for _, image := range images {
+		if image.Image == requested {
+			return image, nil
+		}
+	}
+	return workspaceImage{}, errWorkspaceImageNotAllowed
+}
+
+func registerWorkspaceImageRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/workspaces/images", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		images, err := lookupWorkspaceImages(svc.app)
+		if err != nil {
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": workspaceImagesFailedMessage,
+			})
+		}
+
+		return re.JSON(http.StatusOK, images)
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func stubWorkspaceImages(t *testing.T, images []workspaceImage) {
+	t.Helper()
+	original := lookupWorkspaceImages
+	t.Cleanup(func() { lookupWorkspaceImages = original })
+	lookupWorkspaceImages = func(core.App) ([]workspaceImage, error) { return images, nil }
+}
+
+func TestResolveWorkspaceImage(t *testing.T) {
+	stubWorkspaceImages(t, []workspaceImage{
+		{Image: "docker.io/library/ubuntu:24.04", DisplayName: "Ubuntu", DefaultHome: "/home/ubuntu"},
+		{Image: "docker.io/library/debian:12", DisplayName: "Debian", IsDefault: true},
+	})
+	svc := newTestPodmanService(newFakeRuntime())
+
+	image, err := svc.resolveWorkspaceImage("")
+	if err != nil || image.Image != "docker.io/library/debian:12" {
+		t.Fatalf("expected default image, got %+v %v", image, err)
+	}
+	image, err = svc.resolveWorkspaceImage("docker.io/library/ubuntu:24.04")
+	if err != nil || image.DefaultHome != "/home/ubuntu" {
+		t.Fatalf("expected allowlisted image, got %+v %v", image, err)
+	}
+	if _, err := svc.resolveWorkspaceImage("docker.io/library/alpine"); !errors.Is(err, errWorkspaceImageNotAllowed) {
+		t.Fatalf("expected image to be rejected, got %v", err)
+	}
+}
+
+func TestValidateCreateWorkspacePayloadInvalidImage(t *testing.T) {
+	payload := createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Image:   "alpine; rm -rf /",
+	}
+
+	if err := validateCreateWorkspacePayload(&payload); err == nil {
+		t.Fatal("expected invalid image to fail")
+	}
+}
+
+func TestCreateWorkspaceUsesSelectedImage(t *testing.T) {
+	originalWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir temp: %v", err)
+	}
+	originalRun := runWorkspaceCommand
+	originalLookPath := workspaceLookPath
+	t.Cleanup(func() {
+		_ = os.Chdir(originalWD)
+		runWorkspaceCommand = originalRun
+		workspaceLookPath = originalLookPath
+	})
+	runWorkspaceCommand = func([]string, string, ...string) ([]byte, error) { return nil, nil }
+	workspaceLookPath = func(string) (string, error) { return "git", nil }
+
+	stubWorkspaceImages(t, []workspaceImage{
+		{Image: "docker.io/library/ubuntu:24.04", DisplayName: "Ubuntu", DefaultHome: "/home/dev"},
+	})
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+
+	result, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-ubuntu",
+		Image:   "docker.io/library/ubuntu:24.04",
+	}, nil)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	t.Cleanup(func() {
+		svc.stopTunnelMonitor(rt.containers[0].ID)
+	})
+
+	if len(rt.created) != 1 {
+		t.Fatalf("expected default home to skip the home probe, got %d creates", len(rt.created))
+	}
+	spec := rt.created[0]
+	if spec.Image != "docker.io/library/ubuntu:24.04" || result.Image != spec.Image {
+		t.Fatalf("expected selected image, got spec %q result %q", spec.Image, result.Image)
+	}
+	if spec.Labels[labelWorkspaceImage] != spec.Image || spec.Labels[labelWorkspaceHome] != "/home/dev" {
+		t.Fatalf("unexpected labels: %v", spec.Labels)
+	}
+}
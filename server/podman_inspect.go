@@ -0,0 +1,367 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const redactedEnvValue = "********"
+
+var secretEnvKeyMarkers = []string{
+	"PASSWORD",
+	"PASSWD",
+	"SECRET",
+	"TOKEN",
+	"API_KEY",
+	"APIKEY",
+	"PRIVATE_KEY",
+	"ACCESS_KEY",
+	"CREDENTIAL",
+	"AUTH",
+}
+
+type podmanInspectSummary struct {
+	ID           string `json:"Id"`
+	Name         string `json:"Name"`
+	Image        string `json:"Image"`
+	ImageName    string `json:"ImageName"`
+	Created      string `json:"Created"`
+	RestartCount int    `json:"RestartCount"`
+	State        struct {
+		Status     string `json:"Status"`
+		Running    bool   `json:"Running"`
+		Paused     bool   `json:"Paused"`
+		OOMKilled  bool   `json:"OOMKilled"`
+		ExitCode   int    `json:"ExitCode"`
+		StartedAt  string `json:"StartedAt"`
+		FinishedAt string `json:"FinishedAt"`
+	} `json:"State"`
+	Config struct {
+		Image        string              `json:"Image"`
+		Cmd          []string            `json:"Cmd"`
+		Env          []string            `json:"Env"`
+		Labels       map[string]string   `json:"Labels"`
+		ExposedPorts map[string]struct{} `json:"ExposedPorts"`
+	} `json:"Config"`
+	HostConfig struct {
+		NanoCpus      int64 `json:"NanoCpus"`
+		CpuQuota      int64 `json:"CpuQuota"`
+		CpuPeriod     int64 `json:"CpuPeriod"`
+		CpuShares     int64 `json:"CpuShares"`
+		Memory        int64 `json:"Memory"`
+		PidsLimit     int64 `json:"PidsLimit"`
+		ShmSize       int64 `json:"ShmSize"`
+		RestartPolicy struct {
+			Name              string `json:"Name"`
+			MaximumRetryCount int    `json:"MaximumRetryCount"`
+		} `json:"RestartPolicy"`
+	} `json:"HostConfig"`
+	Mounts []struct {
+		Type        string `json:"Type"`
+		Name        string `json:"Name"`
+		Source      string `json:"Source"`
+		Destination string `json:"Destination"`
+		Mode        string `json:"Mode"`
+		RW          bool   `json:"RW"`
+	} `json:"Mounts"`
+	NetworkSettings struct {
+		IPAddress string `json:"IPAddress"`
+		Ports     map[string][]struct {
+			HostIP   string `json:"HostIp"`
+			HostPort string `json:"HostPort"`
+		} `json:"Ports"`
+		Networks map[string]struct {
+			IPAddress  string `json:"IPAddress"`
+			Gateway    string `json:"Gateway"`
+			MacAddress string `json:"MacAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+type containerDetail struct {
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	Image         string                 `json:"image"`
+	ImageID       string                 `json:"imageId,omitempty"`
+	Command       []string               `json:"command,omitempty"`
+	CreatedAt     string                 `json:"createdAt,omitempty"`
+	State         containerDetailState   `json:"state"`
+	RestartPolicy containerRestartPolicy `json:"restartPolicy"`
+	Resources     containerResources     `json:"resources"`
+	Mounts        []containerDetailMount `json:"mounts"`
+	ExposedPorts  []string               `json:"exposedPorts"`
+	Ports         []containerPortBinding `json:"ports"`
+	Networks      []containerNetwork     `json:"networks"`
+	Labels        map[string]string      `json:"labels"`
+	Env           []containerEnvVar      `json:"env"`
+}
+
+type containerDetailState struct {
+	Status       string `json:"status"`
+	Running      bool   `json:"running"`
+	Paused       bool   `json:"paused"`
+	ExitCode     int    `json:"exitCode"`
+	OOMKilled    bool   `json:"oomKilled"`
+	StartedAt    string `json:"startedAt,omitempty"`
+	FinishedAt   string `json:"finishedAt,omitempty"`
+	RestartCount int    `json:"restartCount"`
+}
+
+type containerRestartPolicy struct {
+	Name              string `json:"name"`
+	MaximumRetryCount int    `json:"maximumRetryCount"`
+}
+
+type containerResources struct {
+	CPUs      float64 `json:"cpus"`
+	NanoCPUs  int64   `json:"nanoCpus"`
+	CPUQuota  int64   `json:"cpuQuota"`
+	CPUPeriod int64   `json:"cpuPeriod"`
+	CPUShares int64   `json:"cpuShares"`
+	Memory    int64   `json:"memory"`
+	PidsLimit int64   `json:"pidsLimit"`
+	ShmSize   int64   `json:"shmSize"`
+}
+
+type containerDetailMount struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	ReadOnly    bool   `json:"readOnly"`
+}
+
+type containerPortBinding struct {
+	ContainerPort string `json:"containerPort"`
+	HostIP        string `json:"hostIp,omitempty"`
+	HostPort      string `json:"hostPort"`
+}
+
+type containerNetwork struct {
+	Name       string `json:"name"`
+	IPAddress  string `json:"ipAddress,omitempty"`
+	Gateway    string `json:"gateway,omitempty"`
+	MacAddress string `json:"macAddress,omitempty"`
+}
+
+type containerEnvVar struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Redacted bool   `json:"redacted,omitempty"`
+}
+
+func (s *podmanService) containerDetail(access containerAccess, containerID string) (containerDetail, error) {
+	inspected, err := s.authorizeContainerRead(access, containerID)
+	if err != nil {
+		return containerDetail{}, err
+	}
+	return buildContainerDetail(inspected), nil
+}
+
+func buildContainerDetail(inspected podmanInspectSummary) containerDetail {
+	image := strings.TrimSpace(inspected.ImageName)
+	if image == "" {
+		image = strings.TrimSpace(inspected.Config.Image)
+	}
+
+	detail := containerDetail{
+		ID:        inspected.ID,
+		Name:      strings.TrimPrefix(inspected.Name, "/"),
+		Image:     image,
+		ImageID:   inspected.Image,
+		Command:   inspected.Config.Cmd,
+		CreatedAt: inspected.Created,
+		State: containerDetailState{
+			Status:       inspected.State.Status,
+			Running:      inspected.State.Running,
+			Paused:       inspected.State.Paused,
+			ExitCode:     inspected.State.ExitCode,
+			OOMKilled:    inspected.State.OOMKilled,
+			StartedAt:    inspected.State.StartedAt,
+			FinishedAt:   inspected.State.FinishedAt,
+			RestartCount: inspected.RestartCount,
+		},
+		RestartPolicy: containerRestartPolicy{
+			Name:              inspected.HostConfig.RestartPolicy.Name,
+			MaximumRetryCount: inspected.HostConfig.RestartPolicy.MaximumRetryCount,
+		},
+		Resources: containerResources{
+			NanoCPUs:  inspected.HostConfig.NanoCpus,
+			CPUQuota:  inspected.HostConfig.CpuQuota,
+			CPUPeriod: inspected.HostConfig.CpuPeriod,
+			CPUShares: inspected.HostConfig.CpuShares,
+			Memory:    inspected.HostConfig.Memory,
+			PidsLimit: inspected.HostConfig.PidsLimit,
+			ShmSize:   inspected.HostConfig.ShmSize,
+		},
+		Mounts:       []containerDetailMount{},
+		ExposedPorts: []string{},
+		Ports:        []containerPortBinding{},
+		Networks:     []containerNetwork{},
+		Labels:       redactContainerLabels(inspected.Config.Labels),
+		Env:          redactContainerEnv(inspected.Config.Env),
+	}
+	switch {
+	case detail.Resources.NanoCPUs > 0:
+		detail.Resources.CPUs = float64(detail.Resources.NanoCPUs) / 1e9
+	case detail.Resources.CPUQuota > 0 && detail.Resources.CPUPeriod > 0:
+		detail.Resources.CPUs = float64(detail.Resources.CPUQuota) / float64(detail.Resources.CPUPeriod)
+	}
+
+	for _, mount := range inspected.Mounts {
+		detail.Mounts = append(detail.Mounts, containerDetailMount{
+			Type:        mount.Type,
+			Name:        mount.Name,
+			Source:      mount.Source,
+			Destination: mount.Destination,
+			ReadOnly:    !mount.RW,
+		})
+	}
+
+	// Podman lists exposed but unpublished ports under NetworkSettings.Ports
+	// with no bindings, Docker lists them under Config.ExposedPorts.
+	exposed := make(map[string]struct{}, len(inspected.Config.ExposedPorts))
+	for port := range inspected.Config.ExposedPorts {
+		exposed[port] = struct{}{}
+	}
+	for port, bindings := range inspected.NetworkSettings.Ports {
+		exposed[port] = struct{}{}
+		for _, binding := range bindings {
+			detail.Ports = append(detail.Ports, containerPortBinding{
+				ContainerPort: port,
+				HostIP:        binding.HostIP,
+				HostPort:      binding.HostPort,
+			})
+		}
+	}
+	for port := range exposed {
+		detail.ExposedPorts = append(detail.ExposedPorts, port)
+	}
+	sort.Strings(detail.ExposedPorts)
+	sort.Slice(detail.Ports, func(i, j int) bool {
+		if detail.Ports[i].ContainerPort != detail.Ports[j].ContainerPort {
+			return comparePortSpec(detail.Ports[i].ContainerPort, detail.Ports[j].ContainerPort)
+		}
+		return detail.Ports[i].HostPort < detail.Ports[j].HostPort
+	})
+
+	for _, name := range sortedNetworkNames(inspected) {
+		network := inspected.NetworkSettings.Networks[name]
+		detail.Networks = append(detail.Networks, containerNetwork{
+			Name:       name,
+			IPAddress:  network.IPAddress,
+			Gateway:    network.Gateway,
+			MacAddress: network.MacAddress,
+		})
+	}
+	if len(detail.Networks) == 0 && inspected.NetworkSettings.IPAddress != "" {
+		detail.Networks = append(detail.Networks, containerNetwork{IPAddress: inspected.NetworkSettings.IPAddress})
+	}
+
+	return detail
+}
+
+func sortedNetworkNames(inspected podmanInspectSummary) []string {
+	names := make([]string, 0, len(inspected.NetworkSettings.Networks))
+	for name := range inspected.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func comparePortSpec(a string, b string) bool {
+	aPort, aErr := strconv.Atoi(strings.SplitN(a, "/", 2)[0])
+	bPort, bErr := strconv.Atoi(strings.SplitN(b, "/", 2)[0])
+	if aErr != nil || bErr != nil || aPort == bPort {
+		return a < b
+	}
+	return aPort < bPort
+}
+
+func redactContainerEnv(env []string) []containerEnvVar {
+	vars := make([]containerEnvVar, 0, len(env))
+	for _, entry := range env {
+		name, value, _ := strings.Cut(entry, "=")
+		envVar := containerEnvVar{Name: name, Value: value}
+		if isSecretEnvKey(name) {
+			envVar.Value = redactedEnvValue
+			envVar.Redacted = true
+		} else if redacted, ok := redactURLPassword(value); ok {
+			envVar.Value = redacted
+			envVar.Redacted = true
+		}
+		vars = append(vars, envVar)
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+	return vars
+}
+
+func redactContainerLabels(labels map[string]string) map[string]string {
+	redacted := make(map[string]string, len(labels))
+	for key, value := range labels {
+		switch {
+		case isSecretEnvKey(key):
+			value = redactedEnvValue
+		case key == labelWorkspaceRemoteEnv:
+			value = redactRemoteEnvLabel(value)
+		default:
+			value, _ = redactURLPassword(value)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+func redactRemoteEnvLabel(value string) string {
+	var remoteEnv map[string]string
+	if err := json.Unmarshal([]byte(value), &remoteEnv); err != nil {
+		return redactedEnvValue
+	}
+	for key, entry := range remoteEnv {
+		if isSecretEnvKey(key) {
+			remoteEnv[key] = redactedEnvValue
+		} else {
+			remoteEnv[key], _ = redactURLPassword(entry)
+		}
+	}
+	encoded, err := json.Marshal(remoteEnv)
+	if err != nil {
+		return redactedEnvValue
+	}
+	return string(encoded)
+}
+
+func isSecretEnvKey(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, marker := range secretEnvKeyMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactURLPassword(value string) (string, bool) {
+	scheme, rest, ok := strings.Cut(value, "://")
+	if !ok {
+		return value, false
+	}
+	authority := rest
+	if idx := strings.IndexAny(rest, "/?#"); idx >= 0 {
+		authority = rest[:idx]
+	}
+	at := strings.LastIndex(authority, "@")
+	if at < 0 {
+		return value, false
+	}
+	username, _, hasPassword := strings.Cut(authority[:at], ":")
+	if !hasPassword {
+		return value, false
+	}
+	return scheme + "://" + username + ":" + redactedEnvValue + rest[at:], true
+}
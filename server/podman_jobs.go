@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	workspaceJobStatusRunning   = "running"
+	workspaceJobStatusSucceeded = "succeeded"
+	workspaceJobStatusFailed    = "failed"
+
+	workspaceJobKindCreate  = "create"
+	workspaceJobKindRebuild = "rebuild"
+	workspaceJobKindRestore = "restore"
+
+	workspaceJobPhaseCloning        = "cloning"
+	workspaceJobPhaseRestoring      = "restoring"
+	workspaceJobPhaseBuilding       = "building"
+	workspaceJobPhasePulling        = "pulling"
+	workspaceJobPhaseRemoving       = "removing"
+	workspaceJobPhaseCreating       = "creating"
+	workspaceJobPhaseStarting       = "starting"
+	workspaceJobPhaseConfiguringGit = "configuring_git"
+	workspaceJobPhaseInstallingCLI  = "installing_cli"
+	workspaceJobPhaseStartingTunnel = "starting_tunnel"
+	workspaceJobPhaseRunningHooks   = "running_hooks"
+
+	workspaceJobNotFoundMessage = "Workspace job not found."
+
+	workspaceJobRetention = time.Hour
+)
+
+var errWorkspaceJobNotFound = errors.New("workspace job not found")
+
+type workspaceJob struct {
+	ID          string                   `json:"id"`
+	Kind        string                   `json:"kind"`
+	Owner       string                   `json:"owner"`
+	Name        string                   `json:"name,omitempty"`
+	RepoURL     string                   `json:"repoUrl"`
+	Ref         string                   `json:"ref,omitempty"`
+	Status      string                   `json:"status"`
+	Phase       string                   `json:"phase,omitempty"`
+	Phases      []workspaceJobPhase      `json:"phases"`
+	ContainerID string                   `json:"containerId,omitempty"`
+	Result      *createWorkspaceResponse `json:"result,omitempty"`
+	Error       string                   `json:"error,omitempty"`
+	ErrorStatus int                      `json:"errorStatus,omitempty"`
+	BuildID     string                   `json:"buildId,omitempty"`
+	FailedStep  string                   `json:"failedStep,omitempty"`
+	Cleanup     *workspaceCleanup        `json:"cleanup,omitempty"`
+	StartedAt   time.Time                `json:"startedAt"`
+	FinishedAt  time.Time                `json:"finishedAt,omitzero"`
+
+	limits   containerLimits
+	sourceID string
+}
+
+type workspaceJobPhase struct {
+	Name       string    `json:"name"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt,omitzero"`
+	DurationMS int64     `json:"durationMs"`
+}
+
+func (j *workspaceJob) snapshot() *workspaceJob {
+	copied := *j
+	copied.Phases = append([]workspaceJobPhase{}, j.Phases...)
+	return &copied
+}
+
+func (j *workspaceJob) endPhase(now time.Time, message string) {
+	if len(j.Phases) == 0 {
+		return
+	}
+	phase := &j.Phases[len(j.Phases)-1]
+	if phase.Status != workspaceJobStatusRunning {
+		return
+	}
+	phase.Status = workspaceJobStatusSucceeded
+	if message != "" {
+		phase.Status = workspaceJobStatusFailed
+		phase.Error = message
+	}
+	phase.FinishedAt = now
+	phase.DurationMS = now.Sub(phase.StartedAt).Milliseconds()
+}
+
+func (s *podmanService) startWorkspaceJob(userID string, payload createWorkspacePayload) (*workspaceJob, error) {
+	s.jobAdmitMu.Lock()
+	defer s.jobAdmitMu.Unlock()
+
+	if _, _, err := s.admitWorkspace(userID, payload, nil); err != nil {
+		return nil, err
+	}
+
+	job := &workspaceJob{
+		ID:        generateSessionID(),
+		Kind:      workspaceJobKindCreate,
+		Owner:     userID,
+		Name:      payload.Name,
+		RepoURL:   payload.RepoURL,
+		Ref:       payload.Ref,
+		Status:    workspaceJobStatusRunning,
+		Phases:    []workspaceJobPhase{},
+		StartedAt: time.Now().UTC(),
+		limits:    payload.limits,
+	}
+
+	s.jobsMu.Lock()
+	s.pruneWorkspaceJobsLocked(job.StartedAt)
+	s.jobs[job.ID] = job
+	snapshot := job.snapshot()
+	s.jobsMu.Unlock()
+
+	s.publishWorkspaceJob(snapshot)
+	go s.runWorkspaceJob(job, func() (*createWorkspaceResponse, error) {
+		return s.createWorkspace(job.Owner, payload, job)
+	})
+	return snapshot, nil
+}
+
+func (s *podmanService) runWorkspaceJob(job *workspaceJob, run func() (*createWorkspaceResponse, error)) {
+	result, err := run()
+	s.updateWorkspaceJob(job, func(now time.Time) {
+		job.FinishedAt = now
+		if err != nil {
+			phaseErr := err
+			job.Status = workspaceJobStatusFailed
+			job.ErrorStatus, job.Error = workspaceCreateErrorStatus(err)
+			var buildErr *workspaceBuildError
+			if errors.As(err, &buildErr) {
+				job.BuildID = buildErr.BuildID
+			}
+			var createErr *workspaceCreateError
+			if errors.As(err, &createErr) {
+				phaseErr = createErr.Err
+				job.FailedStep = createErr.Step
+				job.Cleanup = &createErr.Cleanup
+				job.Error += " " + createErr.cleanupMessage()
+			}
+			job.endPhase(now, phaseErr.Error())
+			return
+		}
+		job.endPhase(now, "")
+		job.Status = workspaceJobStatusSucceeded
+		job.Phase = ""
+		job.Result = result
+	})
+	if err != nil && s.app != nil {
+		s.app.Logger().Warn("Workspace job failed", "job", job.ID, "kind", job.Kind, "phase", job.Phase, "error", err)
+	}
+}
+
+func (s *podmanService) enterWorkspaceJobPhase(job *workspaceJob, phase string) {
+	if job == nil {
+		return
+	}
+	s.updateWorkspaceJob(job, func(now time.Time) {
+		job.endPhase(now, "")
+		job.Phase = phase
+		job.Phases = append(job.Phases, workspaceJobPhase{
+			Name:      phase,
+			Status:    workspaceJobStatusRunning,
+			StartedAt: now,
+		})
+	})
+}
+
+func (s *podmanService) failWorkspaceJobPhase(job *workspaceJob, message string) {
+	if job == nil {
+		return
+	}
+	s.updateWorkspaceJob(job, func(now time.Time) {
+		job.endPhase(now, message)
+	})
+}
+
+func (s *podmanService) setWorkspaceJobContainer(job *workspaceJob, containerID string) {
+	if job == nil {
+		return
+	}
+	s.updateWorkspaceJob(job, func(time.Time) {
+		job.ContainerID = containerID
+	})
+}
+
+func (s *podmanService) updateWorkspaceJob(job *workspaceJob, update func(now time.Time)) {
+	s.jobsMu.Lock()
+	update(time.Now().UTC())
+	snapshot := job.snapshot()
+	s.jobsMu.Unlock()
+
+	s.publishWorkspaceJob(snapshot)
+}
+
+func (s *podmanService) publishWorkspaceJob(job *workspaceJob) {
+	s.sendToOwner(job.Owner, podmanStreamMessage{Type: "workspaceJob", Data: []podmanContainer{}, Job: job})
+}
+
+func (s *podmanService) pruneWorkspaceJobsLocked(now time.Time) {
+	for id, job := range s.jobs {
+		if job.Status != workspaceJobStatusRunning && now.Sub(job.FinishedAt) > workspaceJobRetention {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+func (s *podmanService) workspaceJob(access containerAccess, id string) (*workspaceJob, error) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok || (!access.Admin && job.Owner != access.UserID) {
+		return nil, errWorkspaceJobNotFound
+	}
+	return job.snapshot(), nil
+}
+
+func (s *podmanService) pendingWorkspaceUsage(usage workspaceUsage, userID string, quota workspaceQuota, self *workspaceJob) workspaceUsage {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	for _, job := range s.jobs {
+		if job == self || job.Owner != userID || job.Status != workspaceJobStatusRunning || job.ContainerID != "" {
+			continue
+		}
+		usage.Workspaces++
+		usage.Running++
+		cpus, memory := quota.reservation(job.limits)
+		usage.CPUs += cpus
+		usage.Memory += memory
+	}
+	return usage
+}
+
+func registerWorkspaceJobRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/workspaces/jobs/{id}", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		job, err := svc.workspaceJob(newContainerAccess(re.Auth), strings.TrimSpace(re.Request.PathValue("id")))
+		if err != nil {
+			return re.JSON(http.StatusNotFound, map[string]string{
+				"message": workspaceJobNotFoundMessage,
+			})
+		}
+
+		return re.JSON(http.StatusOK, job)
+	})
+}
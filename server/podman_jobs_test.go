@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func stubWorkspaceClone(t *testing.T) {
+	t.Helper()
+	originalWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir temp: %v", err)
+	}
+	originalRun := runWorkspaceCommand
+	originalLookPath := workspaceLookPath
+	t.Cleanup(func() {
+		_ = os.Chdir(originalWD)
+		runWorkspaceCommand = originalRun
+		workspaceLookPath = originalLookPath
+	})
+	runWorkspaceCommand = func([]string, string, ...string) ([]byte, error) { return nil, nil }
+	workspaceLookPath = func(string) (string, error) { return "git", nil }
+}
+
+func waitForWorkspaceJob(t *testing.T, svc *podmanService, id string) *workspaceJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := svc.workspaceJob(containerAccess{UserID: "user-1"}, id)
+		if err != nil {
+			t.Fatalf("load job: %v", err)
+		}
+		if job.Status != workspaceJobStatusRunning {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for workspace job")
+	return nil
+}
+
+func TestWorkspaceJobRecordsPhases(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	started, err := svc.startWorkspaceJob("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-one",
+	})
+	if err != nil {
+		t.Fatalf("start job: %v", err)
+	}
+	if started.Status != workspaceJobStatusRunning {
+		t.Fatalf("expected running job, got %+v", started)
+	}
+
+	job := waitForWorkspaceJob(t, svc, started.ID)
+	if job.Status != workspaceJobStatusSucceeded || job.Result == nil || job.Result.Name != "ws-one" {
+		t.Fatalf("expected successful job with result, got %+v", job)
+	}
+	want := []string{
+		workspaceJobPhaseCloning,
+		workspaceJobPhasePulling,
+		workspaceJobPhaseCreating,
+		workspaceJobPhaseStarting,
+		workspaceJobPhaseInstallingCLI,
+		workspaceJobPhaseStartingTunnel,
+	}
+	if len(job.Phases) != len(want) {
+		t.Fatalf("expected phases %v, got %+v", want, job.Phases)
+	}
+	for i, phase := range job.Phases {
+		if phase.Name != want[i] || phase.Status != workspaceJobStatusSucceeded || phase.FinishedAt.IsZero() {
+			t.Fatalf("unexpected phase %d: %+v", i, phase)
+		}
+	}
+	if job.ContainerID == "" || len(rt.pulls) != 1 || rt.pulls[0] != defaultWorkspaceImage {
+		t.Fatalf("expected container id and one pull, got %q and %v", job.ContainerID, rt.pulls)
+	}
+
+	if _, err := svc.workspaceJob(containerAccess{UserID: "user-2"}, started.ID); !errors.Is(err, errWorkspaceJobNotFound) {
+		t.Fatalf("expected job hidden from other users, got %v", err)
+	}
+	if _, err := svc.workspaceJob(containerAccess{UserID: "admin-1", Admin: true}, started.ID); err != nil {
+		t.Fatalf("expected admin to see job, got %v", err)
+	}
+}
+
+func TestWorkspaceJobReportsFailedPhase(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	rt.pullErr = errors.New("manifest unknown")
+	svc := newTestPodmanService(rt)
+
+	started, err := svc.startWorkspaceJob("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-one",
+	})
+	if err != nil {
+		t.Fatalf("start job: %v", err)
+	}
+
+	job := waitForWorkspaceJob(t, svc, started.ID)
+	if job.Status != workspaceJobStatusFailed || job.Error != workspacePullFailedMessage+" Cleaned up: repository clone." || job.ErrorStatus != http.StatusInternalServerError {
+		t.Fatalf("expected failed pull, got %+v", job)
+	}
+	last := job.Phases[len(job.Phases)-1]
+	if last.Name != workspaceJobPhasePulling || last.Status != workspaceJobStatusFailed || last.Error == "" || job.FailedStep != workspaceJobPhasePulling {
+		t.Fatalf("expected failed pulling phase, got %+v", last)
+	}
+	if len(rt.created) != 0 {
+		t.Fatalf("expected nothing created, got %v", rt.created)
+	}
+}
+
+func TestWorkspaceJobCountsPendingCreatesInQuota(t *testing.T) {
+	stubWorkspaceQuota(t, workspaceQuota{MaxWorkspaces: 1})
+	svc := newTestPodmanService(newFakeRuntime())
+	svc.jobs["pending"] = &workspaceJob{ID: "pending", Owner: "user-1", Status: workspaceJobStatusRunning}
+
+	_, err := svc.startWorkspaceJob("user-1", createWorkspacePayload{RepoURL: "https://github.com/org/repo.git"})
+	var quotaErr *workspaceQuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Status.Usage.Workspaces != 1 {
+		t.Fatalf("expected pending job to count against the quota, got %v", err)
+	}
+
+	if _, _, err := svc.admitWorkspace("user-2", createWorkspacePayload{RepoURL: "https://github.com/org/repo.git"}, nil); err != nil {
+		t.Fatalf("expected another user's job to be admitted, got %v", err)
+	}
+}
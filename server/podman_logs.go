@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	podmanLogsFailedMessage = "Failed to read container logs."
+
+	containerLogBufferSize = 256
+	containerLogMaxTail    = 10000
+)
+
+var errInvalidLogOptions = errors.New("invalid log options")
+
+type containerLogMessage struct {
+	Type    string            `json:"type"`
+	Data    *containerLogLine `json:"data,omitempty"`
+	Message string            `json:"message,omitempty"`
+}
+
+type containerLogStream struct {
+	sendCh    chan containerLogMessage
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+func newContainerLogStream() *containerLogStream {
+	return &containerLogStream{
+		sendCh:  make(chan containerLogMessage, containerLogBufferSize),
+		closeCh: make(chan struct{}),
+	}
+}
+
+func (l *containerLogStream) trySend(msg containerLogMessage) {
+	select {
+	case <-l.closeCh:
+		return
+	default:
+	}
+
+	select {
+	case l.sendCh <- msg:
+	default:
+		l.close()
+	}
+}
+
+func (l *containerLogStream) close() {
+	l.closeOnce.Do(func() {
+		close(l.closeCh)
+	})
+}
+
+func parseContainerLogOptions(query url.Values, now time.Time) (containerLogOptions, error) {
+	opts := containerLogOptions{Follow: true, Tail: -1}
+
+	if raw := strings.TrimSpace(query.Get("follow")); raw != "" {
+		follow, err := strconv.ParseBool(raw)
+		if err != nil {
+			return opts, fmt.Errorf("%w: follow must be a boolean", errInvalidLogOptions)
+		}
+		opts.Follow = follow
+	}
+
+	if raw := strings.TrimSpace(query.Get("tail")); raw != "" && raw != "all" {
+		tail, err := strconv.Atoi(raw)
+		if err != nil || tail < 0 || tail > containerLogMaxTail {
+			return opts, fmt.Errorf("%w: tail must be between 0 and %d", errInvalidLogOptions, containerLogMaxTail)
+		}
+		opts.Tail = tail
+	}
+
+	if raw := strings.TrimSpace(query.Get("since")); raw != "" {
+		if duration, err := time.ParseDuration(raw); err == nil && duration >= 0 {
+			opts.Since = now.Add(-duration)
+		} else if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+			opts.Since = parsed
+		} else if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil && seconds >= 0 {
+			opts.Since = time.Unix(seconds, 0)
+		} else {
+			return opts, fmt.Errorf("%w: since must be a duration, RFC 3339 time or unix timestamp", errInvalidLogOptions)
+		}
+	}
+
+	return opts, nil
+}
+
+func parseContainerLogLine(stream string, raw string) containerLogLine {
+	line := containerLogLine{Stream: stream, Line: raw}
+	prefix, rest, ok := strings.Cut(raw, " ")
+	if !ok {
+		if _, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			line.Timestamp = raw
+			line.Line = ""
+		}
+		return line
+	}
+	if _, err := time.Parse(time.RFC3339Nano, prefix); err == nil {
+		line.Timestamp = prefix
+		line.Line = rest
+	}
+	return line
+}
+
+func (s *podmanService) pumpContainerLogs(ctx context.Context, containerID string, opts containerLogOptions, stream *containerLogStream) {
+	err := s.runtime.Logs(ctx, containerID, opts, func(line containerLogLine) {
+		stream.trySend(containerLogMessage{Type: "log", Data: &line})
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		stream.trySend(containerLogMessage{Type: "error", Message: podmanLogsFailedMessage})
+	}
+	stream.trySend(containerLogMessage{Type: "end"})
+}
+
+func serveContainerLogsWebSocket(ctx context.Context, conn *websocket.Conn, stream *containerLogStream) {
+	defer conn.Close()
+
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				stream.close()
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-stream.sendCh:
+			if err := conn.SetWriteDeadline(time.Now().Add(podmanWriteTimeout)); err != nil {
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+			if msg.Type == "end" {
+				_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(podmanWriteTimeout))
+				return
+			}
+		case <-stream.closeCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func serveContainerLogsSSE(ctx context.Context, w http.ResponseWriter, stream *containerLogStream) {
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	_ = controller.Flush()
+
+	for {
+		select {
+		case msg := <-stream.sendCh:
+			payload, err := json.Marshal(msg)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, payload); err != nil {
+				return
+			}
+			if err := controller.Flush(); err != nil {
+				return
+			}
+			if msg.Type == "end" {
+				return
+			}
+		case <-stream.closeCh:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func registerContainerLogRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/containers/{id}/logs", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		opts, err := parseContainerLogOptions(re.Request.URL.Query(), time.Now())
+		if err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": strings.TrimPrefix(err.Error(), errInvalidLogOptions.Error()+": "),
+			})
+		}
+
+		if _, err := svc.authorizeContainerRead(newContainerAccess(re.Auth), containerID); err != nil {
+			switch {
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": podmanLogsFailedMessage,
+				})
+			}
+		}
+
+		// Cancelling ctx stops the runtime reader, which kills a podman logs
+		// child process or closes the engine API response.
+		ctx, cancel := context.WithCancel(re.Request.Context())
+		defer cancel()
+		stream := newContainerLogStream()
+
+		if websocket.IsWebSocketUpgrade(re.Request) {
+			conn, err := podmanStreamUpgrader.Upgrade(re.Response, re.Request, nil)
+			if err != nil {
+				return err
+			}
+			go svc.pumpContainerLogs(ctx, containerID, opts, stream)
+			serveContainerLogsWebSocket(ctx, conn, stream)
+			return nil
+		}
+
+		go svc.pumpContainerLogs(ctx, containerID, opts, stream)
+		serveContainerLogsSSE(ctx, re.Response, stream)
+		return nil
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseContainerLogOptions(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	opts, err := parseContainerLogOptions(url.Values{}, now)
+	if err != nil || !opts.Follow || opts.Tail != -1 || !opts.Since.IsZero() {
+		t.Fatalf("unexpected defaults: %+v %v", opts, err)
+	}
+
+	opts, err = parseContainerLogOptions(url.Values{"follow": {"false"}, "tail": {"100"}, "since": {"10m"}}, now)
+	if err != nil || opts.Follow || opts.Tail != 100 || !opts.Since.Equal(now.Add(-10*time.Minute)) {
+		t.Fatalf("unexpected options: %+v %v", opts, err)
+	}
+
+	opts, err = parseContainerLogOptions(url.Values{"since": {"2026-10-16T11:00:00Z"}}, now)
+	if err != nil || !opts.Since.Equal(now.Add(-time.Hour)) {
+		t.Fatalf("unexpected rfc3339 since: %+v %v", opts, err)
+	}
+
+	for _, query := range []url.Values{
+		{"tail": {"-1"}},
+		{"tail": {"999999"}},
+		{"since": {"yesterday"}},
+		{"follow": {"maybe"}},
+	} {
+		if _, err := parseContainerLogOptions(query, now); err == nil {
+			t.Fatalf("expected %v to be rejected", query)
+		}
+	}
+}
+
+func TestParseContainerLogLine(t *testing.T) {
+	line := parseContainerLogLine("stderr", "2026-10-16T10:00:00.123456789Z hello world")
+	if line.Stream != "stderr" || line.Timestamp != "2026-10-16T10:00:00.123456789Z" || line.Line != "hello world" {
+		t.Fatalf("unexpected line: %+v", line)
+	}
+
+	line = parseContainerLogLine("stdout", "no timestamp here")
+	if line.Timestamp != "" || line.Line != "no timestamp here" {
+		t.Fatalf("unexpected untimestamped line: %+v", line)
+	}
+}
+
+func TestDemuxEngineLogLinesJoinsPartialFrames(t *testing.T) {
+	var buf bytes.Buffer
+	writeEngineFrame(&buf, 1, "first li")
+	writeEngineFrame(&buf, 2, "oops\n")
+	writeEngineFrame(&buf, 1, "ne\nsecond\nunterminated")
+
+	var lines []string
+	if err := demuxEngineLogLines(&buf, func(stream string, line string) {
+		lines = append(lines, stream+":"+line)
+	}); err != nil {
+		t.Fatalf("demux: %v", err)
+	}
+
+	want := []string{"stderr:oops", "stdout:first line", "stdout:second", "stdout:unterminated"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected %v, got %v", want, lines)
+	}
+}
+
+func TestLibpodRuntimeLogsSendsOptions(t *testing.T) {
+	since := time.Unix(1760000000, 0)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4.0.0/libpod/containers/abc/logs", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("follow") != "false" || query.Get("tail") != "5" || query.Get("since") != "1760000000" || query.Get("timestamps") != "true" {
+			t.Errorf("unexpected query %q", r.URL.RawQuery)
+		}
+		var buf bytes.Buffer
+		writeEngineFrame(&buf, 1, "2026-10-16T10:00:00Z ready\n")
+		_, _ = w.Write(buf.Bytes())
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	var lines []containerLogLine
+	err := rt.Logs(context.Background(), "abc", containerLogOptions{Since: since, Tail: 5}, func(line containerLogLine) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	if len(lines) != 1 || lines[0] != (containerLogLine{Stream: "stdout", Timestamp: "2026-10-16T10:00:00Z", Line: "ready"}) {
+		t.Fatalf("unexpected lines: %+v", lines)
+	}
+}
+
+func TestServeContainerLogsSSE(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{{ID: "abc123", Status: "running"}}
+	rt.logs = []containerLogLine{
+		{Stream: "stdout", Line: "one"},
+		{Stream: "stderr", Line: "two"},
+		{Stream: "stdout", Line: "three"},
+	}
+	svc := newTestPodmanService(rt)
+
+	stream := newContainerLogStream()
+	recorder := httptest.NewRecorder()
+	go svc.pumpContainerLogs(context.Background(), "abc123", containerLogOptions{Tail: 2}, stream)
+	serveContainerLogsSSE(context.Background(), recorder, stream)
+
+	body := recorder.Body.String()
+	if recorder.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", recorder.Header().Get("Content-Type"))
+	}
+	if strings.Contains(body, `"line":"one"`) || !strings.Contains(body, `"stream":"stderr","line":"two"`) || !strings.HasSuffix(body, "event: end\ndata: {\"type\":\"end\"}\n\n") {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+}
+
+func TestContainerLogStreamDropsSlowClients(t *testing.T) {
+	stream := newContainerLogStream()
+	for i := 0; i <= containerLogBufferSize; i++ {
+		stream.trySend(containerLogMessage{Type: "log"})
+	}
+
+	select {
+	case <-stream.closeCh:
+	default:
+		t.Fatal("expected stream to close once its buffer is full")
+	}
+}
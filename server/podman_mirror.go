@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	defaultWorkspaceMirrorRefreshInterval = time.Hour
+
+	workspaceMirrorsFailedMessage     = "Failed to load repository mirrors."
+	workspaceMirrorNotFoundMessage    = "Repository mirror not found."
+	workspaceMirrorInUseMessage       = "Repository mirror is in use."
+	workspaceMirrorEvictFailedMessage = "Failed to evict repository mirror."
+	workspaceMirrorsForbiddenMessage  = "Only admins can manage repository mirrors."
+)
+
+var (
+	errWorkspaceMirrorNotFound = errors.New("workspace mirror not found")
+	errWorkspaceMirrorInUse    = errors.New("workspace mirror in use")
+
+	workspaceMirrorKeyPattern = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+	// workspaceMirrorRefspecs limit mirrors to branches and tags, leaving out
+	// hosting refs such as GitHub's refs/pull/*.
+	workspaceMirrorRefspecs = []string{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+)
+
+var workspaceMirrorLocks sync.Map
+
+var workspaceMirrorsDir = filepath.Join(".", "mirrors")
+
+type workspaceMirror struct {
+	Key           string    `json:"key"`
+	URL           string    `json:"url"`
+	RemoteURL     string    `json:"remoteUrl"`
+	SizeBytes     int64     `json:"sizeBytes"`
+	CreatedAt     time.Time `json:"createdAt"`
+	LastFetchedAt time.Time `json:"lastFetchedAt,omitzero"`
+	LastUsedAt    time.Time `json:"lastUsedAt,omitzero"`
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+func resolveWorkspaceMirrorsEnabled() bool {
+	raw := strings.TrimSpace(strings.ToLower(os.Getenv("WORKSPACE_MIRRORS_ENABLED")))
+	return raw != "false" && raw != "0"
+}
+
+func resolveWorkspaceMirrorRefreshInterval() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("WORKSPACE_MIRROR_REFRESH_INTERVAL"))
+	if raw == "" {
+		return defaultWorkspaceMirrorRefreshInterval
+	}
+	interval, err := time.ParseDuration(raw)
+	if err != nil || interval < 0 {
+		return defaultWorkspaceMirrorRefreshInterval
+	}
+	return interval
+}
+
+func normalizeMirrorURL(repoURL string) string {
+	var host, repoPath string
+	if scpLikeGitPattern.MatchString(repoURL) {
+		idx := strings.Index(repoURL, ":")
+		host = strings.TrimPrefix(repoURL[:idx], "git@")
+		repoPath = repoURL[idx+1:]
+	} else {
+		parsed, err := url.Parse(repoURL)
+		if err != nil {
+			return ""
+		}
+		host = parsed.Host
+		repoPath = parsed.Path
+	}
+
+	repoPath = strings.Trim(repoPath, "/")
+	repoPath = strings.TrimSuffix(repoPath, ".git")
+	if host == "" || repoPath == "" {
+		return ""
+	}
+	return strings.ToLower(host) + "/" + repoPath
+}
+
+func workspaceMirrorKey(normalizedURL string) string {
+	sum := sha256.Sum256([]byte(normalizedURL))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+func sanitizeMirrorRemoteURL(repoURL string) string {
+	if scpLikeGitPattern.MatchString(repoURL) {
+		return repoURL
+	}
+	parsed, err := url.Parse(repoURL)
+	if err != nil || parsed.User == nil {
+		return repoURL
+	}
+	if strings.EqualFold(parsed.Scheme, "ssh") {
+		parsed.User = url.User(parsed.User.Username())
+	} else {
+		parsed.User = nil
+	}
+	return parsed.String()
+}
+
+func workspaceMirrorPath(key string) string {
+	return filepath.Join(workspaceMirrorsDir, key+".git")
+}
+
+func workspaceMirrorRecordPath(key string) string {
+	return filepath.Join(workspaceMirrorsDir, key+".json")
+}
+
+func workspaceMirrorLock(key string) *sync.RWMutex {
+	lock, _ := workspaceMirrorLocks.LoadOrStore(key, &sync.RWMutex{})
+	return lock.(*sync.RWMutex)
+}
+
+func prepareWorkspaceMirror(repoURL string, env []string) (string, func()) {
+	noop := func() {}
+	if !resolveWorkspaceMirrorsEnabled() {
+		return "", noop
+	}
+	normalized := normalizeMirrorURL(repoURL)
+	if normalized == "" {
+		return "", noop
+	}
+
+	key := workspaceMirrorKey(normalized)
+	lock := workspaceMirrorLock(key)
+	lock.Lock()
+	mirror, err := loadWorkspaceMirror(key)
+	mirrorPath := workspaceMirrorPath(key)
+	if err != nil {
+		if err := os.MkdirAll(workspaceMirrorsDir, 0o755); err != nil {
+			lock.Unlock()
+			return "", noop
+		}
+		_ = os.RemoveAll(mirrorPath)
+		if _, err := runWorkspaceCommand(env, "git", "init", "--bare", "--quiet", mirrorPath); err != nil {
+			lock.Unlock()
+			return "", noop
+		}
+		mirror = &workspaceMirror{Key: key, URL: normalized, CreatedAt: time.Now().UTC()}
+	}
+
+	now := time.Now().UTC()
+	mirror.RemoteURL = sanitizeMirrorRemoteURL(repoURL)
+	mirror.LastUsedAt = now
+	fetchErr := fetchWorkspaceMirror(mirrorPath, repoURL, env)
+	switch {
+	case fetchErr == nil:
+		mirror.LastFetchedAt = now
+		mirror.LastError = ""
+	case mirror.LastFetchedAt.IsZero():
+		_ = os.RemoveAll(mirrorPath)
+		_ = os.Remove(workspaceMirrorRecordPath(key))
+		lock.Unlock()
+		return "", noop
+	default:
+		mirror.LastError = fetchErr.Error()
+	}
+	_ = writeWorkspaceMirrorRecord(mirror)
+	lock.Unlock()
+
+	lock.RLock()
+	return mirrorPath, lock.RUnlock
+}
+
+func fetchWorkspaceMirror(mirrorPath string, remoteURL string, env []string) error {
+	args := append([]string{"-C", mirrorPath, "fetch", "--prune", "--quiet", remoteURL}, workspaceMirrorRefspecs...)
+	if output, err := runWorkspaceCommand(env, "git", args...); err != nil {
+		if detail := latestNonEmptyLine(string(output)); detail != "" {
+			return errors.New(detail)
+		}
+		return err
+	}
+	return nil
+}
+
+func writeWorkspaceMirrorRecord(mirror *workspaceMirror) error {
+	stored := *mirror
+	stored.SizeBytes = 0
+	encoded, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(workspaceMirrorRecordPath(mirror.Key), encoded, 0o644)
+}
+
+func loadWorkspaceMirror(key string) (*workspaceMirror, error) {
+	if !workspaceMirrorKeyPattern.MatchString(key) {
+		return nil, errWorkspaceMirrorNotFound
+	}
+	data, err := os.ReadFile(workspaceMirrorRecordPath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errWorkspaceMirrorNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var mirror workspaceMirror
+	if err := json.Unmarshal(data, &mirror); err != nil {
+		return nil, err
+	}
+	return &mirror, nil
+}
+
+func listWorkspaceMirrors() ([]workspaceMirror, error) {
+	entries, err := os.ReadDir(workspaceMirrorsDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []workspaceMirror{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mirrors := []workspaceMirror{}
+	for _, entry := range entries {
+		key, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		mirror, err := loadWorkspaceMirror(key)
+		if err != nil {
+			continue
+		}
+		mirror.SizeBytes = directorySize(workspaceMirrorPath(key))
+		mirrors = append(mirrors, *mirror)
+	}
+	sort.SliceStable(mirrors, func(i, j int) bool {
+		return mirrors[i].SizeBytes > mirrors[j].SizeBytes
+	})
+	return mirrors, nil
+}
+
+func directorySize(root string) int64 {
+	var size int64
+	_ = filepath.WalkDir(root, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if info, infoErr := entry.Info(); infoErr == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func evictWorkspaceMirror(key string) error {
+	if _, err := loadWorkspaceMirror(key); err != nil {
+		return err
+	}
+	lock := workspaceMirrorLock(key)
+	if !lock.TryLock() {
+		return errWorkspaceMirrorInUse
+	}
+	defer lock.Unlock()
+
+	if err := os.RemoveAll(workspaceMirrorPath(key)); err != nil {
+		return err
+	}
+	if err := os.Remove(workspaceMirrorRecordPath(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *podmanService) runMirrorRefresher(ctx context.Context) {
+	interval := resolveWorkspaceMirrorRefreshInterval()
+	if interval == 0 || !resolveWorkspaceMirrorsEnabled() {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.refreshWorkspaceMirrors()
+		}
+	}
+}
+
+func (s *podmanService) refreshWorkspaceMirrors() {
+	mirrors, err := listWorkspaceMirrors()
+	if err != nil {
+		return
+	}
+	env := []string{"GIT_TERMINAL_PROMPT=0", "GIT_SSH_COMMAND=ssh -o BatchMode=yes"}
+	for i := range mirrors {
+		mirror := &mirrors[i]
+		lock := workspaceMirrorLock(mirror.Key)
+		if !lock.TryLock() {
+			continue
+		}
+		if err := fetchWorkspaceMirror(workspaceMirrorPath(mirror.Key), mirror.RemoteURL, env); err != nil {
+			mirror.LastError = err.Error()
+			if s.app != nil {
+				s.app.Logger().Debug("Repository mirror refresh failed", "mirror", mirror.URL, "error", err)
+			}
+		} else {
+			mirror.LastFetchedAt = time.Now().UTC()
+			mirror.LastError = ""
+		}
+		_ = writeWorkspaceMirrorRecord(mirror)
+		lock.Unlock()
+	}
+}
+
+func registerWorkspaceMirrorRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/workspaces/mirrors", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+		if !newContainerAccess(re.Auth).Admin {
+			return re.JSON(http.StatusForbidden, map[string]string{
+				"message": workspaceMirrorsForbiddenMessage,
+			})
+		}
+
+		mirrors, err := listWorkspaceMirrors()
+		if err != nil {
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": workspaceMirrorsFailedMessage,
+			})
+		}
+
+		return re.JSON(http.StatusOK, mirrors)
+	})
+
+	rtr.DELETE("/podman/workspaces/mirrors/{key}", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+		if !newContainerAccess(re.Auth).Admin {
+			return re.JSON(http.StatusForbidden, map[string]string{
+				"message": workspaceMirrorsForbiddenMessage,
+			})
+		}
+
+		if err := evictWorkspaceMirror(strings.TrimSpace(re.Request.PathValue("key"))); err != nil {
+			switch {
+			case errors.Is(err, errWorkspaceMirrorNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": workspaceMirrorNotFoundMessage,
+				})
+			case errors.Is(err, errWorkspaceMirrorInUse):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": workspaceMirrorInUseMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": workspaceMirrorEvictFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusOK, map[string]string{
+			"status": "evicted",
+		})
+	})
+}
@@ -4,40 +4,11 @@ import (
 	"encoding/json"
 	"hash/fnv"
 	"io"
-	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
 )
 
-func listPodmanContainers() ([]podmanContainer, error) {
-	if _, err := exec.LookPath("podman"); err != nil {
-		return nil, errPodmanUnavailable
-	}
-
-	output, err := runPodmanList(true)
-	if err != nil {
-		output, err = runPodmanList(false)
-		if err != nil {
-			return nil, err
-		}
-	}
-	if len(output) == 0 {
-		return []podmanContainer{}, nil
-	}
-
-	return parsePodmanContainers(output)
-}
-
-func runPodmanList(includeSize bool) ([]byte, error) {
-	args := []string{"ps", "--all", "--format", "json"}
-	if includeSize {
-		args = append(args, "--size")
-	}
-	cmd := exec.Command("podman", args...)
-	return cmd.Output()
-}
-
 func parsePodmanContainers(output []byte) ([]podmanContainer, error) {
 	var raw []map[string]any
 	if err := json.Unmarshal(output, &raw); err != nil {
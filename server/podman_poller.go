@@ -1,12 +1,8 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
-	"io"
-	"os/exec"
 	"strings"
 	"time"
 )
@@ -74,47 +70,17 @@ func (s *podmanService) runEventListener(ctx context.Context) {
 }
 
 func (s *podmanService) streamEvents(ctx context.Context) error {
-	if _, err := exec.LookPath("podman"); err != nil {
-		return errPodmanUnavailable
-	}
-
-	cmd := exec.CommandContext(ctx, "podman", "events", "--format", "json")
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return err
-	}
-	cmd.Stderr = io.Discard
-
-	if err := cmd.Start(); err != nil {
-		return err
-	}
-
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
-
-		if s.applyEvent(line) {
-			continue
+	return s.runtime.Events(ctx, func(event podmanEvent) {
+		if s.applyEvent(event) {
+			return
 		}
 
 		s.schedulePoll(podmanPollDebounce)
-	}
-
-	if err := scanner.Err(); err != nil {
-		_ = cmd.Wait()
-		return err
-	}
-
-	return cmd.Wait()
+	})
 }
 
 func (s *podmanService) poll() {
-	containers, err := listPodmanContainers()
+	containers, err := s.runtime.List(context.Background())
 	if err != nil {
 		message := podmanLoadFailedMessage
 		if errors.Is(err, errPodmanUnavailable) {
@@ -136,9 +102,10 @@ func (s *podmanService) poll() {
 	}
 
 	normalizeContainers(containers)
-	discoveredTunnelStates := discoverTunnelStatesForContainers(containers)
+	discoveredTunnelStates := discoverTunnelStatesForContainers(s.runtime, containers)
 
 	s.mu.Lock()
+	applyContainerAdoptions(containers, s.adoptions)
 	mergeTunnelStateMap(s.tunnelStateByContainerID, discoveredTunnelStates)
 	pruneTunnelStateMap(s.tunnelStateByContainerID, containers)
 	enrichContainersWithTunnelState(containers, s.tunnelStateByContainerID)
@@ -167,12 +134,7 @@ func (s *podmanService) schedulePoll(delay time.Duration) {
 	}
 }
 
-func (s *podmanService) applyEvent(raw string) bool {
-	var event podmanEvent
-	if err := json.Unmarshal([]byte(raw), &event); err != nil {
-		return false
-	}
-
+func (s *podmanService) applyEvent(event podmanEvent) bool {
 	if strings.ToLower(event.Type) != "container" {
 		return false
 	}
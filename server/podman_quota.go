@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const workspaceQuotaExceededMessage = "Workspace quota exceeded."
+
+var errWorkspaceQuotaExceeded = errors.New("workspace quota exceeded")
+
+type workspaceQuota struct {
+	MaxWorkspaces int     `json:"maxWorkspaces"`
+	MaxRunning    int     `json:"maxRunning"`
+	MaxCPUs       float64 `json:"maxCpus"`
+	MaxMemory     int64   `json:"maxMemory"`
+}
+
+type workspaceUsage struct {
+	Workspaces int     `json:"workspaces"`
+	Running    int     `json:"running"`
+	CPUs       float64 `json:"cpus"`
+	Memory     int64   `json:"memory"`
+}
+
+type workspaceQuotaStatus struct {
+	Quota workspaceQuota `json:"quota"`
+	Usage workspaceUsage `json:"usage"`
+}
+
+type workspaceQuotaError struct {
+	Reason    string
+	Permanent bool
+	Status    workspaceQuotaStatus
+}
+
+func (e *workspaceQuotaError) Error() string {
+	return "workspace quota exceeded: " + e.Reason
+}
+
+func (e *workspaceQuotaError) Unwrap() error {
+	return errWorkspaceQuotaExceeded
+}
+
+func (e *workspaceQuotaError) response() map[string]any {
+	return map[string]any{
+		"message": workspaceQuotaExceededMessage + " " + e.Reason,
+		"quota":   e.Status.Quota,
+		"usage":   e.Status.Usage,
+	}
+}
+
+func (q workspaceQuota) reservation(limits containerLimits) (float64, int64) {
+	cpus, memory := limits.CPUs, limits.Memory
+	if cpus <= 0 {
+		cpus = q.MaxCPUs
+	}
+	if memory <= 0 {
+		memory = q.MaxMemory
+	}
+	return cpus, memory
+}
+
+var lookupWorkspaceQuota = func(app core.App, userID string) (workspaceQuota, error) {
+	if app == nil {
+		return workspaceQuota{}, nil
+	}
+
+	record, err := app.FindFirstRecordByFilter(CollectionWorkspaceQuotas, "user = {:user}", dbx.Params{"user": userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		user, userErr := app.FindRecordById(CollectionUsers, userID)
+		if userErr != nil {
+			return workspaceQuota{}, userErr
+		}
+		role := strings.TrimSpace(user.GetString("role"))
+		if role == "" {
+			role = RoleUser
+		}
+		record, err = app.FindFirstRecordByFilter(CollectionWorkspaceQuotas, "user = '' && role = {:role}", dbx.Params{"role": role})
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return workspaceQuota{}, nil
+	}
+	if err != nil {
+		return workspaceQuota{}, err
+	}
+
+	return workspaceQuota{
+		MaxWorkspaces: record.GetInt("max_workspaces"),
+		MaxRunning:    record.GetInt("max_running"),
+		MaxCPUs:       record.GetFloat("max_cpus"),
+		MaxMemory:     int64(record.GetInt("max_memory_mb")) << 20,
+	}, nil
+}
+
+func (s *podmanService) workspaceQuotaStatus(userID string) (workspaceQuotaStatus, error) {
+	quota, err := lookupWorkspaceQuota(s.app, userID)
+	if err != nil {
+		return workspaceQuotaStatus{}, err
+	}
+	if !s.runtime.Available() {
+		return workspaceQuotaStatus{}, errPodmanUnavailable
+	}
+	containers, err := s.runtime.List(context.Background())
+	if err != nil {
+		return workspaceQuotaStatus{}, err
+	}
+
+	s.mu.RLock()
+	applyContainerAdoptions(containers, s.adoptions)
+	s.mu.RUnlock()
+
+	return workspaceQuotaStatus{
+		Quota: quota,
+		Usage: computeWorkspaceUsage(containers, userID, quota),
+	}, nil
+}
+
+func computeWorkspaceUsage(containers []podmanContainer, userID string, quota workspaceQuota) workspaceUsage {
+	var usage workspaceUsage
+	for _, container := range containers {
+		if strings.TrimSpace(container.Labels[labelWorkspaceOwner]) != userID {
+			continue
+		}
+		usage.Workspaces++
+		if !isContainerStatusActive(container.Status) {
+			continue
+		}
+		usage.Running++
+		cpus, memory := quota.reservation(containerLimitsFromLabels(container.Labels))
+		usage.CPUs += cpus
+		usage.Memory += memory
+	}
+	return usage
+}
+
+func isContainerStatusActive(status string) bool {
+	status = strings.ToLower(strings.TrimSpace(status))
+	switch {
+	case status == "running", status == "paused", status == "up":
+		return true
+	case strings.HasPrefix(status, "up "):
+		return true
+	default:
+		return false
+	}
+}
+
+func checkWorkspaceCreate(status workspaceQuotaStatus, limits containerLimits) error {
+	quota, usage := status.Quota, status.Usage
+	if quota.MaxWorkspaces > 0 && usage.Workspaces >= quota.MaxWorkspaces {
+		return &workspaceQuotaError{
+			Reason: fmt.Sprintf("You already have %d of %d workspaces.", usage.Workspaces, quota.MaxWorkspaces),
+			Status: status,
+		}
+	}
+	return checkWorkspaceStart(status, limits)
+}
+
+func checkWorkspaceStart(status workspaceQuotaStatus, limits containerLimits) error {
+	quota, usage := status.Quota, status.Usage
+	cpus, memory := quota.reservation(limits)
+
+	switch {
+	case quota.MaxCPUs > 0 && cpus > quota.MaxCPUs:
+		return &workspaceQuotaError{
+			Reason:    fmt.Sprintf("The workspace needs %g CPUs but the quota allows %g.", cpus, quota.MaxCPUs),
+			Permanent: true,
+			Status:    status,
+		}
+	case quota.MaxMemory > 0 && memory > quota.MaxMemory:
+		return &workspaceQuotaError{
+			Reason:    fmt.Sprintf("The workspace needs %s of memory but the quota allows %s.", formatWorkspaceSize(memory), formatWorkspaceSize(quota.MaxMemory)),
+			Permanent: true,
+			Status:    status,
+		}
+	case quota.MaxRunning > 0 && usage.Running >= quota.MaxRunning:
+		return &workspaceQuotaError{
+			Reason: fmt.Sprintf("You already have %d of %d workspaces running.", usage.Running, quota.MaxRunning),
+			Status: status,
+		}
+	case quota.MaxCPUs > 0 && usage.CPUs+cpus > quota.MaxCPUs:
+		return &workspaceQuotaError{
+			Reason: fmt.Sprintf("Running workspaces already reserve %g of %g CPUs.", usage.CPUs, quota.MaxCPUs),
+			Status: status,
+		}
+	case quota.MaxMemory > 0 && usage.Memory+memory > quota.MaxMemory:
+		return &workspaceQuotaError{
+			Reason: fmt.Sprintf("Running workspaces already reserve %s of %s memory.", formatWorkspaceSize(usage.Memory), formatWorkspaceSize(quota.MaxMemory)),
+			Status: status,
+		}
+	}
+	return nil
+}
+
+func quotaErrorStatus(err *workspaceQuotaError) int {
+	if err.Permanent {
+		return http.StatusForbidden
+	}
+	return http.StatusTooManyRequests
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+func stubWorkspaceQuota(t *testing.T, quota workspaceQuota) {
+	t.Helper()
+	original := lookupWorkspaceQuota
+	t.Cleanup(func() { lookupWorkspaceQuota = original })
+	lookupWorkspaceQuota = func(core.App, string) (workspaceQuota, error) { return quota, nil }
+}
+
+func TestComputeWorkspaceUsage(t *testing.T) {
+	quota := workspaceQuota{MaxCPUs: 4, MaxMemory: 8 << 30}
+	containers := []podmanContainer{
+		{ID: "a", Status: "Up 3 minutes", Labels: map[string]string{labelWorkspaceOwner: "user-1", labelWorkspaceCPUs: "1", labelWorkspaceMemory: "1073741824"}},
+		{ID: "b", Status: "running", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+		{ID: "c", Status: "Exited (0) 2 hours ago", Labels: map[string]string{labelWorkspaceOwner: "user-1", labelWorkspaceCPUs: "2"}},
+		{ID: "d", Status: "running", Labels: map[string]string{labelWorkspaceOwner: "user-2", labelWorkspaceCPUs: "2"}},
+	}
+
+	usage := computeWorkspaceUsage(containers, "user-1", quota)
+	want := workspaceUsage{Workspaces: 3, Running: 2, CPUs: 5, Memory: 9 << 30}
+	if usage != want {
+		t.Fatalf("unexpected usage: got %+v want %+v", usage, want)
+	}
+}
+
+func TestIsContainerStatusActive(t *testing.T) {
+	for _, status := range []string{"running", "Paused", "Up 2 seconds", "Up About a minute (Paused)"} {
+		if !isContainerStatusActive(status) {
+			t.Fatalf("expected %q to be active", status)
+		}
+	}
+	for _, status := range []string{"exited", "Created", "Exited (137) 5 minutes ago", "", "upgrading"} {
+		if isContainerStatusActive(status) {
+			t.Fatalf("expected %q to be inactive", status)
+		}
+	}
+}
+
+func TestCheckWorkspaceQuota(t *testing.T) {
+	cases := []struct {
+		name   string
+		quota  workspaceQuota
+		usage  workspaceUsage
+		limits containerLimits
+		status int
+	}{
+		{name: "unlimited", usage: workspaceUsage{Workspaces: 50, Running: 50}},
+		{name: "workspace count", quota: workspaceQuota{MaxWorkspaces: 2}, usage: workspaceUsage{Workspaces: 2}, status: http.StatusTooManyRequests},
+		{name: "running count", quota: workspaceQuota{MaxRunning: 1}, usage: workspaceUsage{Workspaces: 1, Running: 1}, status: http.StatusTooManyRequests},
+		{name: "cpus reserved", quota: workspaceQuota{MaxCPUs: 4}, usage: workspaceUsage{CPUs: 3}, limits: containerLimits{CPUs: 2}, status: http.StatusTooManyRequests},
+		{name: "cpus fit", quota: workspaceQuota{MaxCPUs: 4}, usage: workspaceUsage{CPUs: 2}, limits: containerLimits{CPUs: 2}},
+		{name: "unlimited memory reserves quota", quota: workspaceQuota{MaxMemory: 4 << 30}, usage: workspaceUsage{Memory: 1 << 30}, status: http.StatusTooManyRequests},
+		{name: "larger than quota", quota: workspaceQuota{MaxMemory: 4 << 30}, limits: containerLimits{Memory: 8 << 30}, status: http.StatusForbidden},
+	}
+
+	for _, tc := range cases {
+		err := checkWorkspaceCreate(workspaceQuotaStatus{Quota: tc.quota, Usage: tc.usage}, tc.limits)
+		if tc.status == 0 {
+			if err != nil {
+				t.Fatalf("%s: expected no error, got %v", tc.name, err)
+			}
+			continue
+		}
+		var quotaErr *workspaceQuotaError
+		if !errors.As(err, &quotaErr) || !errors.Is(err, errWorkspaceQuotaExceeded) {
+			t.Fatalf("%s: expected quota error, got %v", tc.name, err)
+		}
+		if got := quotaErrorStatus(quotaErr); got != tc.status {
+			t.Fatalf("%s: expected status %d, got %d", tc.name, tc.status, got)
+		}
+		if quotaErr.Status.Usage != tc.usage {
+			t.Fatalf("%s: expected usage in error, got %+v", tc.name, quotaErr.Status.Usage)
+		}
+	}
+}
+
+func TestCreateWorkspaceEnforcesQuota(t *testing.T) {
+	stubWorkspaceQuota(t, workspaceQuota{MaxWorkspaces: 1})
+
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{
+		{ID: "abc123", Name: "ws-one", Status: "exited", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+	}
+	svc := newTestPodmanService(rt)
+
+	_, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-two",
+	}, nil)
+	var quotaErr *workspaceQuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Status.Usage.Workspaces != 1 {
+		t.Fatalf("expected workspace quota error, got %v", err)
+	}
+	if len(rt.created) != 0 {
+		t.Fatalf("expected nothing created, got %v", rt.created)
+	}
+}
+
+func TestStartContainerEnforcesOwnerQuota(t *testing.T) {
+	stubWorkspaceQuota(t, workspaceQuota{MaxRunning: 1})
+
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{
+		{ID: "abc123", Name: "ws-one", Status: "running", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+		{ID: "def456", Name: "ws-two", Status: "exited", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+	}
+	svc := newTestPodmanService(rt)
+
+	admin := containerAccess{UserID: "admin-1", Admin: true}
+	if err := svc.startContainer(admin, "def456"); !errors.Is(err, errWorkspaceQuotaExceeded) {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+	if err := svc.restartContainer(admin, "def456"); !errors.Is(err, errWorkspaceQuotaExceeded) {
+		t.Fatalf("expected restart of a stopped workspace to hit the quota, got %v", err)
+	}
+	if err := svc.restartContainer(admin, "abc123"); err != nil {
+		t.Fatalf("expected restart of a running workspace to skip quota, got %v", err)
+	}
+	if err := svc.startContainer(admin, "abc123"); err != nil {
+		t.Fatalf("expected already-running start to skip quota, got %v", err)
+	}
+
+	if err := svc.stopContainer(admin, "abc123"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := svc.startContainer(admin, "def456"); err != nil {
+		t.Fatalf("expected start within quota, got %v", err)
+	}
+}
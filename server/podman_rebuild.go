@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	// labelWorkspaceEnvKeys names the env a workspace was created with.
+	// Values stay out of labels since labels are listed to clients.
+	labelWorkspaceEnvKeys = "pocketpod.env_keys"
+
+	workspaceNotRebuildableMessage = "Only workspaces created from a repository can be rebuilt or snapshotted."
+	workspaceRebuildBusyMessage    = "Workspace is already being rebuilt."
+	workspaceRepoMissingMessage    = "Workspace repository directory is missing."
+)
+
+var (
+	errWorkspaceNotRebuildable = errors.New("workspace is not rebuildable")
+	errWorkspaceRebuildBusy    = errors.New("workspace rebuild already running")
+	errWorkspaceRepoMissing    = errors.New("workspace repository directory is missing")
+)
+
+type rebuildWorkspacePayload struct {
+	Image string `json:"image"`
+}
+
+type workspaceRebuild struct {
+	ContainerID string
+	Name        string
+	Owner       string
+	Labels      map[string]string
+	Env         map[string]string
+	Mounts      []string
+	Image       string
+	ImageID     string
+}
+
+func newWorkspaceRebuild(inspected podmanInspectSummary) (*workspaceRebuild, error) {
+	labels := inspected.Config.Labels
+	owner := strings.TrimSpace(labels[labelWorkspaceOwner])
+	for _, key := range []string{labelWorkspaceRepo, labelWorkspaceDir, labelWorkspaceHome} {
+		if owner == "" || strings.TrimSpace(labels[key]) == "" {
+			return nil, errWorkspaceNotRebuildable
+		}
+	}
+
+	rebuild := &workspaceRebuild{
+		ContainerID: inspected.ID,
+		Name:        strings.TrimPrefix(strings.TrimSpace(inspected.Name), "/"),
+		Owner:       owner,
+		Labels:      make(map[string]string, len(labels)),
+		Image:       labels[labelWorkspaceImage],
+		ImageID:     inspected.Image,
+	}
+	for key, value := range labels {
+		if key != labelAdopted {
+			rebuild.Labels[key] = value
+		}
+	}
+
+	// The rest of the container's env comes from the old image and would
+	// override what the new image sets.
+	created := map[string]bool{}
+	for _, key := range strings.Split(labels[labelWorkspaceEnvKeys], ",") {
+		created[key] = key != ""
+	}
+	rebuild.Env = map[string]string{}
+	for _, entry := range inspected.Config.Env {
+		if key, value, ok := strings.Cut(entry, "="); ok && created[key] {
+			rebuild.Env[key] = value
+		}
+	}
+
+	for _, mount := range inspected.Mounts {
+		switch strings.ToLower(mount.Type) {
+		case "volume":
+			arg := "type=volume,src=" + mount.Name + ",dst=" + mount.Destination
+			if !mount.RW {
+				arg += ",ro=true"
+			}
+			rebuild.Mounts = append(rebuild.Mounts, arg)
+		case "tmpfs":
+			rebuild.Mounts = append(rebuild.Mounts, "type=tmpfs,dst="+mount.Destination)
+		}
+	}
+	return rebuild, nil
+}
+
+func (s *podmanService) startWorkspaceRebuild(access containerAccess, containerID string, payload rebuildWorkspacePayload) (*workspaceJob, error) {
+	if !s.runtime.Available() {
+		return nil, errPodmanUnavailable
+	}
+	inspected, err := s.authorizeContainer(access, containerID)
+	if err != nil {
+		return nil, err
+	}
+	rebuild, err := newWorkspaceRebuild(inspected)
+	if err != nil {
+		return nil, err
+	}
+	// Rebuilding a stopped workspace starts it.
+	if err := s.checkContainerStartQuota(inspected); err != nil {
+		return nil, err
+	}
+	if payload.Image != "" {
+		image, err := s.resolveWorkspaceImage(payload.Image)
+		if err != nil {
+			return nil, err
+		}
+		rebuild.Image = image.Image
+	}
+
+	job := &workspaceJob{
+		ID:          generateSessionID(),
+		Kind:        workspaceJobKindRebuild,
+		Owner:       rebuild.Owner,
+		Name:        rebuild.Name,
+		RepoURL:     rebuild.Labels[labelWorkspaceRepo],
+		Ref:         rebuild.Labels[labelWorkspaceRef],
+		Status:      workspaceJobStatusRunning,
+		Phases:      []workspaceJobPhase{},
+		ContainerID: rebuild.ContainerID,
+		StartedAt:   time.Now().UTC(),
+	}
+
+	s.jobsMu.Lock()
+	for _, other := range s.jobs {
+		if other.Status == workspaceJobStatusRunning && other.ContainerID != "" && isContainerIDMatch(other.ContainerID, rebuild.ContainerID) {
+			s.jobsMu.Unlock()
+			return nil, errWorkspaceRebuildBusy
+		}
+	}
+	s.pruneWorkspaceJobsLocked(job.StartedAt)
+	s.jobs[job.ID] = job
+	snapshot := job.snapshot()
+	s.jobsMu.Unlock()
+
+	s.publishWorkspaceJob(snapshot)
+	go s.runWorkspaceJob(job, func() (*createWorkspaceResponse, error) {
+		return s.rebuildWorkspace(rebuild, payload.Image != "", job)
+	})
+	return snapshot, nil
+}
+
+func (s *podmanService) rebuildWorkspace(rebuild *workspaceRebuild, imageRequested bool, job *workspaceJob) (_ *createWorkspaceResponse, err error) {
+	owner := rebuild.Owner
+	labels := rebuild.Labels
+	workspaceDirName := labels[labelWorkspaceDir]
+	workspaceHomeTarget := strings.TrimRight(labels[labelWorkspaceHome], "/")
+
+	repoPath, err := resolveWorkspaceRepoPath(owner, workspaceDirName)
+	if err != nil {
+		return nil, err
+	}
+	workspaceHostPath := filepath.Dir(repoPath)
+	if info, err := os.Stat(repoPath); err != nil || !info.IsDir() {
+		return nil, errWorkspaceRepoMissing
+	}
+	volumeHostPath, err := ensureWorkspaceVSCodeVolumePath(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	devcontainer, warnings := readWorkspaceDevcontainer(repoPath)
+	payload := createWorkspacePayload{RepoURL: labels[labelWorkspaceRepo], Ref: labels[labelWorkspaceRef]}
+
+	ctx := context.Background()
+	image := rebuild.Image
+	var build *workspaceBuild
+	if labels[labelWorkspaceBuild] != "" && !imageRequested {
+		buildSpec, specErr := devcontainer.buildSpec(repoPath)
+		switch {
+		case specErr != nil:
+			return nil, fmt.Errorf("devcontainer.json build: %w", specErr)
+		case buildSpec == nil:
+			defaultImage, err := s.resolveWorkspaceImage("")
+			if err != nil {
+				return nil, err
+			}
+			image = defaultImage.Image
+			warnings = append(warnings, fmt.Sprintf("devcontainer.json no longer has a build; using %q instead.", image))
+		case !resolveWorkspaceBuildsEnabled():
+			warnings = append(warnings, "devcontainer.json build was skipped because image builds are disabled.")
+		default:
+			s.enterWorkspaceJobPhase(job, workspaceJobPhaseBuilding)
+			build, err = s.buildWorkspaceImage(owner, payload, *buildSpec)
+			if err != nil {
+				return nil, err
+			}
+			image = build.Image
+		}
+	}
+	if build == nil {
+		s.enterWorkspaceJobPhase(job, workspaceJobPhasePulling)
+		policy := imagePullNewer
+		if strings.HasPrefix(image, "localhost/") {
+			// Built and snapshot images only exist locally.
+			policy = imagePullMissing
+		}
+		if err := s.runtime.Pull(ctx, image, policy); err != nil {
+			return nil, fmt.Errorf("%w: %v", errWorkspacePullFailed, err)
+		}
+	}
+
+	mounts := []string{
+		formatWorkspaceMountArg(workspaceHostPath, workspaceHomeTarget+"/workspaces"),
+		formatWorkspaceVSCodeMountArg(volumeHostPath, workspaceHomeTarget+"/.vscode"),
+	}
+	mounts = append(mounts, rebuild.Mounts...)
+
+	rollback := s.newWorkspaceRollback(job)
+	defer func() {
+		err = rollback.release(err)
+	}()
+
+	if rebuild.ContainerID != "" {
+		// The old container is described before labels change below, so it
+		// can be created again on its own image if the rebuild fails.
+		original := containerCreateSpec{
+			Name:    rebuild.Name,
+			Image:   rebuild.ImageID,
+			Mounts:  mounts,
+			Env:     rebuild.Env,
+			Labels:  make(map[string]string, len(labels)),
+			Command: []string{"sh", "-lc", defaultWorkspaceCommand},
+			Limits:  containerLimitsFromLabels(labels),
+		}
+		if original.Image == "" {
+			original.Image = rebuild.Image
+		}
+		for key, value := range labels {
+			original.Labels[key] = value
+		}
+
+		rollback.enter(workspaceJobPhaseRemoving)
+		if err := s.runtime.Remove(ctx, rebuild.ContainerID, true); err != nil && !errors.Is(err, errPodmanContainerNotFound) {
+			return nil, err
+		}
+		s.stopTunnelMonitor(rebuild.ContainerID)
+		s.clearTunnelState(rebuild.ContainerID)
+		s.forgetAdoption(rebuild.ContainerID)
+		s.schedulePoll(podmanPollDebounce)
+		rollback.acquired("previous container", func() error {
+			return s.restoreRebuiltWorkspace(original, job)
+		})
+	}
+
+	rollback.enter(workspaceJobPhaseCreating)
+	labels[labelWorkspaceImage] = image
+	delete(labels, labelWorkspaceEnvKeys)
+	if len(rebuild.Env) > 0 {
+		labels[labelWorkspaceEnvKeys] = strings.Join(sortedMapKeys(rebuild.Env), ",")
+	}
+	delete(labels, labelWorkspaceBuild)
+	if build != nil {
+		labels[labelWorkspaceBuild] = build.ID
+	}
+	sessionID := generateSessionID()
+	labels[labelTunnelSession] = sessionID
+
+	limits := containerLimitsFromLabels(labels)
+	containerID, err := s.runtime.Create(ctx, containerCreateSpec{
+		Name:    rebuild.Name,
+		Image:   image,
+		Mounts:  mounts,
+		Env:     rebuild.Env,
+		Labels:  labels,
+		Command: []string{"sh", "-lc", defaultWorkspaceCommand},
+		Limits:  limits,
+	})
+	if err != nil {
+		if errors.Is(err, errContainerNameConflict) {
+			return nil, errWorkspaceNameConflict
+		}
+		return nil, err
+	}
+	s.setWorkspaceJobContainer(job, containerID)
+	rollback.acquired("container", func() error {
+		if err := s.runtime.Remove(context.Background(), containerID, true); err != nil && !errors.Is(err, errPodmanContainerNotFound) {
+			return err
+		}
+		s.schedulePoll(podmanPollDebounce)
+		return nil
+	})
+
+	rollback.enter(workspaceJobPhaseStarting)
+	if err := s.runtime.Start(ctx, containerID); err != nil && !errors.Is(err, errContainerAlreadyRunning) {
+		return nil, fmt.Errorf("%w: %v", errWorkspaceStartFailed, err)
+	}
+	name, status := inspectCreatedContainer(s.runtime, containerID)
+	if name == "" {
+		name = rebuild.Name
+	}
+	if status == "" {
+		status = "Running"
+	}
+
+	if identity, identityErr := lookupWorkspaceIdentity(s.app, owner); identityErr != nil {
+		warnings = append(warnings, fmt.Sprintf("Git identity could not be loaded: %v.", identityErr))
+	} else if !identity.isZero() {
+		rollback.enter(workspaceJobPhaseConfiguringGit)
+		warnings = append(warnings, s.installWorkspaceIdentity(containerID, identity)...)
+	}
+
+	tunnelState := s.bootstrapTunnel(containerID, name, sessionID, job)
+	if tunnelState.Status == "" {
+		tunnelState.Status = tunnelStatusStarting
+	}
+	if tunnelState.Status == tunnelStatusFailed {
+		s.failWorkspaceJobPhase(job, tunnelState.Message)
+	}
+	if s.setTunnelState(containerID, tunnelState) {
+		s.schedulePoll(podmanPollDebounce)
+	}
+	if tunnelState.Status == tunnelStatusStarting {
+		s.startTunnelMonitor(containerID, sessionID, volumeHostPath)
+	}
+
+	// The new container starts from a clean image, so postCreateCommand
+	// runs again from the repository's current devcontainer.json.
+	localFolder, err := filepath.Abs(repoPath)
+	if err != nil {
+		localFolder = repoPath
+	}
+	resolvedDevcontainer := devcontainer.resolve(devcontainerContext{
+		UserID:          owner,
+		LocalFolder:     localFolder,
+		ContainerFolder: workspaceHomeTarget + "/workspaces/" + workspaceDirName,
+	})
+	if len(resolvedDevcontainer.PostCreate) > 0 || len(resolvedDevcontainer.PostStart) > 0 {
+		rollback.enter(workspaceJobPhaseRunningHooks)
+	}
+	warnings = append(warnings, s.runDevcontainerCommands(containerID, "postCreateCommand", resolvedDevcontainer.PostCreate)...)
+	warnings = append(warnings, s.runDevcontainerCommands(containerID, "postStartCommand", resolvedDevcontainer.PostStart)...)
+
+	response := &createWorkspaceResponse{
+		Name:         name,
+		Status:       status,
+		RepoURL:      labels[labelWorkspaceRepo],
+		Ref:          labels[labelWorkspaceRef],
+		Branch:       labels[labelWorkspaceBranch],
+		Image:        image,
+		Build:        build,
+		ForwardPorts: resolvedDevcontainer.ForwardPorts,
+		Tunnel:       workspaceTunnelSnapshot(tunnelState),
+		Warnings:     warnings,
+	}
+	if !limits.isZero() {
+		response.Resources = &limits
+	}
+	return response, nil
+}
+
+func (s *podmanService) restoreRebuiltWorkspace(original containerCreateSpec, job *workspaceJob) error {
+	ctx := context.Background()
+	containerID, err := s.runtime.Create(ctx, original)
+	if err != nil {
+		return err
+	}
+	s.setWorkspaceJobContainer(job, containerID)
+	if err := s.runtime.Start(ctx, containerID); err != nil && !errors.Is(err, errContainerAlreadyRunning) {
+		return err
+	}
+	s.schedulePoll(podmanPollDebounce)
+
+	if sessionID := strings.TrimSpace(original.Labels[labelTunnelSession]); sessionID != "" {
+		var inspected podmanInspectSummary
+		inspected.Name = original.Name
+		inspected.Config.Labels = original.Labels
+		s.rebootstrapTunnel(containerID, inspected, sessionID)
+	}
+	return nil
+}
+
+func registerWorkspaceRebuildRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.POST("/podman/workspaces/{id}/rebuild", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		var payload rebuildWorkspacePayload
+		if re.Request.ContentLength != 0 {
+			if err := re.BindBody(&payload); err != nil {
+				return re.JSON(http.StatusBadRequest, map[string]string{
+					"message": "Invalid rebuild payload.",
+				})
+			}
+		}
+		payload.Image = strings.TrimSpace(payload.Image)
+
+		job, err := svc.startWorkspaceRebuild(newContainerAccess(re.Auth), containerID, payload)
+		if err != nil {
+			var quotaErr *workspaceQuotaError
+			switch {
+			case errors.As(err, &quotaErr):
+				return re.JSON(quotaErrorStatus(quotaErr), quotaErr.response())
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
+			}
+			status, message := workspaceCreateErrorStatus(err)
+			return re.JSON(status, map[string]string{
+				"message": message,
+			})
+		}
+
+		re.Response.Header().Set("Location", "/podman/workspaces/jobs/"+job.ID)
+		return re.JSON(http.StatusAccepted, job)
+	})
+}
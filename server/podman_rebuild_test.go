@@ -0,0 +1,245 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// createRebuildableWorkspace creates a workspace with the fake runtime and
+// the repository directory that the stubbed clone does not create.
+func createRebuildableWorkspace(t *testing.T, rt *fakeRuntime, svc *podmanService) podmanContainer {
+	t.Helper()
+	if _, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-one",
+		Env:     map[string]string{"APP_ENV": "dev"},
+	}, nil); err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	container := rt.containers[len(rt.containers)-1]
+	repoPath := filepath.Join("volumes", "user-1", "workspaces", container.Labels[labelWorkspaceDir])
+	if err := os.MkdirAll(repoPath, 0o755); err != nil {
+		t.Fatalf("mkdir repo: %v", err)
+	}
+	return container
+}
+
+func TestRebuildWorkspaceRecreatesContainer(t *testing.T) {
+	stubWorkspaceClone(t)
+	calls := recordWorkspaceCommands(t, nil)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	old := createRebuildableWorkspace(t, rt, svc)
+	*calls = nil
+	rt.pulls, rt.pullPolicies = nil, nil
+
+	started, err := svc.startWorkspaceRebuild(containerAccess{UserID: "user-1"}, old.ID, rebuildWorkspacePayload{})
+	if err != nil {
+		t.Fatalf("start rebuild: %v", err)
+	}
+	job := waitForWorkspaceJob(t, svc, started.ID)
+	if job.Status != workspaceJobStatusSucceeded || job.Kind != workspaceJobKindRebuild {
+		t.Fatalf("expected succeeded rebuild job, got %+v", job)
+	}
+	if len(*calls) != 0 {
+		t.Fatalf("expected no git commands during rebuild, got %v", *calls)
+	}
+	if !reflect.DeepEqual(rt.pullPolicies, []string{imagePullNewer}) {
+		t.Fatalf("expected one pull for a newer image, got %v", rt.pullPolicies)
+	}
+
+	if len(rt.containers) != 1 || rt.containers[0].ID == old.ID || rt.containers[0].Name != "ws-one" {
+		t.Fatalf("expected ws-one replaced by a new container, got %+v", rt.containers)
+	}
+	if job.ContainerID != rt.containers[0].ID {
+		t.Fatalf("expected job to point at the new container, got %q", job.ContainerID)
+	}
+
+	spec := rt.created[len(rt.created)-1]
+	if spec.Env["APP_ENV"] != "dev" {
+		t.Fatalf("expected env kept, got %v", spec.Env)
+	}
+	if spec.Labels[labelWorkspaceEnvKeys] != "APP_ENV" {
+		t.Fatalf("expected env names recorded, got %q", spec.Labels[labelWorkspaceEnvKeys])
+	}
+	for key, value := range spec.Labels {
+		if key != labelWorkspaceEnvKeys && strings.Contains(value, "APP_ENV") {
+			t.Fatalf("expected env values kept out of labels, got %s=%q", key, value)
+		}
+	}
+	for _, key := range []string{labelWorkspaceRepo, labelWorkspaceDir, labelWorkspaceHome} {
+		if spec.Labels[key] != old.Labels[key] {
+			t.Fatalf("expected label %s=%q kept, got %q", key, old.Labels[key], spec.Labels[key])
+		}
+	}
+	if spec.Labels[labelTunnelSession] == "" || spec.Labels[labelTunnelSession] == old.Labels[labelTunnelSession] {
+		t.Fatalf("expected a new tunnel session, got %q", spec.Labels[labelTunnelSession])
+	}
+	home := old.Labels[labelWorkspaceHome]
+	if len(spec.Mounts) != 2 || parseMountArg(spec.Mounts[0]).Target != home+"/workspaces" || parseMountArg(spec.Mounts[1]).Target != home+"/.vscode" {
+		t.Fatalf("expected repo and VS Code mounts under %s, got %v", home, spec.Mounts)
+	}
+}
+
+func TestRebuildWorkspaceKeepsContainerWhenPullFails(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	old := createRebuildableWorkspace(t, rt, svc)
+	rt.pullErr = errors.New("registry unreachable")
+
+	started, err := svc.startWorkspaceRebuild(containerAccess{UserID: "user-1"}, old.ID, rebuildWorkspacePayload{})
+	if err != nil {
+		t.Fatalf("start rebuild: %v", err)
+	}
+	job := waitForWorkspaceJob(t, svc, started.ID)
+	if job.Status != workspaceJobStatusFailed || job.Phase != workspaceJobPhasePulling {
+		t.Fatalf("expected rebuild to fail while pulling, got %+v", job)
+	}
+	if len(rt.containers) != 1 || rt.containers[0].ID != old.ID {
+		t.Fatalf("expected old container kept, got %+v", rt.containers)
+	}
+}
+
+func TestRebuildWorkspaceRestoresContainerWhenStartFails(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	old := createRebuildableWorkspace(t, rt, svc)
+	rt.startErr = errors.New("oci runtime error")
+	rt.startErrOnce = true
+
+	started, err := svc.startWorkspaceRebuild(containerAccess{UserID: "user-1"}, old.ID, rebuildWorkspacePayload{})
+	if err != nil {
+		t.Fatalf("start rebuild: %v", err)
+	}
+	job := waitForWorkspaceJob(t, svc, started.ID)
+	if job.Status != workspaceJobStatusFailed || job.FailedStep != workspaceJobPhaseStarting {
+		t.Fatalf("expected rebuild to fail while starting, got %+v", job)
+	}
+	if want := []string{"container", "previous container"}; job.Cleanup == nil || !job.Cleanup.Completed || !reflect.DeepEqual(job.Cleanup.Released, want) {
+		t.Fatalf("expected %v released, got %+v", want, job.Cleanup)
+	}
+
+	if len(rt.containers) != 1 || rt.containers[0].Name != "ws-one" || rt.containers[0].Status != "running" {
+		t.Fatalf("expected ws-one created again and running, got %+v", rt.containers)
+	}
+	if job.ContainerID != rt.containers[0].ID {
+		t.Fatalf("expected job to point at the restored container, got %q", job.ContainerID)
+	}
+	spec := rt.created[len(rt.created)-1]
+	if spec.Env["APP_ENV"] != "dev" || spec.Labels[labelTunnelSession] != old.Labels[labelTunnelSession] {
+		t.Fatalf("expected the old env and tunnel session restored, got %+v", spec)
+	}
+}
+
+func TestStartWorkspaceRebuildEnforcesQuota(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	old := createRebuildableWorkspace(t, rt, svc)
+	if err := svc.stopContainer(containerAccess{UserID: "user-1"}, old.ID); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	rt.containers = append(rt.containers, podmanContainer{ID: "def456", Name: "ws-two", Status: "running", Labels: map[string]string{labelWorkspaceOwner: "user-1"}})
+	svc.poll()
+	stubWorkspaceQuota(t, workspaceQuota{MaxRunning: 1})
+
+	if _, err := svc.startWorkspaceRebuild(containerAccess{UserID: "user-1"}, old.ID, rebuildWorkspacePayload{}); !errors.Is(err, errWorkspaceQuotaExceeded) {
+		t.Fatalf("expected rebuilding a stopped workspace to hit the quota, got %v", err)
+	}
+	if len(rt.containers) != 2 || rt.containers[0].ID != old.ID {
+		t.Fatalf("expected old container kept, got %+v", rt.containers)
+	}
+}
+
+func TestStartWorkspaceRebuildRejectsUnrebuildable(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{{ID: "abc123", Name: "plain", Labels: map[string]string{labelWorkspaceOwner: "user-1"}}}
+	svc := newTestPodmanService(rt)
+
+	if _, err := svc.startWorkspaceRebuild(containerAccess{UserID: "user-1"}, "abc123", rebuildWorkspacePayload{}); !errors.Is(err, errWorkspaceNotRebuildable) {
+		t.Fatalf("expected not rebuildable, got %v", err)
+	}
+	if _, err := svc.startWorkspaceRebuild(containerAccess{UserID: "user-2"}, "abc123", rebuildWorkspacePayload{}); !errors.Is(err, errContainerForbidden) {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+}
+
+func TestNewWorkspaceRebuildKeepsCreationEnv(t *testing.T) {
+	var inspected podmanInspectSummary
+	inspected.ID = "abc123"
+	inspected.Name = "/ws-one"
+	inspected.Config.Labels = map[string]string{
+		labelWorkspaceOwner:   "user-1",
+		labelWorkspaceRepo:    "https://github.com/org/repo.git",
+		labelWorkspaceDir:     "repo",
+		labelWorkspaceHome:    "/home/ubuntu",
+		labelAdopted:          "true",
+		labelWorkspaceEnvKeys: "APP_ENV,EMPTY",
+	}
+	inspected.Config.Env = []string{"PATH=/usr/bin", "HOSTNAME=abc123", "JAVA_HOME=/opt/jdk17", "APP_ENV=dev", "EMPTY="}
+	inspected.Mounts = append(inspected.Mounts,
+		struct {
+			Type        string `json:"Type"`
+			Name        string `json:"Name"`
+			Source      string `json:"Source"`
+			Destination string `json:"Destination"`
+			Mode        string `json:"Mode"`
+			RW          bool   `json:"RW"`
+		}{Type: "bind", Source: "/srv/volumes/user-1/workspaces", Destination: "/home/ubuntu/workspaces", RW: true},
+		struct {
+			Type        string `json:"Type"`
+			Name        string `json:"Name"`
+			Source      string `json:"Source"`
+			Destination string `json:"Destination"`
+			Mode        string `json:"Mode"`
+			RW          bool   `json:"RW"`
+		}{Type: "volume", Name: "pocketpod-user-1-cache", Destination: "/cache", RW: true},
+	)
+
+	rebuild, err := newWorkspaceRebuild(inspected)
+	if err != nil {
+		t.Fatalf("new rebuild: %v", err)
+	}
+	if rebuild.Name != "ws-one" {
+		t.Fatalf("expected name without slash, got %q", rebuild.Name)
+	}
+	if want := map[string]string{"APP_ENV": "dev", "EMPTY": ""}; !reflect.DeepEqual(rebuild.Env, want) {
+		t.Fatalf("expected env %v, got %v", want, rebuild.Env)
+	}
+	if want := []string{"type=volume,src=pocketpod-user-1-cache,dst=/cache"}; !reflect.DeepEqual(rebuild.Mounts, want) {
+		t.Fatalf("expected mounts %v, got %v", want, rebuild.Mounts)
+	}
+	if _, ok := rebuild.Labels[labelAdopted]; ok {
+		t.Fatalf("expected adoption label dropped, got %v", rebuild.Labels)
+	}
+}
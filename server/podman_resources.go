@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	labelWorkspaceCPUs      = "pocketpod.cpus"
+	labelWorkspaceMemory    = "pocketpod.memory"
+	labelWorkspacePidsLimit = "pocketpod.pids_limit"
+	labelWorkspaceShmSize   = "pocketpod.shm_size"
+
+	maxWorkspaceCPUs        = 256
+	minWorkspaceMemoryBytes = 6 << 20
+	maxWorkspaceMemoryBytes = 1 << 40
+	maxWorkspacePidsLimit   = 1 << 22
+	maxWorkspaceShmBytes    = 64 << 30
+	maxWorkspaceSizeLength  = 32
+)
+
+var workspaceSizePattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z]*)$`)
+
+var workspaceSizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+type containerLimits struct {
+	CPUs      float64 `json:"cpus,omitempty"`
+	Memory    int64   `json:"memory,omitempty"`
+	PidsLimit int64   `json:"pidsLimit,omitempty"`
+	ShmSize   int64   `json:"shmSize,omitempty"`
+}
+
+func (l containerLimits) isZero() bool {
+	return l == containerLimits{}
+}
+
+func (l containerLimits) labels() map[string]string {
+	labels := map[string]string{}
+	if l.CPUs > 0 {
+		labels[labelWorkspaceCPUs] = strconv.FormatFloat(l.CPUs, 'f', -1, 64)
+	}
+	if l.Memory > 0 {
+		labels[labelWorkspaceMemory] = strconv.FormatInt(l.Memory, 10)
+	}
+	if l.PidsLimit > 0 {
+		labels[labelWorkspacePidsLimit] = strconv.FormatInt(l.PidsLimit, 10)
+	}
+	if l.ShmSize > 0 {
+		labels[labelWorkspaceShmSize] = strconv.FormatInt(l.ShmSize, 10)
+	}
+	return labels
+}
+
+func containerLimitsFromLabels(labels map[string]string) containerLimits {
+	var limits containerLimits
+	limits.CPUs, _ = strconv.ParseFloat(labels[labelWorkspaceCPUs], 64)
+	limits.Memory, _ = strconv.ParseInt(labels[labelWorkspaceMemory], 10, 64)
+	limits.PidsLimit, _ = strconv.ParseInt(labels[labelWorkspacePidsLimit], 10, 64)
+	limits.ShmSize, _ = strconv.ParseInt(labels[labelWorkspaceShmSize], 10, 64)
+	return limits
+}
+
+func resolveWorkspaceLimitMaximums() containerLimits {
+	var maximums containerLimits
+	if raw := strings.TrimSpace(os.Getenv("WORKSPACE_MAX_CPUS")); raw != "" {
+		if cpus, err := strconv.ParseFloat(raw, 64); err == nil && cpus > 0 {
+			maximums.CPUs = cpus
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("WORKSPACE_MAX_MEMORY")); raw != "" {
+		if memory, err := parseWorkspaceSize(raw); err == nil {
+			maximums.Memory = memory
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("WORKSPACE_MAX_PIDS")); raw != "" {
+		if pids, err := strconv.ParseInt(raw, 10, 64); err == nil && pids > 0 {
+			maximums.PidsLimit = pids
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("WORKSPACE_MAX_SHM_SIZE")); raw != "" {
+		if shm, err := parseWorkspaceSize(raw); err == nil {
+			maximums.ShmSize = shm
+		}
+	}
+	return maximums
+}
+
+func validateWorkspaceLimits(payload *createWorkspacePayload, maximums containerLimits) (containerLimits, error) {
+	var limits containerLimits
+
+	switch {
+	case math.IsNaN(payload.CPUs) || payload.CPUs < 0:
+		return limits, errors.New("cpus must be positive")
+	case payload.CPUs > maxWorkspaceCPUs:
+		return limits, fmt.Errorf("cpus must be at most %d", maxWorkspaceCPUs)
+	case maximums.CPUs > 0 && payload.CPUs > maximums.CPUs:
+		return limits, fmt.Errorf("cpus exceeds the maximum of %s", strconv.FormatFloat(maximums.CPUs, 'f', -1, 64))
+	}
+	limits.CPUs = payload.CPUs
+
+	memory, err := parseWorkspaceSizeField("memory", payload.Memory)
+	if err != nil {
+		return limits, err
+	}
+	switch {
+	case memory != 0 && memory < minWorkspaceMemoryBytes:
+		return limits, errors.New("memory must be at least 6m")
+	case memory > maxWorkspaceMemoryBytes:
+		return limits, errors.New("memory is too large")
+	case maximums.Memory > 0 && memory > maximums.Memory:
+		return limits, fmt.Errorf("memory exceeds the maximum of %s", formatWorkspaceSize(maximums.Memory))
+	}
+	limits.Memory = memory
+
+	switch {
+	case payload.PidsLimit < 0:
+		return limits, errors.New("pidsLimit must be positive")
+	case payload.PidsLimit > maxWorkspacePidsLimit:
+		return limits, errors.New("pidsLimit is too large")
+	case maximums.PidsLimit > 0 && payload.PidsLimit > maximums.PidsLimit:
+		return limits, fmt.Errorf("pidsLimit exceeds the maximum of %d", maximums.PidsLimit)
+	}
+	limits.PidsLimit = payload.PidsLimit
+
+	shmSize, err := parseWorkspaceSizeField("shmSize", payload.ShmSize)
+	if err != nil {
+		return limits, err
+	}
+	switch {
+	case shmSize > maxWorkspaceShmBytes:
+		return limits, errors.New("shmSize is too large")
+	case maximums.ShmSize > 0 && shmSize > maximums.ShmSize:
+		return limits, fmt.Errorf("shmSize exceeds the maximum of %s", formatWorkspaceSize(maximums.ShmSize))
+	}
+	limits.ShmSize = shmSize
+
+	if limits.CPUs == 0 {
+		limits.CPUs = maximums.CPUs
+	}
+	if limits.Memory == 0 {
+		limits.Memory = maximums.Memory
+	}
+	if limits.PidsLimit == 0 {
+		limits.PidsLimit = maximums.PidsLimit
+	}
+	if limits.ShmSize == 0 {
+		limits.ShmSize = maximums.ShmSize
+	}
+
+	return limits, nil
+}
+
+func parseWorkspaceSizeField(field string, value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	if len(value) > maxWorkspaceSizeLength {
+		return 0, fmt.Errorf("%s is too long", field)
+	}
+	size, err := parseWorkspaceSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a size such as 512m or 2g", field)
+	}
+	return size, nil
+}
+
+func parseWorkspaceSize(value string) (int64, error) {
+	match := workspaceSizePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, errors.New("invalid size")
+	}
+	multiplier, ok := workspaceSizeUnits[strings.ToLower(match[2])]
+	if !ok {
+		return 0, errors.New("invalid size unit")
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	size := number * float64(multiplier)
+	if size <= 0 || size > math.MaxInt64/2 {
+		return 0, errors.New("invalid size")
+	}
+	return int64(size), nil
+}
+
+func formatWorkspaceSize(bytes int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"t", 1 << 40}, {"g", 1 << 30}, {"m", 1 << 20}, {"k", 1 << 10}} {
+		if bytes >= unit.size && bytes%unit.size == 0 {
+			return strconv.FormatInt(bytes/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
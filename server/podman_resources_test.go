@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseWorkspaceSize(t *testing.T) {
+	cases := map[string]int64{
+		"1024":  1024,
+		"512m":  512 << 20,
+		"2g":    2 << 30,
+		"1.5G":  3 << 29,
+		"64MiB": 64 << 20,
+		"1 gb":  1 << 30,
+	}
+	for input, want := range cases {
+		got, err := parseWorkspaceSize(input)
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		if got != want {
+			t.Fatalf("parse %q: got %d want %d", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"", "0", "-1g", "2x", "g", "1e9"} {
+		if _, err := parseWorkspaceSize(input); err == nil {
+			t.Fatalf("expected %q to fail", input)
+		}
+	}
+}
+
+func TestValidateWorkspaceLimits(t *testing.T) {
+	payload := createWorkspacePayload{
+		CPUs:      1.5,
+		Memory:    "2g",
+		PidsLimit: 512,
+		ShmSize:   "256m",
+	}
+
+	limits, err := validateWorkspaceLimits(&payload, containerLimits{})
+	if err != nil {
+		t.Fatalf("validate limits: %v", err)
+	}
+	want := containerLimits{CPUs: 1.5, Memory: 2 << 30, PidsLimit: 512, ShmSize: 256 << 20}
+	if limits != want {
+		t.Fatalf("unexpected limits: got %+v want %+v", limits, want)
+	}
+
+	invalid := []createWorkspacePayload{
+		{CPUs: -1},
+		{CPUs: maxWorkspaceCPUs + 1},
+		{Memory: "1m"},
+		{Memory: "lots"},
+		{PidsLimit: -5},
+		{ShmSize: "128q"},
+	}
+	for _, payload := range invalid {
+		if _, err := validateWorkspaceLimits(&payload, containerLimits{}); err == nil {
+			t.Fatalf("expected %+v to fail", payload)
+		}
+	}
+}
+
+func TestValidateWorkspaceLimitsAppliesMaximums(t *testing.T) {
+	t.Setenv("WORKSPACE_MAX_CPUS", "2")
+	t.Setenv("WORKSPACE_MAX_MEMORY", "4g")
+	t.Setenv("WORKSPACE_MAX_PIDS", "1024")
+	t.Setenv("WORKSPACE_MAX_SHM_SIZE", "bogus")
+	maximums := resolveWorkspaceLimitMaximums()
+
+	payload := createWorkspacePayload{Memory: "1g"}
+	limits, err := validateWorkspaceLimits(&payload, maximums)
+	if err != nil {
+		t.Fatalf("validate limits: %v", err)
+	}
+	want := containerLimits{CPUs: 2, Memory: 1 << 30, PidsLimit: 1024}
+	if limits != want {
+		t.Fatalf("expected caps as defaults, got %+v want %+v", limits, want)
+	}
+
+	payload = createWorkspacePayload{Memory: "8g"}
+	_, err = validateWorkspaceLimits(&payload, maximums)
+	if err == nil || !strings.Contains(err.Error(), "maximum of 4g") {
+		t.Fatalf("expected memory cap error, got %v", err)
+	}
+
+	payload = createWorkspacePayload{CPUs: 3}
+	if _, err := validateWorkspaceLimits(&payload, maximums); err == nil {
+		t.Fatal("expected cpus cap error")
+	}
+}
+
+func TestContainerLimitsLabelsRoundTrip(t *testing.T) {
+	limits := containerLimits{CPUs: 0.5, Memory: 1 << 30, PidsLimit: 100, ShmSize: 64 << 20}
+	labels := limits.labels()
+	if labels[labelWorkspaceCPUs] != "0.5" {
+		t.Fatalf("unexpected cpus label %q", labels[labelWorkspaceCPUs])
+	}
+	if got := containerLimitsFromLabels(labels); got != limits {
+		t.Fatalf("round trip mismatch: got %+v want %+v", got, limits)
+	}
+	if len(containerLimits{}.labels()) != 0 {
+		t.Fatal("expected no labels for unlimited container")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type workspaceRollback struct {
+	svc   *podmanService
+	job   *workspaceJob
+	step  string
+	undos []workspaceUndo
+}
+
+type workspaceUndo struct {
+	resource string
+	undo     func() error
+}
+
+type workspaceCleanup struct {
+	Completed bool     `json:"completed"`
+	Released  []string `json:"released"`
+	Failed    []string `json:"failed,omitempty"`
+}
+
+type workspaceCreateError struct {
+	Step    string
+	Err     error
+	Cleanup workspaceCleanup
+}
+
+func (e *workspaceCreateError) Error() string {
+	return fmt.Sprintf("workspace creation failed while %s: %v", e.Step, e.Err)
+}
+
+func (e *workspaceCreateError) Unwrap() error {
+	return e.Err
+}
+
+func (e *workspaceCreateError) cleanupMessage() string {
+	switch {
+	case !e.Cleanup.Completed:
+		return "Cleanup failed for: " + strings.Join(e.Cleanup.Failed, ", ") + "."
+	case len(e.Cleanup.Released) == 0:
+		return "Nothing needed cleaning up."
+	default:
+		return "Cleaned up: " + strings.Join(e.Cleanup.Released, ", ") + "."
+	}
+}
+
+func (s *podmanService) newWorkspaceRollback(job *workspaceJob) *workspaceRollback {
+	return &workspaceRollback{svc: s, job: job}
+}
+
+func (r *workspaceRollback) enter(step string) {
+	r.step = step
+	r.svc.enterWorkspaceJobPhase(r.job, step)
+}
+
+func (r *workspaceRollback) acquired(resource string, undo func() error) {
+	r.undos = append(r.undos, workspaceUndo{resource: resource, undo: undo})
+}
+
+func (r *workspaceRollback) release(err error) error {
+	if err == nil || r.step == "" {
+		return err
+	}
+
+	cleanup := workspaceCleanup{Completed: true, Released: []string{}}
+	for i := len(r.undos) - 1; i >= 0; i-- {
+		if undoErr := r.undos[i].undo(); undoErr != nil {
+			cleanup.Completed = false
+			cleanup.Failed = append(cleanup.Failed, r.undos[i].resource)
+			if r.svc.app != nil {
+				r.svc.app.Logger().Warn("Workspace rollback failed", "resource", r.undos[i].resource, "error", undoErr)
+			}
+			continue
+		}
+		cleanup.Released = append(cleanup.Released, r.undos[i].resource)
+	}
+	r.undos = nil
+
+	return &workspaceCreateError{Step: r.step, Err: err, Cleanup: cleanup}
+}
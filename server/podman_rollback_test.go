@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCreateWorkspaceRollsBackFailedStart(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	rt.startErr = errors.New("oci runtime error")
+	svc := newTestPodmanService(rt)
+
+	_, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-one",
+	}, nil)
+	var createErr *workspaceCreateError
+	if !errors.As(err, &createErr) || !errors.Is(err, errWorkspaceStartFailed) {
+		t.Fatalf("expected start failure, got %v", err)
+	}
+	if createErr.Step != workspaceJobPhaseStarting {
+		t.Fatalf("expected failure while starting, got %q", createErr.Step)
+	}
+	want := []string{"container", "repository clone"}
+	if !createErr.Cleanup.Completed || !reflect.DeepEqual(createErr.Cleanup.Released, want) {
+		t.Fatalf("expected %v released, got %+v", want, createErr.Cleanup)
+	}
+	if len(rt.containers) != 0 {
+		t.Fatalf("expected container removed, got %v", rt.containers)
+	}
+	repoBasePath, err := ensureWorkspaceRepoBasePath("user-1")
+	if err != nil {
+		t.Fatalf("repo base path: %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(repoBasePath, "ws-one")); !errors.Is(statErr, os.ErrNotExist) {
+		t.Fatalf("expected clone removed, got %v", statErr)
+	}
+
+	rt.startErr = nil
+	if _, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-one",
+	}, nil); err != nil {
+		t.Fatalf("expected retry to succeed, got %v", err)
+	}
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+}
+
+func TestWorkspaceRollbackReportsFailedUndo(t *testing.T) {
+	svc := newTestPodmanService(newFakeRuntime())
+	rollback := svc.newWorkspaceRollback(nil)
+
+	var order []string
+	rollback.enter(workspaceJobPhaseCloning)
+	rollback.acquired("repository clone", func() error {
+		order = append(order, "repository clone")
+		return nil
+	})
+	rollback.enter(workspaceJobPhaseCreating)
+	rollback.acquired("container", func() error {
+		order = append(order, "container")
+		return errors.New("device busy")
+	})
+
+	err := rollback.release(errors.New("boom"))
+	var createErr *workspaceCreateError
+	if !errors.As(err, &createErr) || createErr.Step != workspaceJobPhaseCreating {
+		t.Fatalf("expected create error for creating step, got %v", err)
+	}
+	if !reflect.DeepEqual(order, []string{"container", "repository clone"}) {
+		t.Fatalf("expected newest-first rollback, got %v", order)
+	}
+	if createErr.Cleanup.Completed || !reflect.DeepEqual(createErr.Cleanup.Failed, []string{"container"}) {
+		t.Fatalf("expected container cleanup failure, got %+v", createErr.Cleanup)
+	}
+	if got := createErr.cleanupMessage(); got != "Cleanup failed for: container." {
+		t.Fatalf("unexpected cleanup message %q", got)
+	}
+}
+
+func TestCloneWorkspaceRepositoryRemovesFailedCheckout(t *testing.T) {
+	stubWorkspaceClone(t)
+	runWorkspaceCommand = func(_ []string, name string, args ...string) ([]byte, error) {
+		if args[0] == "clone" {
+			return nil, os.MkdirAll(filepath.Join(args[len(args)-1], ".git"), 0o755)
+		}
+		return []byte("error: pathspec 'nope' did not match"), errors.New("exit status 1")
+	}
+
+	_, _, err := cloneWorkspaceRepository("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Ref:     "nope",
+	}, nil)
+	if !errors.Is(err, errWorkspaceRefFailed) {
+		t.Fatalf("expected ref failure, got %v", err)
+	}
+	repoBasePath, err := ensureWorkspaceRepoBasePath("user-1")
+	if err != nil {
+		t.Fatalf("repo base path: %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(repoBasePath, "repo")); !errors.Is(statErr, os.ErrNotExist) {
+		t.Fatalf("expected partial clone removed, got %v", statErr)
+	}
+}
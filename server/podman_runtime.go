@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	errContainerAlreadyStopped = errors.New("container already stopped")
+	errContainerAlreadyRunning = errors.New("container already running")
+	errContainerNameConflict   = errors.New("container name already in use")
+	errContainerAlreadyPaused  = errors.New("container already paused")
+	errContainerNotPaused      = errors.New("container not paused")
+	errContainerNotRunning     = errors.New("container not running")
+	errImageInUse              = errors.New("image in use by a container")
+)
+
+type ContainerRuntime interface {
+	Name() string
+	Available() bool
+	List(ctx context.Context) ([]podmanContainer, error)
+	Inspect(ctx context.Context, containerID string) (podmanInspectSummary, error)
+	Create(ctx context.Context, spec containerCreateSpec) (string, error)
+	Start(ctx context.Context, containerID string) error
+	Stop(ctx context.Context, containerID string) error
+	Restart(ctx context.Context, containerID string) error
+	Pause(ctx context.Context, containerID string) error
+	Unpause(ctx context.Context, containerID string) error
+	Remove(ctx context.Context, containerID string, force bool) error
+	Exec(ctx context.Context, containerID string, opts containerExecOptions) ([]byte, error)
+	Events(ctx context.Context, handle func(podmanEvent)) error
+	Logs(ctx context.Context, containerID string, opts containerLogOptions, handle func(containerLogLine)) error
+	Terminal(ctx context.Context, containerID string, opts containerTerminalOptions) (containerTerminal, error)
+	Stats(ctx context.Context) ([]containerStats, error)
+	ImageExists(ctx context.Context, imageRef string) (bool, error)
+	Pull(ctx context.Context, imageRef string, policy string) error
+	Commit(ctx context.Context, containerID string, imageRef string) error
+	RemoveImage(ctx context.Context, imageRef string) error
+	SaveImage(ctx context.Context, imageRef string, w io.Writer) error
+	LoadImage(ctx context.Context, r io.Reader) error
+	Build(ctx context.Context, opts containerBuildOptions, handle func(line string)) error
+}
+
+const (
+	imagePullMissing = "missing"
+	imagePullNewer   = "newer"
+)
+
+type containerCreateSpec struct {
+	Name       string
+	Image      string
+	Pull       string
+	Entrypoint string
+	Mounts     []string
+	Env        map[string]string
+	Labels     map[string]string
+	Command    []string
+	Limits     containerLimits
+}
+
+type containerLogOptions struct {
+	Follow bool
+	Since  time.Time
+	Tail   int
+}
+
+type containerLogLine struct {
+	Stream    string `json:"stream"`
+	Timestamp string `json:"timestamp,omitempty"`
+	Line      string `json:"line"`
+}
+
+type containerTerminal interface {
+	io.ReadWriteCloser
+	Resize(cols uint16, rows uint16) error
+}
+
+type containerTerminalOptions struct {
+	User string
+	Cmd  []string
+	Env  map[string]string
+	Cols uint16
+	Rows uint16
+}
+
+type containerBuildOptions struct {
+	ContextDir string
+	Dockerfile string
+	Tag        string
+	Target     string
+	Args       map[string]string
+	Labels     map[string]string
+}
+
+type containerExecOptions struct {
+	User   string
+	Detach bool
+	Cmd    []string
+}
+
+var newContainerRuntime = func() ContainerRuntime {
+	return resolveContainerRuntime(os.Getenv("CONTAINER_RUNTIME"))
+}
+
+func resolveContainerRuntime(configured string) ContainerRuntime {
+	switch strings.ToLower(strings.TrimSpace(configured)) {
+	case "podman":
+		if socketPath := resolvePodmanSocketPath(); socketPath != "" {
+			return newLibpodRuntime(socketPath)
+		}
+		return newPodmanCLIRuntime()
+	case "podman-cli":
+		return newPodmanCLIRuntime()
+	case "docker":
+		socketPath := resolveDockerSocketPath()
+		if socketPath == "" {
+			socketPath = dockerDefaultSocketPath
+		}
+		return newDockerRuntime(socketPath)
+	}
+
+	if socketPath := resolvePodmanSocketPath(); socketPath != "" {
+		return newLibpodRuntime(socketPath)
+	}
+	if socketPath := resolveDockerSocketPath(); socketPath != "" {
+		return newDockerRuntime(socketPath)
+	}
+	return newPodmanCLIRuntime()
+}
+
+func execContainerShell(rt ContainerRuntime, containerID string, script string) ([]byte, error) {
+	return rt.Exec(context.Background(), containerID, containerExecOptions{
+		Cmd: []string{"sh", "-lc", script},
+	})
+}
@@ -0,0 +1,716 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type engineAPIClient struct {
+	socketPath string
+	prefix     string
+	http       *http.Client
+}
+
+type engineAPIError struct {
+	Status  int
+	Message string
+}
+
+func (e *engineAPIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("engine api returned status %d", e.Status)
+	}
+	return fmt.Sprintf("engine api returned status %d: %s", e.Status, e.Message)
+}
+
+type containerMountSpec struct {
+	Type     string
+	Source   string
+	Target   string
+	ReadOnly bool
+}
+
+func newEngineAPIClient(socketPath string, prefix string) *engineAPIClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+
+	return &engineAPIClient{
+		socketPath: socketPath,
+		prefix:     strings.TrimRight(prefix, "/"),
+		http:       &http.Client{Transport: transport},
+	}
+}
+
+func (c *engineAPIClient) available() bool {
+	return isUnixSocket(c.socketPath)
+}
+
+func (c *engineAPIClient) do(ctx context.Context, method string, path string, query url.Values, body any) (*http.Response, error) {
+	if body == nil {
+		return c.send(ctx, method, path, query, "", nil)
+	}
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(ctx, method, path, query, "application/json", bytes.NewReader(encoded))
+}
+
+func (c *engineAPIClient) send(ctx context.Context, method string, path string, query url.Values, contentType string, reader io.Reader) (*http.Response, error) {
+	if !c.available() {
+		return nil, errPodmanUnavailable
+	}
+
+	target := "http://d" + c.prefix + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeEngineAPIError(resp)
+	}
+
+	return resp, nil
+}
+
+func (c *engineAPIClient) hijack(ctx context.Context, path string, body any) (net.Conn, *bufio.Reader, error) {
+	if !c.available() {
+		return nil, nil, errPodmanUnavailable
+	}
+
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", c.socketPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://d"+c.prefix+path, bytes.NewReader(encoded))
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	// Docker answers 101 Switching Protocols, libpod a bare 200 followed by
+	// the raw stream.
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, nil, decodeEngineAPIError(resp)
+	}
+
+	return conn, reader, nil
+}
+
+func (c *engineAPIClient) doJSON(ctx context.Context, method string, path string, query url.Values, body any, out any) (int, error) {
+	resp, err := c.do(ctx, method, path, query, body)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(out)
+}
+
+func drainEngineProgress(body io.Reader) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var entry struct {
+			Error        string `json:"error"`
+			ErrorMessage string `json:"errorMessage"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Error != "" {
+			return errors.New(entry.Error)
+		}
+		if entry.ErrorMessage != "" {
+			return errors.New(entry.ErrorMessage)
+		}
+	}
+
+	return scanner.Err()
+}
+
+func decodeEngineAPIError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var payload struct {
+		Message string `json:"message"`
+		Cause   string `json:"cause"`
+	}
+	message := strings.TrimSpace(string(raw))
+	if err := json.Unmarshal(raw, &payload); err == nil {
+		message = strings.TrimSpace(payload.Message)
+		if message == "" {
+			message = strings.TrimSpace(payload.Cause)
+		}
+	}
+
+	if resp.StatusCode == http.StatusNotFound && isPodmanContainerNotFound([]byte(message)) {
+		return errPodmanContainerNotFound
+	}
+
+	return &engineAPIError{Status: resp.StatusCode, Message: message}
+}
+
+func engineAPIErrorMessage(err error) string {
+	var apiErr *engineAPIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Message
+	}
+	return ""
+}
+
+func demuxEngineStream(w io.Writer, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	header := make([]byte, 8)
+
+	for {
+		peeked, err := reader.Peek(1)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if peeked[0] > 2 {
+			_, err := io.Copy(w, reader)
+			return err
+		}
+
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+
+		size := binary.BigEndian.Uint32(header[4:])
+		if _, err := io.CopyN(w, reader, int64(size)); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func streamEngineLogs(ctx context.Context, client *engineAPIClient, containerID string, opts containerLogOptions, handle func(containerLogLine)) error {
+	query := url.Values{
+		"stdout":     {"true"},
+		"stderr":     {"true"},
+		"timestamps": {"true"},
+		"follow":     {strconv.FormatBool(opts.Follow)},
+	}
+	if !opts.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+	if opts.Tail >= 0 {
+		query.Set("tail", strconv.Itoa(opts.Tail))
+	}
+
+	resp, err := client.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(containerID)+"/logs", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = demuxEngineLogLines(resp.Body, func(stream string, line string) {
+		handle(parseContainerLogLine(stream, line))
+	})
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+func demuxEngineLogLines(r io.Reader, handle func(stream string, line string)) error {
+	reader := bufio.NewReader(r)
+	peeked, err := reader.Peek(1)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	}
+	if peeked[0] > 2 {
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			handle("stdout", strings.TrimSuffix(scanner.Text(), "\r"))
+		}
+		return scanner.Err()
+	}
+
+	pending := map[string]*bytes.Buffer{"stdout": {}, "stderr": {}}
+	flush := func() {
+		for _, stream := range []string{"stdout", "stderr"} {
+			if pending[stream].Len() > 0 {
+				handle(stream, pending[stream].String())
+				pending[stream].Reset()
+			}
+		}
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			flush()
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+
+		stream := "stdout"
+		if header[0] == 2 {
+			stream = "stderr"
+		}
+		size := binary.BigEndian.Uint32(header[4:])
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			flush()
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return nil
+			}
+			return err
+		}
+
+		buf := pending[stream]
+		buf.Write(chunk)
+		for {
+			idx := bytes.IndexByte(buf.Bytes(), '\n')
+			if idx < 0 {
+				break
+			}
+			line := string(bytes.TrimSuffix(buf.Next(idx + 1)[:idx], []byte("\r")))
+			handle(stream, line)
+		}
+	}
+}
+
+func parseMountArg(value string) containerMountSpec {
+	mount := containerMountSpec{Type: "bind"}
+	for _, part := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(key) {
+		case "type":
+			mount.Type = val
+		case "src", "source":
+			mount.Source = val
+		case "dst", "destination", "target":
+			mount.Target = val
+		case "ro", "readonly":
+			mount.ReadOnly = val == "" || strings.EqualFold(val, "true")
+		}
+	}
+	return mount
+}
+
+func isUnixSocket(path string) bool {
+	if strings.TrimSpace(path) == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeSocket != 0
+}
+
+func postEngineContainerAction(ctx context.Context, client *engineAPIClient, containerID string, action string) error {
+	_, err := client.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/"+action, nil, nil, nil)
+	if err == nil {
+		return nil
+	}
+	if stateErr := classifyContainerStateError(action, []byte(engineAPIErrorMessage(err))); stateErr != nil {
+		return stateErr
+	}
+	return err
+}
+
+type engineTerminal struct {
+	client *engineAPIClient
+	execID string
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func openEngineTerminal(ctx context.Context, client *engineAPIClient, containerID string, opts containerTerminalOptions) (containerTerminal, error) {
+	env := make([]string, 0, len(opts.Env))
+	for _, key := range sortedMapKeys(opts.Env) {
+		env = append(env, fmt.Sprintf("%s=%s", key, opts.Env[key]))
+	}
+	createBody := map[string]any{
+		"AttachStdin":  true,
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Tty":          true,
+		"Cmd":          opts.Cmd,
+		"Env":          env,
+	}
+	if opts.User != "" {
+		createBody["User"] = opts.User
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if _, err := client.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/exec", nil, createBody, &created); err != nil {
+		return nil, err
+	}
+
+	conn, reader, err := client.hijack(ctx, "/exec/"+url.PathEscape(created.ID)+"/start", map[string]any{"Detach": false, "Tty": true})
+	if err != nil {
+		return nil, err
+	}
+
+	term := &engineTerminal{client: client, execID: created.ID, conn: conn, reader: reader}
+	if opts.Cols > 0 && opts.Rows > 0 {
+		_ = term.Resize(opts.Cols, opts.Rows)
+	}
+	return term, nil
+}
+
+func (t *engineTerminal) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+func (t *engineTerminal) Write(p []byte) (int, error) {
+	return t.conn.Write(p)
+}
+
+func (t *engineTerminal) Close() error {
+	return t.conn.Close()
+}
+
+func (t *engineTerminal) Resize(cols uint16, rows uint16) error {
+	query := url.Values{
+		"w": {strconv.Itoa(int(cols))},
+		"h": {strconv.Itoa(int(rows))},
+	}
+	_, err := t.client.doJSON(context.Background(), http.MethodPost, "/exec/"+url.PathEscape(t.execID)+"/resize", query, nil, nil)
+	return err
+}
+
+func streamEngineBuild(ctx context.Context, client *engineAPIClient, opts containerBuildOptions, handle func(line string)) error {
+	query := url.Values{
+		"dockerfile": {opts.Dockerfile},
+		"t":          {opts.Tag},
+		"rm":         {"true"},
+	}
+	if len(opts.Args) > 0 {
+		encoded, err := json.Marshal(opts.Args)
+		if err != nil {
+			return err
+		}
+		query.Set("buildargs", string(encoded))
+	}
+	if len(opts.Labels) > 0 {
+		encoded, err := json.Marshal(opts.Labels)
+		if err != nil {
+			return err
+		}
+		query.Set("labels", string(encoded))
+	}
+	if opts.Target != "" {
+		query.Set("target", opts.Target)
+	}
+
+	archive, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeBuildContextTar(writer, opts.ContextDir))
+	}()
+	defer archive.Close()
+
+	resp, err := client.send(ctx, http.MethodPost, "/build", query, "application/x-tar", archive)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeEngineBuildStream(resp.Body, handle)
+}
+
+func decodeEngineBuildStream(body io.Reader, handle func(line string)) error {
+	decoder := json.NewDecoder(body)
+	pending := ""
+	for {
+		var entry struct {
+			Stream      string `json:"stream"`
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := decoder.Decode(&entry); err != nil {
+			if pending != "" {
+				handle(pending)
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		pending += entry.Stream
+		for {
+			line, rest, found := strings.Cut(pending, "\n")
+			if !found {
+				break
+			}
+			handle(line)
+			pending = rest
+		}
+
+		message := entry.ErrorDetail.Message
+		if message == "" {
+			message = entry.Error
+		}
+		if message != "" {
+			if pending != "" {
+				handle(pending)
+			}
+			handle(message)
+			return fmt.Errorf("image build: %s", strings.TrimSpace(message))
+		}
+	}
+}
+
+func commitEngineContainer(ctx context.Context, client *engineAPIClient, containerID string, imageRef string) error {
+	repository, tag := splitImageReference(imageRef)
+	query := url.Values{"container": {containerID}, "repo": {repository}, "tag": {tag}, "pause": {"false"}}
+	if _, err := client.doJSON(ctx, http.MethodPost, "/commit", query, nil, nil); err != nil {
+		var apiErr *engineAPIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			return errPodmanContainerNotFound
+		}
+		return fmt.Errorf("commit container: %w", err)
+	}
+	return nil
+}
+
+func removeEngineImage(ctx context.Context, client *engineAPIClient, imageRef string) error {
+	_, err := client.doJSON(ctx, http.MethodDelete, "/images/"+url.PathEscape(imageRef), nil, nil, nil)
+	var apiErr *engineAPIError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound:
+		return nil
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict:
+		return errImageInUse
+	default:
+		return fmt.Errorf("remove image: %w", err)
+	}
+}
+
+func saveEngineImage(ctx context.Context, client *engineAPIClient, imageRef string, w io.Writer) error {
+	resp, err := client.send(ctx, http.MethodGet, "/images/"+url.PathEscape(imageRef)+"/get", nil, "", nil)
+	if err != nil {
+		return fmt.Errorf("save image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("save image: %w", err)
+	}
+	return nil
+}
+
+func loadEngineImage(ctx context.Context, client *engineAPIClient, r io.Reader) error {
+	resp, err := client.send(ctx, http.MethodPost, "/images/load", url.Values{"quiet": {"true"}}, "application/x-tar", r)
+	if err != nil {
+		return fmt.Errorf("load image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := drainEngineProgress(resp.Body); err != nil {
+		return fmt.Errorf("load image: %w", err)
+	}
+	return nil
+}
+
+func writeBuildContextTar(w io.Writer, dir string) error {
+	return writeDirectoryTar(w, dir, func(entry fs.DirEntry) bool {
+		return entry.IsDir() && entry.Name() == ".git"
+	})
+}
+
+func writeDirectoryTar(w io.Writer, dir string, skip func(entry fs.DirEntry) bool) error {
+	tw := tar.NewWriter(w)
+	if err := addDirectoryToTar(tw, dir, "", skip); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func addDirectoryToTar(tw *tar.Writer, dir string, prefix string, skip func(entry fs.DirEntry) bool) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if skip != nil && skip(entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = prefix + filepath.ToSlash(rel)
+		if entry.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+}
+
+func extractDirectoryTar(r io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := filepath.FromSlash(strings.TrimSuffix(header.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("archive entry %q is outside the directory", header.Name)
+		}
+		target := filepath.Join(root, name)
+		parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+		if err != nil {
+			return err
+		}
+		if rel, err := filepath.Rel(root, parent); err != nil || !filepath.IsLocal(rel) {
+			return fmt.Errorf("archive entry %q is outside the directory", header.Name)
+		}
+		mode := fs.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, mode|0o700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+			if err != nil {
+				return err
+			}
+			_, copyErr := io.Copy(file, tr)
+			closeErr := file.Close()
+			if copyErr != nil {
+				return copyErr
+			}
+			if closeErr != nil {
+				return closeErr
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		default:
+			// Devices, fifos and hard links have no place in a repository.
+		}
+	}
+}
@@ -0,0 +1,621 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type podmanCLIRuntime struct{}
+
+func newPodmanCLIRuntime() *podmanCLIRuntime {
+	return &podmanCLIRuntime{}
+}
+
+func (r *podmanCLIRuntime) Name() string {
+	return "podman-cli"
+}
+
+func (r *podmanCLIRuntime) Available() bool {
+	_, err := exec.LookPath("podman")
+	return err == nil
+}
+
+func (r *podmanCLIRuntime) run(ctx context.Context, args ...string) ([]byte, error) {
+	if !r.Available() {
+		return nil, errPodmanUnavailable
+	}
+
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	return cmd.CombinedOutput()
+}
+
+func (r *podmanCLIRuntime) List(ctx context.Context) ([]podmanContainer, error) {
+	if !r.Available() {
+		return nil, errPodmanUnavailable
+	}
+
+	output, err := r.runList(ctx, true)
+	if err != nil {
+		output, err = r.runList(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(output) == 0 {
+		return []podmanContainer{}, nil
+	}
+
+	return parsePodmanContainers(output)
+}
+
+func (r *podmanCLIRuntime) runList(ctx context.Context, includeSize bool) ([]byte, error) {
+	args := []string{"ps", "--all", "--format", "json"}
+	if includeSize {
+		args = append(args, "--size")
+	}
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	return cmd.Output()
+}
+
+func (r *podmanCLIRuntime) Inspect(ctx context.Context, containerID string) (podmanInspectSummary, error) {
+	output, err := r.run(ctx, "inspect", "--format", "json", containerID)
+	if err != nil {
+		if isPodmanContainerNotFound(output) {
+			return podmanInspectSummary{}, errPodmanContainerNotFound
+		}
+		return podmanInspectSummary{}, fmt.Errorf("inspect container: %w", err)
+	}
+
+	var parsed []podmanInspectSummary
+	if err := json.Unmarshal(output, &parsed); err != nil {
+		return podmanInspectSummary{}, err
+	}
+	if len(parsed) == 0 {
+		return podmanInspectSummary{}, errPodmanContainerNotFound
+	}
+
+	return parsed[0], nil
+}
+
+func (r *podmanCLIRuntime) Create(ctx context.Context, spec containerCreateSpec) (string, error) {
+	output, err := r.run(ctx, buildPodmanCreateArgs(spec)...)
+	if err != nil {
+		if isPodmanNameConflict(output) {
+			return "", errContainerNameConflict
+		}
+		return "", fmt.Errorf("create container: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	containerID := latestNonEmptyLine(string(output))
+	if containerID == "" {
+		return "", errors.New("empty container id")
+	}
+
+	return containerID, nil
+}
+
+func buildPodmanCreateArgs(spec containerCreateSpec) []string {
+	args := []string{"create"}
+	if spec.Pull != "" {
+		args = append(args, "--pull="+spec.Pull)
+	}
+	if spec.Name != "" {
+		args = append(args, "--name", spec.Name)
+	}
+	if spec.Entrypoint != "" {
+		args = append(args, "--entrypoint", spec.Entrypoint)
+	}
+	for _, mount := range spec.Mounts {
+		args = append(args, "--mount", mount)
+	}
+	if spec.Limits.CPUs > 0 {
+		args = append(args, "--cpus="+strconv.FormatFloat(spec.Limits.CPUs, 'f', -1, 64))
+	}
+	if spec.Limits.Memory > 0 {
+		args = append(args, "--memory="+strconv.FormatInt(spec.Limits.Memory, 10))
+	}
+	if spec.Limits.PidsLimit > 0 {
+		args = append(args, "--pids-limit="+strconv.FormatInt(spec.Limits.PidsLimit, 10))
+	}
+	if spec.Limits.ShmSize > 0 {
+		args = append(args, "--shm-size="+strconv.FormatInt(spec.Limits.ShmSize, 10))
+	}
+
+	for _, key := range sortedMapKeys(spec.Env) {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", key, spec.Env[key]))
+	}
+	for _, key := range sortedMapKeys(spec.Labels) {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", key, spec.Labels[key]))
+	}
+
+	args = append(args, spec.Image)
+	return append(args, spec.Command...)
+}
+
+func (r *podmanCLIRuntime) Start(ctx context.Context, containerID string) error {
+	output, err := r.run(ctx, "start", containerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPodmanUnavailable):
+			return err
+		case isPodmanContainerNotFound(output):
+			return errPodmanContainerNotFound
+		case isPodmanContainerAlreadyRunning(output):
+			return errContainerAlreadyRunning
+		default:
+			return fmt.Errorf("start container: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) Stop(ctx context.Context, containerID string) error {
+	output, err := r.run(ctx, "stop", containerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPodmanUnavailable):
+			return err
+		case isPodmanContainerNotFound(output):
+			return errPodmanContainerNotFound
+		case isPodmanContainerAlreadyStopped(output):
+			return errContainerAlreadyStopped
+		default:
+			return fmt.Errorf("stop container: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) Restart(ctx context.Context, containerID string) error {
+	return r.runStateChange(ctx, "restart", containerID)
+}
+
+func (r *podmanCLIRuntime) Pause(ctx context.Context, containerID string) error {
+	return r.runStateChange(ctx, "pause", containerID)
+}
+
+func (r *podmanCLIRuntime) Unpause(ctx context.Context, containerID string) error {
+	return r.runStateChange(ctx, "unpause", containerID)
+}
+
+func (r *podmanCLIRuntime) runStateChange(ctx context.Context, action string, containerID string) error {
+	output, err := r.run(ctx, action, containerID)
+	if err != nil {
+		if errors.Is(err, errPodmanUnavailable) {
+			return err
+		}
+		if isPodmanContainerNotFound(output) {
+			return errPodmanContainerNotFound
+		}
+		if stateErr := classifyContainerStateError(action, output); stateErr != nil {
+			return stateErr
+		}
+		return fmt.Errorf("%s container: %w", action, err)
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) Remove(ctx context.Context, containerID string, force bool) error {
+	args := []string{"rm"}
+	if force {
+		args = append(args, "-f")
+	}
+	output, err := r.run(ctx, append(args, containerID)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPodmanUnavailable):
+			return err
+		case isPodmanContainerNotFound(output):
+			return errPodmanContainerNotFound
+		default:
+			return fmt.Errorf("remove container: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) Exec(ctx context.Context, containerID string, opts containerExecOptions) ([]byte, error) {
+	args := []string{"exec"}
+	if opts.Detach {
+		args = append(args, "-d")
+	}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	args = append(args, containerID)
+	return r.run(ctx, append(args, opts.Cmd...)...)
+}
+
+func (r *podmanCLIRuntime) Events(ctx context.Context, handle func(podmanEvent)) error {
+	if !r.Available() {
+		return errPodmanUnavailable
+	}
+
+	cmd := exec.CommandContext(ctx, "podman", "events", "--format", "json")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	cmd.Stderr = io.Discard
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var event podmanEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			continue
+		}
+		handle(event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		_ = cmd.Wait()
+		return err
+	}
+
+	return cmd.Wait()
+}
+
+func (r *podmanCLIRuntime) Logs(ctx context.Context, containerID string, opts containerLogOptions, handle func(containerLogLine)) error {
+	if !r.Available() {
+		return errPodmanUnavailable
+	}
+
+	args := []string{"logs", "--timestamps"}
+	if opts.Follow {
+		args = append(args, "--follow")
+	}
+	if !opts.Since.IsZero() {
+		args = append(args, "--since", opts.Since.UTC().Format(time.RFC3339))
+	}
+	if opts.Tail >= 0 {
+		args = append(args, "--tail", strconv.Itoa(opts.Tail))
+	}
+	args = append(args, containerID)
+
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	// podman logs replays the container's stderr on its own stderr, so both
+	// pipes are scanned and tagged; handle is never called concurrently.
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var scanErr error
+	scan := func(reader io.Reader, stream string) {
+		defer wg.Done()
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := parseContainerLogLine(stream, scanner.Text())
+			mu.Lock()
+			handle(line)
+			mu.Unlock()
+		}
+		if err := scanner.Err(); err != nil {
+			// Keep reading so podman does not block writing to the pipe.
+			_, _ = io.Copy(io.Discard, reader)
+			mu.Lock()
+			if scanErr == nil {
+				scanErr = err
+			}
+			mu.Unlock()
+		}
+	}
+	wg.Add(2)
+	go scan(stdout, "stdout")
+	go scan(stderr, "stderr")
+	wg.Wait()
+
+	waitErr := cmd.Wait()
+	if scanErr != nil {
+		return fmt.Errorf("container logs: %w", scanErr)
+	}
+	if waitErr != nil && ctx.Err() == nil {
+		return fmt.Errorf("container logs: %w", waitErr)
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) Terminal(ctx context.Context, containerID string, opts containerTerminalOptions) (containerTerminal, error) {
+	if !r.Available() {
+		return nil, errPodmanUnavailable
+	}
+
+	args := []string{"exec", "-it"}
+	if opts.User != "" {
+		args = append(args, "--user", opts.User)
+	}
+	for _, key := range sortedMapKeys(opts.Env) {
+		args = append(args, "--env", fmt.Sprintf("%s=%s", key, opts.Env[key]))
+	}
+	args = append(args, containerID)
+	args = append(args, opts.Cmd...)
+
+	cmd := exec.CommandContext(ctx, "podman", args...)
+	master, err := startPTYCommand(cmd, opts.Cols, opts.Rows)
+	if err != nil {
+		return nil, err
+	}
+	return &cliTerminal{cmd: cmd, pty: master}, nil
+}
+
+type cliTerminal struct {
+	cmd       *exec.Cmd
+	pty       *os.File
+	closeOnce sync.Once
+}
+
+func (t *cliTerminal) Read(p []byte) (int, error) {
+	n, err := t.pty.Read(p)
+	// Linux reports EIO on the PTY master once the child side is gone.
+	if err != nil && n == 0 && !errors.Is(err, io.EOF) {
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (t *cliTerminal) Write(p []byte) (int, error) {
+	return t.pty.Write(p)
+}
+
+func (t *cliTerminal) Close() error {
+	t.closeOnce.Do(func() {
+		if t.cmd.Process != nil {
+			_ = t.cmd.Process.Kill()
+		}
+		_ = t.pty.Close()
+		_ = t.cmd.Wait()
+	})
+	return nil
+}
+
+func (t *cliTerminal) Resize(cols uint16, rows uint16) error {
+	return setPTYSize(t.pty, cols, rows)
+}
+
+type podmanCLIStats struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CPUPercent string `json:"cpu_percent"`
+	MemUsage   string `json:"mem_usage"`
+	MemPercent string `json:"mem_percent"`
+	NetIO      string `json:"net_io"`
+	BlockIO    string `json:"block_io"`
+	PIDs       string `json:"pids"`
+}
+
+func (r *podmanCLIRuntime) Stats(ctx context.Context) ([]containerStats, error) {
+	output, err := r.run(ctx, "stats", "--no-stream", "--format", "json")
+	if err != nil {
+		if errors.Is(err, errPodmanUnavailable) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("container stats: %w", err)
+	}
+	return parsePodmanCLIStats(output)
+}
+
+func parsePodmanCLIStats(output []byte) ([]containerStats, error) {
+	trimmed := strings.TrimSpace(string(output))
+	if trimmed == "" || trimmed == "null" {
+		return []containerStats{}, nil
+	}
+
+	var raw []podmanCLIStats
+	if err := json.Unmarshal([]byte(trimmed), &raw); err != nil {
+		return nil, err
+	}
+
+	stats := make([]containerStats, 0, len(raw))
+	for _, entry := range raw {
+		memUsage, memLimit := parseHumanBytesPair(entry.MemUsage)
+		netRx, netTx := parseHumanBytesPair(entry.NetIO)
+		blockRead, blockWrite := parseHumanBytesPair(entry.BlockIO)
+		pids, _ := strconv.ParseUint(strings.TrimSpace(entry.PIDs), 10, 64)
+		stats = append(stats, containerStats{
+			ID:            entry.ID,
+			CPUPercent:    parsePercent(entry.CPUPercent),
+			MemoryUsage:   memUsage,
+			MemoryLimit:   memLimit,
+			MemoryPercent: parsePercent(entry.MemPercent),
+			NetworkRx:     netRx,
+			NetworkTx:     netTx,
+			BlockRead:     blockRead,
+			BlockWrite:    blockWrite,
+			PIDs:          pids,
+		})
+	}
+	return stats, nil
+}
+
+func sortedMapKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (r *podmanCLIRuntime) ImageExists(ctx context.Context, imageRef string) (bool, error) {
+	output, err := r.run(ctx, "image", "exists", imageRef)
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return false, nil
+	}
+	if errors.Is(err, errPodmanUnavailable) {
+		return false, err
+	}
+	return false, fmt.Errorf("image exists: %w: %s", err, strings.TrimSpace(string(output)))
+}
+
+func (r *podmanCLIRuntime) Pull(ctx context.Context, imageRef string, policy string) error {
+	if policy == imagePullMissing {
+		exists, err := r.ImageExists(ctx, imageRef)
+		if err != nil || exists {
+			return err
+		}
+	}
+	output, err := r.run(ctx, "pull", "--quiet", imageRef)
+	if err != nil {
+		return fmt.Errorf("pull image: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) Commit(ctx context.Context, containerID string, imageRef string) error {
+	output, err := r.run(ctx, "commit", "--quiet", containerID, imageRef)
+	if err != nil {
+		switch {
+		case errors.Is(err, errPodmanUnavailable):
+			return err
+		case isPodmanContainerNotFound(output):
+			return errPodmanContainerNotFound
+		default:
+			return fmt.Errorf("commit container: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) RemoveImage(ctx context.Context, imageRef string) error {
+	output, err := r.run(ctx, "rmi", imageRef)
+	if err != nil {
+		text := strings.ToLower(string(output))
+		switch {
+		case errors.Is(err, errPodmanUnavailable):
+			return err
+		case strings.Contains(text, "image not known"), strings.Contains(text, "no such image"):
+			return nil
+		case strings.Contains(text, "in use"), strings.Contains(text, "being used"):
+			return errImageInUse
+		default:
+			return fmt.Errorf("remove image: %w: %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) SaveImage(ctx context.Context, imageRef string, w io.Writer) error {
+	if !r.Available() {
+		return errPodmanUnavailable
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "podman", "save", "--format", "docker-archive", imageRef)
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("save image: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) LoadImage(ctx context.Context, reader io.Reader) error {
+	if !r.Available() {
+		return errPodmanUnavailable
+	}
+
+	cmd := exec.CommandContext(ctx, "podman", "load", "--quiet")
+	cmd.Stdin = reader
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("load image: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (r *podmanCLIRuntime) Build(ctx context.Context, opts containerBuildOptions, handle func(line string)) error {
+	if !r.Available() {
+		return errPodmanUnavailable
+	}
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	cmd := exec.CommandContext(ctx, "podman", buildPodmanBuildArgs(opts)...)
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+	if err := cmd.Start(); err != nil {
+		writer.Close()
+		return err
+	}
+	writer.Close()
+
+	lastLine := ""
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) != "" {
+			lastLine = line
+		}
+		handle(line)
+	}
+	if err := scanner.Err(); err != nil {
+		// Keep reading so podman does not block writing to the pipe.
+		_, _ = io.Copy(io.Discard, reader)
+		_ = cmd.Wait()
+		return fmt.Errorf("image build: %w", err)
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("image build: %s", strings.TrimSpace(lastLine))
+	}
+	return nil
+}
+
+func buildPodmanBuildArgs(opts containerBuildOptions) []string {
+	args := []string{"build", "--file", filepath.Join(opts.ContextDir, filepath.FromSlash(opts.Dockerfile)), "--tag", opts.Tag}
+	for _, key := range sortedMapKeys(opts.Args) {
+		args = append(args, "--build-arg", key+"="+opts.Args[key])
+	}
+	for _, key := range sortedMapKeys(opts.Labels) {
+		args = append(args, "--label", key+"="+opts.Labels[key])
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	return append(args, opts.ContextDir)
+}
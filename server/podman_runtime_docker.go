@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	dockerAPIPrefix         = "/v1.41"
+	dockerDefaultSocketPath = "/var/run/docker.sock"
+	dockerStatsWorkers      = 4
+)
+
+var dockerEventStatusAliases = map[string]string{
+	"die":     "died",
+	"destroy": "remove",
+}
+
+type dockerRuntime struct {
+	client *engineAPIClient
+}
+
+func newDockerRuntime(socketPath string) *dockerRuntime {
+	return &dockerRuntime{client: newEngineAPIClient(socketPath, dockerAPIPrefix)}
+}
+
+func resolveDockerSocketPath() string {
+	candidates := []string{}
+	if host := strings.TrimSpace(os.Getenv("DOCKER_HOST")); strings.HasPrefix(host, "unix://") {
+		candidates = append(candidates, strings.TrimPrefix(host, "unix://"))
+	}
+	candidates = append(candidates, dockerDefaultSocketPath)
+
+	for _, candidate := range candidates {
+		if isUnixSocket(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func (r *dockerRuntime) Name() string {
+	return "docker-api"
+}
+
+func (r *dockerRuntime) Available() bool {
+	return r.client.available()
+}
+
+func (r *dockerRuntime) List(ctx context.Context) ([]podmanContainer, error) {
+	query := url.Values{"all": {"1"}, "size": {"1"}}
+	var raw []json.RawMessage
+	if _, err := r.client.doJSON(ctx, http.MethodGet, "/containers/json", query, nil, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return []podmanContainer{}, nil
+	}
+
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := parsePodmanContainers(encoded)
+	if err != nil {
+		return nil, err
+	}
+	for i := range containers {
+		containers[i].Name = strings.TrimPrefix(containers[i].Name, "/")
+		// Docker lists ports as objects, which the podman parser skips.
+		var item struct {
+			Ports []dockerPort `json:"Ports"`
+		}
+		if err := json.Unmarshal(raw[i], &item); err == nil {
+			containers[i].Ports = formatDockerPorts(item.Ports)
+		}
+	}
+	return containers, nil
+}
+
+type dockerPort struct {
+	IP          string `json:"IP"`
+	PrivatePort int    `json:"PrivatePort"`
+	PublicPort  int    `json:"PublicPort"`
+	Type        string `json:"Type"`
+}
+
+func formatDockerPorts(ports []dockerPort) string {
+	out := make([]string, 0, len(ports))
+	for _, port := range ports {
+		entry := fmt.Sprintf("%d/%s", port.PrivatePort, port.Type)
+		if port.PublicPort != 0 {
+			entry = fmt.Sprintf("%d->%s", port.PublicPort, entry)
+			if port.IP != "" {
+				entry = net.JoinHostPort(port.IP, entry)
+			}
+		}
+		out = append(out, entry)
+	}
+	return strings.Join(out, ", ")
+}
+
+func (r *dockerRuntime) Inspect(ctx context.Context, containerID string) (podmanInspectSummary, error) {
+	var inspected podmanInspectSummary
+	if _, err := r.client.doJSON(ctx, http.MethodGet, "/containers/"+url.PathEscape(containerID)+"/json", nil, nil, &inspected); err != nil {
+		return podmanInspectSummary{}, err
+	}
+	return inspected, nil
+}
+
+func (r *dockerRuntime) Create(ctx context.Context, spec containerCreateSpec) (string, error) {
+	if spec.Pull != "" {
+		if err := r.Pull(ctx, spec.Image, spec.Pull); err != nil {
+			return "", err
+		}
+	}
+
+	mounts := make([]map[string]any, 0, len(spec.Mounts))
+	for _, raw := range spec.Mounts {
+		mount := parseMountArg(raw)
+		mounts = append(mounts, map[string]any{
+			"Type":     mount.Type,
+			"Source":   mount.Source,
+			"Target":   mount.Target,
+			"ReadOnly": mount.ReadOnly,
+		})
+	}
+
+	env := make([]string, 0, len(spec.Env))
+	for _, key := range sortedMapKeys(spec.Env) {
+		env = append(env, fmt.Sprintf("%s=%s", key, spec.Env[key]))
+	}
+
+	body := map[string]any{
+		"Image":  spec.Image,
+		"Env":    env,
+		"Labels": spec.Labels,
+		"Cmd":    spec.Command,
+		"HostConfig": map[string]any{
+			"Mounts":    mounts,
+			"NanoCpus":  int64(spec.Limits.CPUs * 1e9),
+			"Memory":    spec.Limits.Memory,
+			"PidsLimit": spec.Limits.PidsLimit,
+			"ShmSize":   spec.Limits.ShmSize,
+		},
+	}
+	if spec.Entrypoint != "" {
+		body["Entrypoint"] = []string{spec.Entrypoint}
+	}
+
+	query := url.Values{}
+	if spec.Name != "" {
+		query.Set("name", spec.Name)
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if _, err := r.client.doJSON(ctx, http.MethodPost, "/containers/create", query, body, &created); err != nil {
+		var apiErr *engineAPIError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusConflict {
+			return "", errContainerNameConflict
+		}
+		return "", fmt.Errorf("create container: %w", err)
+	}
+	if created.ID == "" {
+		return "", errors.New("empty container id")
+	}
+
+	return created.ID, nil
+}
+
+func (r *dockerRuntime) Pull(ctx context.Context, imageRef string, policy string) error {
+	if policy == imagePullMissing {
+		exists, err := r.ImageExists(ctx, imageRef)
+		if err != nil {
+			return fmt.Errorf("inspect image: %w", err)
+		}
+		if exists {
+			return nil
+		}
+	}
+
+	repository, tag := splitImageReference(imageRef)
+	query := url.Values{"fromImage": {repository}, "tag": {tag}}
+	resp, err := r.client.do(ctx, http.MethodPost, "/images/create", query, nil)
+	if err != nil {
+		return fmt.Errorf("pull image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := drainEngineProgress(resp.Body); err != nil {
+		return fmt.Errorf("pull image: %w", err)
+	}
+	return nil
+}
+
+func (r *dockerRuntime) Commit(ctx context.Context, containerID string, imageRef string) error {
+	return commitEngineContainer(ctx, r.client, containerID, imageRef)
+}
+
+func (r *dockerRuntime) RemoveImage(ctx context.Context, imageRef string) error {
+	return removeEngineImage(ctx, r.client, imageRef)
+}
+
+func (r *dockerRuntime) SaveImage(ctx context.Context, imageRef string, w io.Writer) error {
+	return saveEngineImage(ctx, r.client, imageRef, w)
+}
+
+func (r *dockerRuntime) LoadImage(ctx context.Context, reader io.Reader) error {
+	return loadEngineImage(ctx, r.client, reader)
+}
+
+func (r *dockerRuntime) ImageExists(ctx context.Context, imageRef string) (bool, error) {
+	_, err := r.client.doJSON(ctx, http.MethodGet, "/images/"+url.PathEscape(imageRef)+"/json", nil, nil, nil)
+	if err == nil {
+		return true, nil
+	}
+	var apiErr *engineAPIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return false, nil
+	}
+	return false, err
+}
+
+func (r *dockerRuntime) Build(ctx context.Context, opts containerBuildOptions, handle func(line string)) error {
+	return streamEngineBuild(ctx, r.client, opts, handle)
+}
+
+func (r *dockerRuntime) Start(ctx context.Context, containerID string) error {
+	status, err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/start", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotModified {
+		return errContainerAlreadyRunning
+	}
+	return nil
+}
+
+func (r *dockerRuntime) Stop(ctx context.Context, containerID string) error {
+	status, err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/stop", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotModified {
+		return errContainerAlreadyStopped
+	}
+	return nil
+}
+
+func (r *dockerRuntime) Restart(ctx context.Context, containerID string) error {
+	return postEngineContainerAction(ctx, r.client, containerID, "restart")
+}
+
+func (r *dockerRuntime) Pause(ctx context.Context, containerID string) error {
+	return postEngineContainerAction(ctx, r.client, containerID, "pause")
+}
+
+func (r *dockerRuntime) Unpause(ctx context.Context, containerID string) error {
+	return postEngineContainerAction(ctx, r.client, containerID, "unpause")
+}
+
+func (r *dockerRuntime) Remove(ctx context.Context, containerID string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	_, err := r.client.doJSON(ctx, http.MethodDelete, "/containers/"+url.PathEscape(containerID), query, nil, nil)
+	return err
+}
+
+func (r *dockerRuntime) Exec(ctx context.Context, containerID string, opts containerExecOptions) ([]byte, error) {
+	return runEngineExec(ctx, r.client, containerID, opts)
+}
+
+func (r *dockerRuntime) Events(ctx context.Context, handle func(podmanEvent)) error {
+	query := url.Values{"filters": {`{"type":["container"]}`}}
+	return streamEngineEvents(ctx, r.client, query, func(event podmanEvent) {
+		if alias, ok := dockerEventStatusAliases[strings.ToLower(event.Status)]; ok {
+			event.Status = alias
+		}
+		handle(event)
+	})
+}
+
+func splitImageReference(imageRef string) (string, string) {
+	if strings.Contains(imageRef, "@") {
+		return imageRef, ""
+	}
+	lastSlash := strings.LastIndex(imageRef, "/")
+	if idx := strings.LastIndex(imageRef, ":"); idx > lastSlash {
+		return imageRef[:idx], imageRef[idx+1:]
+	}
+	return imageRef, "latest"
+}
+
+func (r *dockerRuntime) Logs(ctx context.Context, containerID string, opts containerLogOptions, handle func(containerLogLine)) error {
+	return streamEngineLogs(ctx, r.client, containerID, opts, handle)
+}
+
+func (r *dockerRuntime) Terminal(ctx context.Context, containerID string, opts containerTerminalOptions) (containerTerminal, error) {
+	return openEngineTerminal(ctx, r.client, containerID, opts)
+}
+
+type dockerStatsResponse struct {
+	ID       string `json:"id"`
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+		OnlineCPUs  uint64 `json:"online_cpus"`
+	} `json:"cpu_stats"`
+	PreCPUStats struct {
+		CPUUsage struct {
+			TotalUsage uint64 `json:"total_usage"`
+		} `json:"cpu_usage"`
+		SystemUsage uint64 `json:"system_cpu_usage"`
+	} `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+func (r *dockerRuntime) Stats(ctx context.Context) ([]containerStats, error) {
+	var running []struct {
+		ID string `json:"Id"`
+	}
+	if _, err := r.client.doJSON(ctx, http.MethodGet, "/containers/json", nil, nil, &running); err != nil {
+		return nil, err
+	}
+
+	samples := make([]*containerStats, len(running))
+	workers := make(chan struct{}, dockerStatsWorkers)
+	var wg sync.WaitGroup
+	for i, container := range running {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			var raw dockerStatsResponse
+			query := url.Values{"stream": {"false"}}
+			if _, err := r.client.doJSON(ctx, http.MethodGet, "/containers/"+url.PathEscape(container.ID)+"/stats", query, nil, &raw); err != nil {
+				return
+			}
+			if raw.ID == "" {
+				raw.ID = container.ID
+			}
+			sample := raw.toContainerStats()
+			samples[i] = &sample
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	stats := make([]containerStats, 0, len(running))
+	for _, sample := range samples {
+		if sample != nil {
+			stats = append(stats, *sample)
+		}
+	}
+	return stats, nil
+}
+
+func (d dockerStatsResponse) toContainerStats() containerStats {
+	stats := containerStats{
+		ID:          d.ID,
+		MemoryLimit: d.MemoryStats.Limit,
+		PIDs:        d.PidsStats.Current,
+	}
+
+	cpuDelta := float64(d.CPUStats.CPUUsage.TotalUsage) - float64(d.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(d.CPUStats.SystemUsage) - float64(d.PreCPUStats.SystemUsage)
+	if cpuDelta > 0 && systemDelta > 0 {
+		onlineCPUs := float64(d.CPUStats.OnlineCPUs)
+		if onlineCPUs == 0 {
+			onlineCPUs = 1
+		}
+		stats.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	usage := d.MemoryStats.Usage
+	cache := d.MemoryStats.Stats["inactive_file"]
+	if cache == 0 {
+		cache = d.MemoryStats.Stats["total_inactive_file"]
+	}
+	if cache < usage {
+		usage -= cache
+	}
+	stats.MemoryUsage = usage
+	if d.MemoryStats.Limit > 0 {
+		stats.MemoryPercent = float64(usage) / float64(d.MemoryStats.Limit) * 100
+	}
+
+	for _, network := range d.Networks {
+		stats.NetworkRx += network.RxBytes
+		stats.NetworkTx += network.TxBytes
+	}
+	for _, entry := range d.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockRead += entry.Value
+		case "write":
+			stats.BlockWrite += entry.Value
+		}
+	}
+
+	return stats
+}
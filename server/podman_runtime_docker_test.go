@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDockerRuntimeListTrimsNames(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"Id":"abc","Names":["/ws-one"],"Image":"alpine","State":"running","Status":"Up 2 minutes","Labels":{"pocketpod.repo":"r"},` +
+			`"Ports":[{"IP":"0.0.0.0","PrivatePort":80,"PublicPort":8080,"Type":"tcp"},{"IP":"::","PrivatePort":80,"PublicPort":8080,"Type":"tcp"},{"PrivatePort":443,"Type":"tcp"}]}]`))
+	})
+
+	rt := newDockerRuntime(serveEngineAPI(t, mux))
+	containers, err := rt.List(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(containers) != 1 || containers[0].Name != "ws-one" || containers[0].Status != "Up 2 minutes" {
+		t.Fatalf("unexpected containers: %+v", containers)
+	}
+	if want := "0.0.0.0:8080->80/tcp, [::]:8080->80/tcp, 443/tcp"; containers[0].Ports != want {
+		t.Fatalf("expected ports %q, got %q", want, containers[0].Ports)
+	}
+}
+
+func TestDockerRuntimeCreateSendsSpecAndMapsConflict(t *testing.T) {
+	var received map[string]any
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/images/alpine/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id":"sha256:1"}`))
+	})
+	mux.HandleFunc("POST /v1.41/containers/create", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") == "taken" {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"message":"Conflict. The container name \"/taken\" is already in use"}`))
+			return
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		_, _ = w.Write([]byte(`{"Id":"new-id"}`))
+	})
+
+	rt := newDockerRuntime(serveEngineAPI(t, mux))
+	id, err := rt.Create(context.Background(), containerCreateSpec{
+		Name:    "ws",
+		Image:   "alpine",
+		Pull:    "missing",
+		Mounts:  []string{formatWorkspaceMountArg("/host/ws", "/home/dev/workspaces")},
+		Env:     map[string]string{"FOO": "bar"},
+		Labels:  map[string]string{labelWorkspaceRepo: "r"},
+		Command: []string{"sh", "-lc", "true"},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if id != "new-id" {
+		t.Fatalf("unexpected id %q", id)
+	}
+
+	hostConfig, _ := received["HostConfig"].(map[string]any)
+	mounts, _ := hostConfig["Mounts"].([]any)
+	if len(mounts) != 1 || mounts[0].(map[string]any)["Target"] != "/home/dev/workspaces" {
+		t.Fatalf("unexpected mounts: %#v", hostConfig)
+	}
+	if env, _ := received["Env"].([]any); len(env) != 1 || env[0] != "FOO=bar" {
+		t.Fatalf("unexpected env: %#v", received["Env"])
+	}
+
+	_, err = rt.Create(context.Background(), containerCreateSpec{Name: "taken", Image: "alpine"})
+	if !errors.Is(err, errContainerNameConflict) {
+		t.Fatalf("expected name conflict, got %v", err)
+	}
+}
+
+func TestDockerRuntimeEventsMapsActions(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/events", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Type":"container","Action":"die","Actor":{"ID":"abc","Attributes":{"name":"ws-one"}}}` + "\n"))
+		_, _ = w.Write([]byte(`{"Type":"container","Action":"destroy","Actor":{"ID":"abc","Attributes":{"name":"ws-one"}}}` + "\n"))
+		_, _ = w.Write([]byte(`{"Type":"container","Action":"exec_start: sh -lc true","Actor":{"ID":"abc"}}` + "\n"))
+	})
+
+	rt := newDockerRuntime(serveEngineAPI(t, mux))
+	var statuses []string
+	if err := rt.Events(context.Background(), func(event podmanEvent) {
+		statuses = append(statuses, event.Status)
+	}); err != nil {
+		t.Fatalf("events: %v", err)
+	}
+
+	want := []string{"died", "remove", "exec_start"}
+	if len(statuses) != len(want) {
+		t.Fatalf("unexpected statuses %v", statuses)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, statuses)
+		}
+	}
+}
+
+func TestSplitImageReference(t *testing.T) {
+	tests := []struct {
+		ref      string
+		wantRepo string
+		wantTag  string
+	}{
+		{"mcr.microsoft.com/devcontainers/universal", "mcr.microsoft.com/devcontainers/universal", "latest"},
+		{"alpine:3.20", "alpine", "3.20"},
+		{"localhost:5000/team/image", "localhost:5000/team/image", "latest"},
+		{"localhost:5000/team/image:v1", "localhost:5000/team/image", "v1"},
+		{"alpine@sha256:abc", "alpine@sha256:abc", ""},
+	}
+
+	for _, tt := range tests {
+		repo, tag := splitImageReference(tt.ref)
+		if repo != tt.wantRepo || tag != tt.wantTag {
+			t.Fatalf("%s: expected %q %q, got %q %q", tt.ref, tt.wantRepo, tt.wantTag, repo, tag)
+		}
+	}
+}
+
+func TestDecodeEngineBuildStream(t *testing.T) {
+	body := `{"stream":"Step 1/2 : FROM alpine\n"}
+{"stream":"Step 2/2 : RUN false"}
+{"stream":"\n"}
+{"errorDetail":{"message":"returned a non-zero code: 1"},"error":"returned a non-zero code: 1"}
+`
+	var lines []string
+	err := decodeEngineBuildStream(strings.NewReader(body), func(line string) {
+		lines = append(lines, line)
+	})
+	if err == nil || !strings.Contains(err.Error(), "non-zero code") {
+		t.Fatalf("expected build error, got %v", err)
+	}
+	want := []string{"Step 1/2 : FROM alpine", "Step 2/2 : RUN false", "returned a non-zero code: 1"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Fatalf("expected %q, got %q", want, lines)
+	}
+}
+
+func TestResolveContainerRuntimeHonoursConfiguration(t *testing.T) {
+	t.Setenv("PODMAN_SOCKET", filepath.Join(t.TempDir(), "missing.sock"))
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("DOCKER_HOST", "unix://"+filepath.Join(t.TempDir(), "missing.sock"))
+
+	if name := resolveContainerRuntime("docker").Name(); name != "docker-api" {
+		t.Fatalf("expected docker runtime, got %q", name)
+	}
+	if name := resolveContainerRuntime("podman-cli").Name(); name != "podman-cli" {
+		t.Fatalf("expected podman cli runtime, got %q", name)
+	}
+}
+
+func TestDockerRuntimeStatsSkipsFailingContainers(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"Id":"abc"},{"Id":"def"}]`))
+	})
+	mux.HandleFunc("GET /v1.41/containers/abc/stats", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"abc","memory_stats":{"usage":1048576,"limit":4194304},"pids_stats":{"current":3}}`))
+	})
+	mux.HandleFunc("GET /v1.41/containers/def/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"message":"transient"}`))
+	})
+
+	rt := newDockerRuntime(serveEngineAPI(t, mux))
+	stats, err := rt.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if len(stats) != 1 || stats[0].ID != "abc" || stats[0].PIDs != 3 {
+		t.Fatalf("expected only abc sampled, got %+v", stats)
+	}
+}
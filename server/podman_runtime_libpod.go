@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	libpodAPIPrefix         = "/v4.0.0/libpod"
+	libpodRootfulSocketPath = "/run/podman/podman.sock"
+)
+
+type libpodRuntime struct {
+	client *engineAPIClient
+}
+
+type engineEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Status string `json:"status"`
+	ID     string `json:"id"`
+	From   string `json:"from"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+func newLibpodRuntime(socketPath string) *libpodRuntime {
+	return &libpodRuntime{client: newEngineAPIClient(socketPath, libpodAPIPrefix)}
+}
+
+func resolvePodmanSocketPath() string {
+	candidates := []string{strings.TrimPrefix(strings.TrimSpace(os.Getenv("PODMAN_SOCKET")), "unix://")}
+	if runtimeDir := strings.TrimSpace(os.Getenv("XDG_RUNTIME_DIR")); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	candidates = append(candidates, libpodRootfulSocketPath)
+
+	for _, candidate := range candidates {
+		if isUnixSocket(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+func (r *libpodRuntime) Name() string {
+	return "podman-api"
+}
+
+func (r *libpodRuntime) Available() bool {
+	return r.client.available()
+}
+
+func (r *libpodRuntime) List(ctx context.Context) ([]podmanContainer, error) {
+	query := url.Values{"all": {"true"}, "size": {"true"}}
+	resp, err := r.client.do(ctx, http.MethodGet, "/containers/json", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+	if buf.Len() == 0 {
+		return []podmanContainer{}, nil
+	}
+
+	return parsePodmanContainers(buf.Bytes())
+}
+
+func (r *libpodRuntime) Inspect(ctx context.Context, containerID string) (podmanInspectSummary, error) {
+	var inspected podmanInspectSummary
+	if _, err := r.client.doJSON(ctx, http.MethodGet, "/containers/"+url.PathEscape(containerID)+"/json", nil, nil, &inspected); err != nil {
+		return podmanInspectSummary{}, err
+	}
+	return inspected, nil
+}
+
+func (r *libpodRuntime) Create(ctx context.Context, spec containerCreateSpec) (string, error) {
+	if spec.Pull != "" {
+		if err := r.pull(ctx, spec.Image, spec.Pull); err != nil {
+			return "", err
+		}
+	}
+
+	mounts := make([]map[string]any, 0, len(spec.Mounts))
+	volumes := []map[string]any{}
+	for _, raw := range spec.Mounts {
+		mount := parseMountArg(raw)
+		options := []string{}
+		if mount.ReadOnly {
+			options = append(options, "ro")
+		}
+		// Named volumes are separate from OCI mounts in the libpod spec.
+		if mount.Type == "volume" {
+			volumes = append(volumes, map[string]any{
+				"Name":    mount.Source,
+				"Dest":    mount.Target,
+				"Options": options,
+			})
+			continue
+		}
+		mounts = append(mounts, map[string]any{
+			"type":        mount.Type,
+			"source":      mount.Source,
+			"destination": mount.Target,
+			"options":     options,
+		})
+	}
+
+	body := map[string]any{
+		"image":   spec.Image,
+		"env":     spec.Env,
+		"labels":  spec.Labels,
+		"mounts":  mounts,
+		"command": spec.Command,
+	}
+	if len(volumes) > 0 {
+		body["volumes"] = volumes
+	}
+	if spec.Name != "" {
+		body["name"] = spec.Name
+	}
+	if spec.Entrypoint != "" {
+		body["entrypoint"] = []string{spec.Entrypoint}
+	}
+	if resourceLimits := libpodResourceLimits(spec.Limits); len(resourceLimits) > 0 {
+		body["resource_limits"] = resourceLimits
+	}
+	if spec.Limits.ShmSize > 0 {
+		body["shm_size"] = spec.Limits.ShmSize
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if _, err := r.client.doJSON(ctx, http.MethodPost, "/containers/create", nil, body, &created); err != nil {
+		if isPodmanNameConflict([]byte(engineAPIErrorMessage(err))) {
+			return "", errContainerNameConflict
+		}
+		return "", fmt.Errorf("create container: %w", err)
+	}
+	if created.ID == "" {
+		return "", errors.New("empty container id")
+	}
+
+	return created.ID, nil
+}
+
+const libpodCPUPeriod = 100000
+
+func libpodResourceLimits(limits containerLimits) map[string]any {
+	resources := map[string]any{}
+	if limits.CPUs > 0 {
+		resources["cpu"] = map[string]any{
+			"quota":  int64(limits.CPUs * libpodCPUPeriod),
+			"period": libpodCPUPeriod,
+		}
+	}
+	if limits.Memory > 0 {
+		resources["memory"] = map[string]any{"limit": limits.Memory}
+	}
+	if limits.PidsLimit > 0 {
+		resources["pids"] = map[string]any{"limit": limits.PidsLimit}
+	}
+	return resources
+}
+
+func (r *libpodRuntime) pull(ctx context.Context, imageRef string, policy string) error {
+	query := url.Values{"reference": {imageRef}, "policy": {policy}, "quiet": {"true"}}
+	resp, err := r.client.do(ctx, http.MethodPost, "/images/pull", query, nil)
+	if err != nil {
+		return fmt.Errorf("pull image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := drainEngineProgress(resp.Body); err != nil {
+		return fmt.Errorf("pull image: %w", err)
+	}
+	return nil
+}
+
+func (r *libpodRuntime) Pull(ctx context.Context, imageRef string, policy string) error {
+	return r.pull(ctx, imageRef, policy)
+}
+
+func (r *libpodRuntime) Commit(ctx context.Context, containerID string, imageRef string) error {
+	return commitEngineContainer(ctx, r.client, containerID, imageRef)
+}
+
+func (r *libpodRuntime) RemoveImage(ctx context.Context, imageRef string) error {
+	return removeEngineImage(ctx, r.client, imageRef)
+}
+
+func (r *libpodRuntime) SaveImage(ctx context.Context, imageRef string, w io.Writer) error {
+	return saveEngineImage(ctx, r.client, imageRef, w)
+}
+
+func (r *libpodRuntime) LoadImage(ctx context.Context, reader io.Reader) error {
+	return loadEngineImage(ctx, r.client, reader)
+}
+
+func (r *libpodRuntime) ImageExists(ctx context.Context, imageRef string) (bool, error) {
+	_, err := r.client.doJSON(ctx, http.MethodGet, "/images/"+url.PathEscape(imageRef)+"/exists", nil, nil, nil)
+	if err == nil {
+		return true, nil
+	}
+	var apiErr *engineAPIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return false, nil
+	}
+	return false, err
+}
+
+func (r *libpodRuntime) Build(ctx context.Context, opts containerBuildOptions, handle func(line string)) error {
+	return streamEngineBuild(ctx, r.client, opts, handle)
+}
+
+func (r *libpodRuntime) Start(ctx context.Context, containerID string) error {
+	status, err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/start", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotModified {
+		return errContainerAlreadyRunning
+	}
+	return nil
+}
+
+func (r *libpodRuntime) Stop(ctx context.Context, containerID string) error {
+	status, err := r.client.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/stop", nil, nil, nil)
+	if err != nil {
+		if isPodmanContainerAlreadyStopped([]byte(engineAPIErrorMessage(err))) {
+			return errContainerAlreadyStopped
+		}
+		return err
+	}
+	if status == http.StatusNotModified {
+		return errContainerAlreadyStopped
+	}
+	return nil
+}
+
+func (r *libpodRuntime) Restart(ctx context.Context, containerID string) error {
+	return postEngineContainerAction(ctx, r.client, containerID, "restart")
+}
+
+func (r *libpodRuntime) Pause(ctx context.Context, containerID string) error {
+	return postEngineContainerAction(ctx, r.client, containerID, "pause")
+}
+
+func (r *libpodRuntime) Unpause(ctx context.Context, containerID string) error {
+	return postEngineContainerAction(ctx, r.client, containerID, "unpause")
+}
+
+func (r *libpodRuntime) Remove(ctx context.Context, containerID string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+	_, err := r.client.doJSON(ctx, http.MethodDelete, "/containers/"+url.PathEscape(containerID), query, nil, nil)
+	return err
+}
+
+func (r *libpodRuntime) Exec(ctx context.Context, containerID string, opts containerExecOptions) ([]byte, error) {
+	return runEngineExec(ctx, r.client, containerID, opts)
+}
+
+func (r *libpodRuntime) Events(ctx context.Context, handle func(podmanEvent)) error {
+	query := url.Values{
+		"stream":  {"true"},
+		"filters": {`{"type":["container"]}`},
+	}
+	return streamEngineEvents(ctx, r.client, query, handle)
+}
+
+func runEngineExec(ctx context.Context, client *engineAPIClient, containerID string, opts containerExecOptions) ([]byte, error) {
+	createBody := map[string]any{
+		"AttachStdout": !opts.Detach,
+		"AttachStderr": !opts.Detach,
+		"Cmd":          opts.Cmd,
+	}
+	if opts.User != "" {
+		createBody["User"] = opts.User
+	}
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if _, err := client.doJSON(ctx, http.MethodPost, "/containers/"+url.PathEscape(containerID)+"/exec", nil, createBody, &created); err != nil {
+		return nil, err
+	}
+
+	startBody := map[string]any{"Detach": opts.Detach, "Tty": false}
+	resp, err := client.do(ctx, http.MethodPost, "/exec/"+url.PathEscape(created.ID)+"/start", nil, startBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var output bytes.Buffer
+	if !opts.Detach {
+		if err := demuxEngineStream(&output, resp.Body); err != nil {
+			return output.Bytes(), err
+		}
+	}
+
+	var inspected struct {
+		Running  bool `json:"Running"`
+		ExitCode int  `json:"ExitCode"`
+	}
+	if _, err := client.doJSON(ctx, http.MethodGet, "/exec/"+url.PathEscape(created.ID)+"/json", nil, nil, &inspected); err != nil {
+		return output.Bytes(), err
+	}
+	if !opts.Detach && !inspected.Running && inspected.ExitCode != 0 {
+		return output.Bytes(), fmt.Errorf("exit status %d", inspected.ExitCode)
+	}
+
+	return output.Bytes(), nil
+}
+
+func streamEngineEvents(ctx context.Context, client *engineAPIClient, query url.Values, handle func(podmanEvent)) error {
+	resp, err := client.do(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var event engineEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		handle(event.toPodmanEvent())
+	}
+
+	return scanner.Err()
+}
+
+func (e engineEvent) toPodmanEvent() podmanEvent {
+	status := e.Action
+	if status == "" {
+		status = e.Status
+	}
+	// Docker reports exec and health events as "exec_start: sh" and similar.
+	status, _, _ = strings.Cut(status, ":")
+
+	id := e.Actor.ID
+	if id == "" {
+		id = e.ID
+	}
+	image := e.Actor.Attributes["image"]
+	if image == "" {
+		image = e.From
+	}
+
+	return podmanEvent{
+		ID:     id,
+		Name:   e.Actor.Attributes["name"],
+		Image:  image,
+		Status: strings.TrimSpace(status),
+		Type:   e.Type,
+	}
+}
+
+func (r *libpodRuntime) Logs(ctx context.Context, containerID string, opts containerLogOptions, handle func(containerLogLine)) error {
+	return streamEngineLogs(ctx, r.client, containerID, opts, handle)
+}
+
+func (r *libpodRuntime) Terminal(ctx context.Context, containerID string, opts containerTerminalOptions) (containerTerminal, error) {
+	return openEngineTerminal(ctx, r.client, containerID, opts)
+}
+
+func (r *libpodRuntime) Stats(ctx context.Context) ([]containerStats, error) {
+	var report struct {
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"Error"`
+		Stats []struct {
+			ContainerID string  `json:"ContainerID"`
+			CPU         float64 `json:"CPU"`
+			MemUsage    uint64  `json:"MemUsage"`
+			MemLimit    uint64  `json:"MemLimit"`
+			MemPerc     float64 `json:"MemPerc"`
+			NetInput    uint64  `json:"NetInput"`
+			NetOutput   uint64  `json:"NetOutput"`
+			BlockInput  uint64  `json:"BlockInput"`
+			BlockOutput uint64  `json:"BlockOutput"`
+			PIDs        uint64  `json:"PIDs"`
+		} `json:"Stats"`
+	}
+	query := url.Values{"stream": {"false"}}
+	if _, err := r.client.doJSON(ctx, http.MethodGet, "/containers/stats", query, nil, &report); err != nil {
+		return nil, err
+	}
+	if report.Error != nil && report.Error.Message != "" {
+		return nil, errors.New(report.Error.Message)
+	}
+
+	stats := make([]containerStats, 0, len(report.Stats))
+	for _, entry := range report.Stats {
+		stats = append(stats, containerStats{
+			ID:            entry.ContainerID,
+			CPUPercent:    entry.CPU,
+			MemoryUsage:   entry.MemUsage,
+			MemoryLimit:   entry.MemLimit,
+			MemoryPercent: entry.MemPerc,
+			NetworkRx:     entry.NetInput,
+			NetworkTx:     entry.NetOutput,
+			BlockRead:     entry.BlockInput,
+			BlockWrite:    entry.BlockOutput,
+			PIDs:          entry.PIDs,
+		})
+	}
+	return stats, nil
+}
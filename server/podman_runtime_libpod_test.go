@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func serveEngineAPI(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "engine.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+
+	server := &http.Server{Handler: handler}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	return socketPath
+}
+
+func writeEngineFrame(buf *bytes.Buffer, stream byte, payload string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	buf.Write(header)
+	buf.WriteString(payload)
+}
+
+func TestLibpodRuntimeListAndInspect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4.0.0/libpod/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("all") != "true" {
+			t.Errorf("expected all=true, got %q", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`[{"Id":"abc","Names":["ws-one"],"Image":"alpine","State":"running","Labels":{"pocketpod.repo":"r"}}]`))
+	})
+	mux.HandleFunc("GET /v4.0.0/libpod/containers/abc/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Name":"ws-one","State":{"Status":"running","Running":true}}`))
+	})
+	mux.HandleFunc("GET /v4.0.0/libpod/containers/missing/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"cause":"no such container","message":"no container with name or ID \"missing\" found: no such container","response":404}`))
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	if !rt.Available() {
+		t.Fatal("expected runtime to be available")
+	}
+
+	containers, err := rt.List(context.Background())
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(containers) != 1 || containers[0].Name != "ws-one" || containers[0].Labels["pocketpod.repo"] != "r" {
+		t.Fatalf("unexpected containers: %+v", containers)
+	}
+
+	inspected, err := rt.Inspect(context.Background(), "abc")
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if !inspected.State.Running || inspected.Name != "ws-one" {
+		t.Fatalf("unexpected inspect: %+v", inspected)
+	}
+
+	if _, err := rt.Inspect(context.Background(), "missing"); !errors.Is(err, errPodmanContainerNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestLibpodRuntimeStartStopStates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v4.0.0/libpod/containers/running/start", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/containers/running/stop", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/containers/exited/stop", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	if err := rt.Start(context.Background(), "running"); !errors.Is(err, errContainerAlreadyRunning) {
+		t.Fatalf("expected already running, got %v", err)
+	}
+	if err := rt.Stop(context.Background(), "running"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := rt.Stop(context.Background(), "exited"); !errors.Is(err, errContainerAlreadyStopped) {
+		t.Fatalf("expected already stopped, got %v", err)
+	}
+}
+
+func TestLibpodRuntimeExecCollectsOutputAndExitCode(t *testing.T) {
+	exitCode := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v4.0.0/libpod/containers/abc/exec", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id":"exec1"}`))
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/exec/exec1/start", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		writeEngineFrame(&buf, 1, "alive\n")
+		writeEngineFrame(&buf, 2, "warning\n")
+		_, _ = w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("GET /v4.0.0/libpod/exec/exec1/json", func(w http.ResponseWriter, r *http.Request) {
+		if exitCode == 0 {
+			_, _ = w.Write([]byte(`{"Running":false,"ExitCode":0}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Running":false,"ExitCode":3}`))
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	output, err := execContainerShell(rt, "abc", "echo alive")
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if string(output) != "alive\nwarning\n" {
+		t.Fatalf("unexpected output %q", output)
+	}
+
+	exitCode = 3
+	if _, err := execContainerShell(rt, "abc", "false"); err == nil || !strings.Contains(err.Error(), "exit status 3") {
+		t.Fatalf("expected exit status error, got %v", err)
+	}
+}
+
+func TestLibpodRuntimeEvents(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4.0.0/libpod/events", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Type":"container","Action":"start","Actor":{"ID":"abc","Attributes":{"name":"ws-one","image":"alpine"}}}` + "\n"))
+		_, _ = w.Write([]byte("not json\n"))
+		_, _ = w.Write([]byte(`{"Type":"container","status":"died","id":"abc","from":"alpine"}` + "\n"))
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	var events []podmanEvent
+	if err := rt.Events(context.Background(), func(event podmanEvent) {
+		events = append(events, event)
+	}); err != nil {
+		t.Fatalf("events: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("expected two events, got %+v", events)
+	}
+	if events[0] != (podmanEvent{ID: "abc", Name: "ws-one", Image: "alpine", Status: "start", Type: "container"}) {
+		t.Fatalf("unexpected first event: %+v", events[0])
+	}
+	if events[1].Status != "died" || events[1].ID != "abc" || events[1].Image != "alpine" {
+		t.Fatalf("unexpected second event: %+v", events[1])
+	}
+}
+
+func TestLibpodRuntimeUnavailableWithoutSocket(t *testing.T) {
+	rt := newLibpodRuntime(filepath.Join(t.TempDir(), "missing.sock"))
+	if rt.Available() {
+		t.Fatal("expected runtime to be unavailable")
+	}
+	if _, err := rt.List(context.Background()); !errors.Is(err, errPodmanUnavailable) {
+		t.Fatalf("expected unavailable error, got %v", err)
+	}
+}
+
+func TestParseMountArg(t *testing.T) {
+	mount := parseMountArg("type=bind,src=/host/ws,dst=/home/dev/workspaces,ro")
+	if mount.Type != "bind" || mount.Source != "/host/ws" || mount.Target != "/home/dev/workspaces" || !mount.ReadOnly {
+		t.Fatalf("unexpected mount: %+v", mount)
+	}
+}
+
+func TestLibpodRuntimePauseStates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v4.0.0/libpod/containers/paused/pause", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"cause":"container state improper","message":"\"paused\" is already paused: container state improper","response":500}`))
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/containers/running/unpause", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"cause":"container state improper","message":"\"running\" is not paused, can't unpause: container state improper","response":500}`))
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/containers/running/restart", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	if err := rt.Pause(context.Background(), "paused"); !errors.Is(err, errContainerAlreadyPaused) {
+		t.Fatalf("expected already paused, got %v", err)
+	}
+	if err := rt.Unpause(context.Background(), "running"); !errors.Is(err, errContainerNotPaused) {
+		t.Fatalf("expected not paused, got %v", err)
+	}
+	if err := rt.Restart(context.Background(), "running"); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+}
+
+func TestLibpodRuntimeCommitAndRemoveImage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v4.0.0/libpod/commit", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("container") != "abc" || query.Get("repo") != "localhost/pocketpod-snapshot/user-1" || query.Get("tag") != "snap" || query.Get("pause") != "false" {
+			t.Errorf("unexpected commit query %q", r.URL.RawQuery)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"Id":"sha256:123"}`))
+	})
+	// Image references are escaped into a single path segment.
+	mux.HandleFunc("DELETE /v4.0.0/libpod/images/{name}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("name") {
+		case "localhost/pocketpod-snapshot/user-1:snap":
+			_, _ = w.Write([]byte(`{"Deleted":["sha256:123"]}`))
+		case "localhost/pocketpod-snapshot/user-1:used":
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"cause":"image is in use by a container","message":"image used by abc: image is in use by a container","response":409}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"cause":"image not known","message":"image not known","response":404}`))
+		}
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	if err := rt.Commit(context.Background(), "abc", "localhost/pocketpod-snapshot/user-1:snap"); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+	if err := rt.RemoveImage(context.Background(), "localhost/pocketpod-snapshot/user-1:snap"); err != nil {
+		t.Fatalf("remove image: %v", err)
+	}
+	if err := rt.RemoveImage(context.Background(), "localhost/pocketpod-snapshot/user-1:gone"); err != nil {
+		t.Fatalf("expected missing image ignored, got %v", err)
+	}
+	if err := rt.RemoveImage(context.Background(), "localhost/pocketpod-snapshot/user-1:used"); !errors.Is(err, errImageInUse) {
+		t.Fatalf("expected image in use, got %v", err)
+	}
+}
+
+func TestLibpodRuntimeSaveAndLoadImage(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4.0.0/libpod/images/{name}/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("name") != "localhost/pocketpod-exports/user-1:abc" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-tar")
+		_, _ = w.Write([]byte("image archive"))
+	})
+	mux.HandleFunc("POST /v4.0.0/libpod/images/load", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/x-tar" || string(body) != "image archive" {
+			t.Errorf("unexpected load %q %q", r.Header.Get("Content-Type"), body)
+		}
+		_, _ = w.Write([]byte(`{"Names":["localhost/pocketpod-snapshots/user-1:abc"]}`))
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	var saved bytes.Buffer
+	if err := rt.SaveImage(context.Background(), "localhost/pocketpod-exports/user-1:abc", &saved); err != nil || saved.String() != "image archive" {
+		t.Fatalf("save image: %q (%v)", saved.String(), err)
+	}
+	if err := rt.LoadImage(context.Background(), &saved); err != nil {
+		t.Fatalf("load image: %v", err)
+	}
+}
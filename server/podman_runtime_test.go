@@ -0,0 +1,704 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTunnelSession struct {
+	sessionID string
+	alive     bool
+	log       string
+}
+
+type fakeRuntime struct {
+	mu         sync.Mutex
+	containers []podmanContainer
+	created    []containerCreateSpec
+	execs      []containerExecOptions
+	passwd     string
+	sessions   map[string]fakeTunnelSession
+	nextID     int
+	restarts   int
+	logs       []containerLogLine
+	terminals  []*fakeTerminal
+	stats      []containerStats
+	createErr  error
+	startErr   error
+	images     map[string]bool
+	builds     []containerBuildOptions
+	buildLog   []string
+	buildErr   error
+	pulls      []string
+	pullErr    error
+
+	pullPolicies []string
+	commits      []string
+	loads        []string
+	env          map[string][]string
+	startErrOnce bool
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		passwd:   "root:x:0:0:root:/root:/bin/bash\nubuntu:x:1000:1000:ubuntu:/home/ubuntu:/bin/bash",
+		sessions: make(map[string]fakeTunnelSession),
+	}
+}
+
+func (r *fakeRuntime) setTunnelSession(containerID string, sessionID string, alive bool, log string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[containerID] = fakeTunnelSession{sessionID: sessionID, alive: alive, log: log}
+	if r.find(containerID) < 0 {
+		r.containers = append(r.containers, podmanContainer{
+			ID:     containerID,
+			Status: "running",
+			Labels: map[string]string{labelTunnelSession: sessionID},
+		})
+	}
+}
+
+func (r *fakeRuntime) Name() string { return "fake" }
+
+func (r *fakeRuntime) Available() bool { return true }
+
+func (r *fakeRuntime) List(context.Context) ([]podmanContainer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	containers := make([]podmanContainer, len(r.containers))
+	copy(containers, r.containers)
+	return containers, nil
+}
+
+func (r *fakeRuntime) find(containerID string) int {
+	for i := range r.containers {
+		if isContainerIDMatch(r.containers[i].ID, containerID) || r.containers[i].Name == containerID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *fakeRuntime) Inspect(_ context.Context, containerID string) (podmanInspectSummary, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := r.find(containerID)
+	if idx < 0 {
+		return podmanInspectSummary{}, errPodmanContainerNotFound
+	}
+	var summary podmanInspectSummary
+	summary.ID = r.containers[idx].ID
+	summary.Name = r.containers[idx].Name
+	summary.State.Status = strings.ToLower(r.containers[idx].Status)
+	summary.State.Running = summary.State.Status == "running"
+	summary.Config.Labels = r.containers[idx].Labels
+	summary.Config.Env = r.env[summary.ID]
+	return summary, nil
+}
+
+func (r *fakeRuntime) Create(_ context.Context, spec containerCreateSpec) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.createErr != nil {
+		return "", r.createErr
+	}
+	if spec.Name != "" && r.find(spec.Name) >= 0 {
+		return "", errContainerNameConflict
+	}
+	r.nextID++
+	id := fmt.Sprintf("c%03d", r.nextID)
+	name := spec.Name
+	if name == "" {
+		name = id
+	}
+	r.created = append(r.created, spec)
+	if r.env == nil {
+		r.env = make(map[string][]string)
+	}
+	for key, value := range spec.Env {
+		r.env[id] = append(r.env[id], key+"="+value)
+	}
+	r.containers = append(r.containers, podmanContainer{
+		ID:     id,
+		Name:   name,
+		Image:  spec.Image,
+		Status: "created",
+		Labels: spec.Labels,
+	})
+	return id, nil
+}
+
+func (r *fakeRuntime) setStatus(containerID string, status string, already error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := r.find(containerID)
+	if idx < 0 {
+		return errPodmanContainerNotFound
+	}
+	if r.containers[idx].Status == status {
+		return already
+	}
+	r.containers[idx].Status = status
+	return nil
+}
+
+func (r *fakeRuntime) ImageExists(_ context.Context, imageRef string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.images[imageRef], nil
+}
+
+func (r *fakeRuntime) Pull(_ context.Context, imageRef string, policy string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pulls = append(r.pulls, imageRef)
+	r.pullPolicies = append(r.pullPolicies, policy)
+	return r.pullErr
+}
+
+func (r *fakeRuntime) Commit(_ context.Context, containerID string, imageRef string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.find(containerID) < 0 {
+		return errPodmanContainerNotFound
+	}
+	if r.images == nil {
+		r.images = map[string]bool{}
+	}
+	r.images[imageRef] = true
+	r.commits = append(r.commits, imageRef)
+	return nil
+}
+
+func (r *fakeRuntime) RemoveImage(_ context.Context, imageRef string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, container := range r.containers {
+		if container.Image == imageRef {
+			return errImageInUse
+		}
+	}
+	delete(r.images, imageRef)
+	return nil
+}
+
+// SaveImage writes a minimal docker-archive with imageRef in its manifest.
+func (r *fakeRuntime) SaveImage(_ context.Context, imageRef string, w io.Writer) error {
+	r.mu.Lock()
+	exists := r.images[imageRef]
+	r.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("save image: %s not found", imageRef)
+	}
+
+	manifest, err := json.Marshal([]map[string]any{{"Config": "config.json", "RepoTags": []string{imageRef}, "Layers": []string{"layer.tar"}}})
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{"layer.tar", []byte("layer")},
+		{"config.json", []byte("{}")},
+		{"manifest.json", manifest},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: entry.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(entry.data))}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(entry.data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// LoadImage registers the tags in the archive's manifest.json.
+func (r *fakeRuntime) LoadImage(_ context.Context, reader io.Reader) error {
+	var tags []string
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if header.Name != "manifest.json" {
+			continue
+		}
+		var manifest []struct {
+			RepoTags []string `json:"RepoTags"`
+		}
+		if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+			return err
+		}
+		for _, image := range manifest {
+			tags = append(tags, image.RepoTags...)
+		}
+	}
+	if len(tags) == 0 {
+		return errors.New("load image: no manifest")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.images == nil {
+		r.images = map[string]bool{}
+	}
+	for _, tag := range tags {
+		r.images[tag] = true
+	}
+	r.loads = append(r.loads, tags...)
+	return nil
+}
+
+func (r *fakeRuntime) Build(_ context.Context, opts containerBuildOptions, handle func(line string)) error {
+	r.mu.Lock()
+	r.builds = append(r.builds, opts)
+	lines := append([]string(nil), r.buildLog...)
+	buildErr := r.buildErr
+	r.mu.Unlock()
+
+	for _, line := range lines {
+		handle(line)
+	}
+	if buildErr != nil {
+		return buildErr
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.images == nil {
+		r.images = make(map[string]bool)
+	}
+	r.images[opts.Tag] = true
+	return nil
+}
+
+func (r *fakeRuntime) Start(_ context.Context, containerID string) error {
+	r.mu.Lock()
+	err := r.startErr
+	if r.startErrOnce {
+		r.startErr = nil
+	}
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return r.setStatus(containerID, "running", errContainerAlreadyRunning)
+}
+
+func (r *fakeRuntime) Stop(_ context.Context, containerID string) error {
+	return r.setStatus(containerID, "exited", errContainerAlreadyStopped)
+}
+
+func (r *fakeRuntime) Restart(_ context.Context, containerID string) error {
+	r.mu.Lock()
+	r.restarts++
+	r.mu.Unlock()
+	return r.setStatus(containerID, "running", nil)
+}
+
+func (r *fakeRuntime) Pause(_ context.Context, containerID string) error {
+	if r.statusOf(containerID) == "exited" {
+		return errContainerNotRunning
+	}
+	return r.setStatus(containerID, "paused", errContainerAlreadyPaused)
+}
+
+func (r *fakeRuntime) Unpause(_ context.Context, containerID string) error {
+	if status := r.statusOf(containerID); status != "" && status != "paused" {
+		return errContainerNotPaused
+	}
+	return r.setStatus(containerID, "running", nil)
+}
+
+func (r *fakeRuntime) statusOf(containerID string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if idx := r.find(containerID); idx >= 0 {
+		return r.containers[idx].Status
+	}
+	return ""
+}
+
+func (r *fakeRuntime) Remove(_ context.Context, containerID string, _ bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	idx := r.find(containerID)
+	if idx < 0 {
+		return errPodmanContainerNotFound
+	}
+	r.containers = append(r.containers[:idx], r.containers[idx+1:]...)
+	return nil
+}
+
+func (r *fakeRuntime) Exec(_ context.Context, containerID string, opts containerExecOptions) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.find(containerID) < 0 {
+		return nil, errPodmanContainerNotFound
+	}
+	r.execs = append(r.execs, opts)
+
+	script := strings.Join(opts.Cmd, " ")
+	session := r.sessions[containerID]
+	switch {
+	case strings.Contains(script, "/etc/passwd"):
+		return []byte(r.passwd), nil
+	case session.sessionID != "" && script == "sh -lc "+buildTunnelPIDCheckCommand(session.sessionID):
+		if session.alive {
+			return []byte("alive\n"), nil
+		}
+		return []byte("dead\n"), nil
+	case session.sessionID != "" && strings.Contains(script, tunnelLogFile(session.sessionID)) && strings.HasPrefix(script, "sh -lc cat"):
+		return []byte(session.log), nil
+	default:
+		return nil, nil
+	}
+}
+
+func (r *fakeRuntime) Events(ctx context.Context, _ func(podmanEvent)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (r *fakeRuntime) Logs(ctx context.Context, containerID string, opts containerLogOptions, handle func(containerLogLine)) error {
+	r.mu.Lock()
+	if r.find(containerID) < 0 {
+		r.mu.Unlock()
+		return errPodmanContainerNotFound
+	}
+	lines := append([]containerLogLine(nil), r.logs...)
+	r.mu.Unlock()
+
+	if opts.Tail >= 0 && opts.Tail < len(lines) {
+		lines = lines[len(lines)-opts.Tail:]
+	}
+	for _, line := range lines {
+		handle(line)
+	}
+	if opts.Follow {
+		<-ctx.Done()
+	}
+	return nil
+}
+
+func (r *fakeRuntime) Terminal(_ context.Context, containerID string, opts containerTerminalOptions) (containerTerminal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.find(containerID) < 0 {
+		return nil, errPodmanContainerNotFound
+	}
+	term := newFakeTerminal(opts)
+	r.terminals = append(r.terminals, term)
+	return term, nil
+}
+
+// fakeTerminal echoes input back as output, like a terminal in cooked mode.
+type fakeTerminal struct {
+	opts    containerTerminalOptions
+	reader  *io.PipeReader
+	writer  *io.PipeWriter
+	mu      sync.Mutex
+	resizes [][2]uint16
+}
+
+func newFakeTerminal(opts containerTerminalOptions) *fakeTerminal {
+	reader, writer := io.Pipe()
+	return &fakeTerminal{opts: opts, reader: reader, writer: writer}
+}
+
+func (t *fakeTerminal) Read(p []byte) (int, error)  { return t.reader.Read(p) }
+func (t *fakeTerminal) Write(p []byte) (int, error) { return t.writer.Write(p) }
+
+func (t *fakeTerminal) Close() error {
+	return t.writer.Close()
+}
+
+func (t *fakeTerminal) Resize(cols uint16, rows uint16) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resizes = append(t.resizes, [2]uint16{cols, rows})
+	return nil
+}
+
+func (r *fakeRuntime) Stats(_ context.Context) ([]containerStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]containerStats(nil), r.stats...), nil
+}
+
+func newTestPodmanService(rt ContainerRuntime) *podmanService {
+	svc := newPodmanService()
+	svc.runtime = rt
+	return svc
+}
+
+func TestPodmanServiceStartStopUsesRuntime(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{{ID: "abc123", Name: "ws-one", Status: "exited", Labels: map[string]string{labelWorkspaceRepo: "r"}}}
+	svc := newTestPodmanService(rt)
+	admin := containerAccess{UserID: "admin-1", Admin: true}
+
+	if err := svc.startContainer(admin, "abc123"); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := svc.startContainer(admin, "abc123"); err != nil {
+		t.Fatalf("expected already-running start to succeed, got %v", err)
+	}
+	if err := svc.stopContainer(admin, "abc123"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := svc.stopContainer(admin, "abc123"); err != nil {
+		t.Fatalf("expected already-stopped stop to succeed, got %v", err)
+	}
+	if err := svc.stopContainer(admin, "missing"); !errors.Is(err, errPodmanContainerNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestPodmanServiceDeleteClearsTunnelState(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{{
+		ID:     "abc123",
+		Name:   "ws-one",
+		Status: "running",
+		Labels: map[string]string{labelWorkspaceOwner: "user-1"},
+	}}
+	svc := newTestPodmanService(rt)
+	svc.tunnelStateByContainerID["abc123"] = podmanTunnelState{Status: tunnelStatusBlocked}
+	owner := containerAccess{UserID: "user-1"}
+
+	if _, err := svc.deleteContainer(owner, "abc123", workspaceDataKeep); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if len(rt.containers) != 0 {
+		t.Fatalf("expected container removed, got %v", rt.containers)
+	}
+	if _, ok := svc.tunnelStateByContainerID["abc123"]; ok {
+		t.Fatal("expected tunnel state cleared")
+	}
+	if _, err := svc.deleteContainer(owner, "abc123", workspaceDataKeep); !errors.Is(err, errPodmanContainerNotFound) {
+		t.Fatalf("expected not found on second delete, got %v", err)
+	}
+}
+
+func TestPodmanServicePollUsesRuntime(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{
+		{ID: "b", Name: "beta", Status: "running"},
+		{ID: "a", Name: "alpha", Status: "exited"},
+	}
+	svc := newTestPodmanService(rt)
+
+	containers, errMessage := svc.getCachedContainers()
+	if errMessage != "" {
+		t.Fatalf("unexpected error message %q", errMessage)
+	}
+	if len(containers) != 2 || containers[0].Name != "alpha" {
+		t.Fatalf("expected sorted containers from runtime, got %v", containers)
+	}
+}
+
+func TestCreateWorkspaceUsesRuntime(t *testing.T) {
+	originalWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir temp: %v", err)
+	}
+	originalRun := runWorkspaceCommand
+	originalLookPath := workspaceLookPath
+	t.Cleanup(func() {
+		_ = os.Chdir(originalWD)
+		runWorkspaceCommand = originalRun
+		workspaceLookPath = originalLookPath
+	})
+	runWorkspaceCommand = func([]string, string, ...string) ([]byte, error) { return nil, nil }
+	workspaceLookPath = func(string) (string, error) { return "git", nil }
+
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+
+	result, err := svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/repo.git",
+		Name:    "ws-one",
+		Env:     map[string]string{"FOO": "bar"},
+		limits:  containerLimits{CPUs: 2, Memory: 1 << 30},
+	}, nil)
+	if err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+	t.Cleanup(func() {
+		svc.stopTunnelMonitor("c002")
+	})
+
+	if result.Name != "ws-one" || result.Status != "Running" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if len(rt.containers) != 1 {
+		t.Fatalf("expected throwaway home probe to be removed, got %v", rt.containers)
+	}
+	spec := rt.created[len(rt.created)-1]
+	if spec.Labels[labelWorkspaceHome] != "/home/ubuntu" {
+		t.Fatalf("expected resolved workspace home label, got %q", spec.Labels[labelWorkspaceHome])
+	}
+	if spec.Image != defaultWorkspaceImage || spec.Labels[labelWorkspaceImage] != defaultWorkspaceImage {
+		t.Fatalf("expected default image and label, got %q %v", spec.Image, spec.Labels)
+	}
+	if spec.Labels[labelTunnelSession] == "" {
+		t.Fatal("expected tunnel session label")
+	}
+	if spec.Labels[labelWorkspaceOwner] != "user-1" {
+		t.Fatalf("expected owner label, got %q", spec.Labels[labelWorkspaceOwner])
+	}
+	if spec.Env["FOO"] != "bar" {
+		t.Fatalf("expected env passed through, got %v", spec.Env)
+	}
+	if spec.Limits.CPUs != 2 || spec.Limits.Memory != 1<<30 {
+		t.Fatalf("expected limits passed through, got %+v", spec.Limits)
+	}
+	if spec.Labels[labelWorkspaceMemory] != "1073741824" {
+		t.Fatalf("expected memory label, got %q", spec.Labels[labelWorkspaceMemory])
+	}
+	if result.Resources == nil || result.Resources.CPUs != 2 {
+		t.Fatalf("expected resources in response, got %+v", result.Resources)
+	}
+
+	_, err = svc.createWorkspace("user-1", createWorkspacePayload{
+		RepoURL: "https://github.com/org/other.git",
+		Name:    "ws-one",
+	}, nil)
+	if !errors.Is(err, errWorkspaceNameConflict) && !errors.Is(err, errWorkspaceDirConflict) {
+		t.Fatalf("expected conflict, got %v", err)
+	}
+}
+
+func TestBuildPodmanCreateArgs(t *testing.T) {
+	args := buildPodmanCreateArgs(containerCreateSpec{
+		Name:    "ws",
+		Image:   "alpine",
+		Pull:    "missing",
+		Mounts:  []string{"type=bind,src=/a,dst=/b"},
+		Env:     map[string]string{"B": "2", "A": "1"},
+		Labels:  map[string]string{"pocketpod.repo": "r"},
+		Command: []string{"sh", "-lc", "true"},
+		Limits:  containerLimits{CPUs: 1.5, Memory: 1 << 30, PidsLimit: 256, ShmSize: 64 << 20},
+	})
+
+	want := "create --pull=missing --name ws --mount type=bind,src=/a,dst=/b --cpus=1.5 --memory=1073741824 --pids-limit=256 --shm-size=67108864 -e A=1 -e B=2 --label pocketpod.repo=r alpine sh -lc true"
+	if got := strings.Join(args, " "); got != want {
+		t.Fatalf("unexpected args:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestPodmanServicePauseUnpauseAreIdempotent(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{
+		{ID: "abc123", Name: "ws-one", Status: "running", Labels: map[string]string{labelWorkspaceRepo: "r"}},
+		{ID: "def456", Name: "ws-two", Status: "exited", Labels: map[string]string{labelWorkspaceRepo: "r"}},
+	}
+	svc := newTestPodmanService(rt)
+	admin := containerAccess{UserID: "admin-1", Admin: true}
+
+	for i := 0; i < 2; i++ {
+		if err := svc.pauseContainer(admin, "abc123"); err != nil {
+			t.Fatalf("pause %d: %v", i, err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := svc.unpauseContainer(admin, "abc123"); err != nil {
+			t.Fatalf("unpause %d: %v", i, err)
+		}
+	}
+	if rt.containers[0].Status != "running" {
+		t.Fatalf("expected running container, got %q", rt.containers[0].Status)
+	}
+	if err := svc.pauseContainer(admin, "def456"); !errors.Is(err, errContainerNotRunning) {
+		t.Fatalf("expected not running, got %v", err)
+	}
+	if err := svc.pauseContainer(admin, "missing"); !errors.Is(err, errPodmanContainerNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestPodmanServiceRestartRebootstrapsTunnel(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.setTunnelSession("abc123", "session-1", true, "")
+	rt.containers[0].Name = "ws-one"
+	rt.containers[0].Labels[labelWorkspaceOwner] = "user-1"
+	svc := newTestPodmanService(rt)
+	defer svc.stopTunnelMonitor("abc123")
+
+	if err := svc.restartContainer(containerAccess{UserID: "user-1"}, "abc123"); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	if rt.restarts != 1 {
+		t.Fatalf("expected one restart, got %d", rt.restarts)
+	}
+
+	// The tunnel comes back in the background after the restart returns.
+	var monitored bool
+	var state podmanTunnelState
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		svc.mu.RLock()
+		_, monitored = svc.monitors["abc123"]
+		state = svc.tunnelStateByContainerID["abc123"]
+		svc.mu.RUnlock()
+		if monitored || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !monitored || state.Status != tunnelStatusStarting || state.Message != "" {
+		t.Fatalf("expected tunnel monitor in starting state, got %v %+v", monitored, state)
+	}
+
+	var started bool
+	rt.mu.Lock()
+	for _, opts := range rt.execs {
+		if opts.Detach && opts.User == "ubuntu" && strings.Contains(strings.Join(opts.Cmd, " "), tunnelPIDFile("session-1")) {
+			started = true
+		}
+	}
+	rt.mu.Unlock()
+	if !started {
+		t.Fatal("expected tunnel to be restarted")
+	}
+}
+
+func TestClassifyContainerStateError(t *testing.T) {
+	tests := []struct {
+		action string
+		output string
+		want   error
+	}{
+		{"pause", `"abc" is already paused: container state improper`, errContainerAlreadyPaused},
+		{"pause", `"exited" is not running, can't pause: container state improper`, errContainerNotRunning},
+		{"pause", "Container abc is not running", errContainerNotRunning},
+		{"unpause", `"abc" is not paused, can't unpause: container state improper`, errContainerNotPaused},
+		{"restart", "something else", nil},
+	}
+
+	for _, tt := range tests {
+		if got := classifyContainerStateError(tt.action, []byte(tt.output)); got != tt.want {
+			t.Fatalf("%s %q: expected %v, got %v", tt.action, tt.output, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	labelWorkspaceSnapshot = "pocketpod.snapshot"
+
+	defaultWorkspaceSnapshotLimit  = 10
+	maxWorkspaceSnapshotNameLength = 128
+
+	workspaceSnapshotNotFoundMessage = "Workspace snapshot not found."
+	workspaceSnapshotLimitMessage    = "Snapshot limit reached; delete a snapshot first."
+	workspaceSnapshotInUseMessage    = "Snapshot is still used by a workspace."
+	workspaceSnapshotFailedMessage   = "Failed to snapshot workspace."
+	workspaceSnapshotDeleteMessage   = "Failed to delete workspace snapshot."
+	workspaceSnapshotListMessage     = "Failed to load workspace snapshots."
+)
+
+var (
+	errWorkspaceSnapshotNotFound = errors.New("workspace snapshot not found")
+	errWorkspaceSnapshotLimit    = errors.New("workspace snapshot limit reached")
+	errWorkspaceSnapshotFailed   = errors.New("workspace snapshot failed")
+)
+
+type workspaceSnapshot struct {
+	ID        string            `json:"id"`
+	Owner     string            `json:"owner"`
+	Name      string            `json:"name,omitempty"`
+	Workspace string            `json:"workspace"`
+	RepoURL   string            `json:"repoUrl"`
+	Ref       string            `json:"ref,omitempty"`
+	Dir       string            `json:"dir"`
+	Image     string            `json:"image"`
+	BaseImage string            `json:"baseImage"`
+	SizeBytes int64             `json:"sizeBytes"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Labels    map[string]string `json:"labels"`
+	Env       map[string]string `json:"env,omitempty"`
+	Mounts    []string          `json:"mounts,omitempty"`
+	Imported  bool              `json:"imported,omitempty"`
+}
+
+func (s workspaceSnapshot) redacted() workspaceSnapshot {
+	s.Env = redactEnvMap(s.Env)
+	s.Labels = redactContainerLabels(s.Labels)
+	return s
+}
+
+type createWorkspaceSnapshotPayload struct {
+	Name string `json:"name"`
+}
+
+type createWorkspaceFromSnapshotPayload struct {
+	Name string `json:"name"`
+}
+
+func resolveWorkspaceSnapshotLimit() int {
+	raw := strings.TrimSpace(os.Getenv("WORKSPACE_SNAPSHOT_LIMIT"))
+	if raw == "" {
+		return defaultWorkspaceSnapshotLimit
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 0 {
+		return defaultWorkspaceSnapshotLimit
+	}
+	return limit
+}
+
+func workspaceSnapshotsPath(owner string) string {
+	return filepath.Join(".", "volumes", owner, "snapshots")
+}
+
+func workspaceSnapshotRecordPath(owner string, id string) string {
+	return filepath.Join(workspaceSnapshotsPath(owner), id+".json")
+}
+
+func workspaceSnapshotTarballPath(owner string, id string) string {
+	return filepath.Join(workspaceSnapshotsPath(owner), id+".tar.gz")
+}
+
+func workspaceSnapshotImage(owner string, id string) string {
+	return fmt.Sprintf("localhost/pocketpod-snapshots/%s:%s", workspaceImageOwner(owner), id)
+}
+
+func workspaceImageOwner(owner string) string {
+	return strings.Trim(invalidDirNameChars.ReplaceAllString(strings.ToLower(owner), "-"), "-._")
+}
+
+func (s *podmanService) createWorkspaceSnapshot(access containerAccess, containerID string, payload createWorkspaceSnapshotPayload) (*workspaceSnapshot, error) {
+	if !s.runtime.Available() {
+		return nil, errPodmanUnavailable
+	}
+	inspected, err := s.authorizeContainer(access, containerID)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := newWorkspaceRebuild(inspected)
+	if err != nil {
+		return nil, err
+	}
+	owner := workspace.Owner
+	repoPath, err := resolveWorkspaceRepoPath(owner, workspace.Labels[labelWorkspaceDir])
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(repoPath); err != nil || !info.IsDir() {
+		return nil, errWorkspaceRepoMissing
+	}
+
+	if err := checkWorkspaceSnapshotLimit(owner); err != nil {
+		return nil, err
+	}
+
+	snapshot := &workspaceSnapshot{
+		ID:        generateSessionID(),
+		Owner:     owner,
+		Name:      payload.Name,
+		Workspace: workspace.Name,
+		RepoURL:   workspace.Labels[labelWorkspaceRepo],
+		Ref:       workspace.Labels[labelWorkspaceRef],
+		Dir:       workspace.Labels[labelWorkspaceDir],
+		BaseImage: workspace.Image,
+		CreatedAt: time.Now().UTC(),
+		Labels:    workspace.Labels,
+		Env:       workspace.Env,
+		Mounts:    workspace.Mounts,
+	}
+	snapshot.Image = workspaceSnapshotImage(owner, snapshot.ID)
+	if err := os.MkdirAll(workspaceSnapshotsPath(owner), 0o755); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if err := s.runtime.Commit(ctx, inspected.ID, snapshot.Image); err != nil {
+		if errors.Is(err, errPodmanContainerNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errWorkspaceSnapshotFailed, err)
+	}
+
+	tarballPath := workspaceSnapshotTarballPath(owner, snapshot.ID)
+	err = writeWorkspaceTarball(tarballPath, repoPath)
+	if err == nil {
+		if info, statErr := os.Stat(tarballPath); statErr == nil {
+			snapshot.SizeBytes = info.Size()
+		}
+		err = writeWorkspaceSnapshotRecord(snapshot)
+	}
+	if err != nil {
+		_ = os.Remove(tarballPath)
+		_ = s.runtime.RemoveImage(ctx, snapshot.Image)
+		return nil, fmt.Errorf("%w: %v", errWorkspaceSnapshotFailed, err)
+	}
+	return snapshot, nil
+}
+
+func checkWorkspaceSnapshotLimit(owner string) error {
+	limit := resolveWorkspaceSnapshotLimit()
+	if limit == 0 {
+		return nil
+	}
+	snapshots, err := listWorkspaceSnapshots(owner)
+	if err != nil {
+		return err
+	}
+	if len(snapshots) >= limit {
+		return errWorkspaceSnapshotLimit
+	}
+	return nil
+}
+
+func writeWorkspaceSnapshotRecord(snapshot *workspaceSnapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(workspaceSnapshotRecordPath(snapshot.Owner, snapshot.ID), data, 0o600)
+}
+
+func loadWorkspaceSnapshot(owner string, id string) (*workspaceSnapshot, error) {
+	if !workspaceArchiveIDPattern.MatchString(id) {
+		return nil, errWorkspaceSnapshotNotFound
+	}
+	data, err := os.ReadFile(workspaceSnapshotRecordPath(owner, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errWorkspaceSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot workspaceSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+func listWorkspaceSnapshots(owner string) ([]workspaceSnapshot, error) {
+	entries, err := os.ReadDir(workspaceSnapshotsPath(owner))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []workspaceSnapshot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []workspaceSnapshot{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		snapshot, err := loadWorkspaceSnapshot(owner, id)
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.After(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
+
+func (s *podmanService) deleteWorkspaceSnapshot(owner string, id string) error {
+	snapshot, err := loadWorkspaceSnapshot(owner, id)
+	if err != nil {
+		return err
+	}
+	if err := s.runtime.RemoveImage(context.Background(), snapshot.Image); err != nil {
+		return err
+	}
+	if err := os.Remove(workspaceSnapshotTarballPath(owner, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Remove(workspaceSnapshotRecordPath(owner, id))
+}
+
+func validateCreateWorkspaceFromSnapshotPayload(payload *createWorkspaceFromSnapshotPayload) error {
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name != "" && !workspaceNamePattern.MatchString(payload.Name) {
+		return errors.New("name must start with a letter or digit and contain only letters, digits, '_', '.', or '-'")
+	}
+	return nil
+}
+
+func (s *podmanService) startWorkspaceFromSnapshot(userID string, id string, payload createWorkspaceFromSnapshotPayload) (*workspaceJob, error) {
+	snapshot, err := loadWorkspaceSnapshot(userID, id)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := deriveWorkspaceDirName(createWorkspacePayload{Name: payload.Name, RepoURL: snapshot.RepoURL})
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(snapshot.Labels)+1)
+	for key, value := range snapshot.Labels {
+		labels[key] = value
+	}
+	labels[labelWorkspaceDir] = dir
+	labels[labelWorkspaceSnapshot] = snapshot.ID
+	// Rebuilds of the new workspace start from the snapshot, not from the
+	// devcontainer build it was based on.
+	delete(labels, labelWorkspaceBuild)
+	rebuild := &workspaceRebuild{
+		Name:   payload.Name,
+		Owner:  userID,
+		Labels: labels,
+		Env:    snapshot.Env,
+		Mounts: snapshot.Mounts,
+		Image:  snapshot.Image,
+	}
+
+	job := &workspaceJob{
+		ID:        generateSessionID(),
+		Kind:      workspaceJobKindCreate,
+		Owner:     userID,
+		Name:      payload.Name,
+		RepoURL:   snapshot.RepoURL,
+		Ref:       snapshot.Ref,
+		Status:    workspaceJobStatusRunning,
+		Phases:    []workspaceJobPhase{},
+		StartedAt: time.Now().UTC(),
+		limits:    containerLimitsFromLabels(labels),
+	}
+	return s.startWorkspaceRecreate(job, func() (*createWorkspaceResponse, error) {
+		return s.recreateWorkspace(workspaceSnapshotTarballPath(userID, snapshot.ID), rebuild, true, job)
+	})
+}
+
+func registerWorkspaceSnapshotRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.POST("/podman/workspaces/{id}/snapshots", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		var payload createWorkspaceSnapshotPayload
+		if re.Request.ContentLength != 0 {
+			if err := re.BindBody(&payload); err != nil {
+				return re.JSON(http.StatusBadRequest, map[string]string{
+					"message": "Invalid snapshot payload.",
+				})
+			}
+		}
+		payload.Name = strings.TrimSpace(payload.Name)
+		if len(payload.Name) > maxWorkspaceSnapshotNameLength || hasUnsafeControlChars(payload.Name) {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Invalid snapshot name.",
+			})
+		}
+
+		snapshot, err := svc.createWorkspaceSnapshot(newContainerAccess(re.Auth), containerID, payload)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
+			case errors.Is(err, errWorkspaceNotRebuildable):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": workspaceNotRebuildableMessage,
+				})
+			case errors.Is(err, errWorkspaceRepoMissing):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": workspaceRepoMissingMessage,
+				})
+			case errors.Is(err, errWorkspaceSnapshotLimit):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": workspaceSnapshotLimitMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": workspaceSnapshotFailedMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusCreated, snapshot.redacted())
+	})
+
+	rtr.GET("/podman/workspaces/snapshots", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		snapshots, err := listWorkspaceSnapshots(re.Auth.Id)
+		if err != nil {
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": workspaceSnapshotListMessage,
+			})
+		}
+
+		for i := range snapshots {
+			snapshots[i] = snapshots[i].redacted()
+		}
+		return re.JSON(http.StatusOK, snapshots)
+	})
+
+	rtr.DELETE("/podman/workspaces/snapshots/{id}", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		if err := svc.deleteWorkspaceSnapshot(re.Auth.Id, strings.TrimSpace(re.Request.PathValue("id"))); err != nil {
+			switch {
+			case errors.Is(err, errWorkspaceSnapshotNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": workspaceSnapshotNotFoundMessage,
+				})
+			case errors.Is(err, errImageInUse):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": workspaceSnapshotInUseMessage,
+				})
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": workspaceSnapshotDeleteMessage,
+				})
+			}
+		}
+
+		return re.JSON(http.StatusOK, map[string]string{
+			"status": "deleted",
+		})
+	})
+
+	rtr.POST("/podman/workspaces/snapshots/{id}/workspaces", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		var payload createWorkspaceFromSnapshotPayload
+		if re.Request.ContentLength != 0 {
+			if err := re.BindBody(&payload); err != nil {
+				return re.JSON(http.StatusBadRequest, map[string]string{
+					"message": "Invalid workspace payload.",
+				})
+			}
+		}
+		if err := validateCreateWorkspaceFromSnapshotPayload(&payload); err != nil {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": err.Error(),
+			})
+		}
+
+		job, err := svc.startWorkspaceFromSnapshot(re.Auth.Id, strings.TrimSpace(re.Request.PathValue("id")), payload)
+		if err != nil {
+			var quotaErr *workspaceQuotaError
+			switch {
+			case errors.As(err, &quotaErr):
+				return re.JSON(quotaErrorStatus(quotaErr), quotaErr.response())
+			case errors.Is(err, errWorkspaceSnapshotNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": workspaceSnapshotNotFoundMessage,
+				})
+			}
+			status, message := workspaceCreateErrorStatus(err)
+			return re.JSON(status, map[string]string{
+				"message": message,
+			})
+		}
+
+		re.Response.Header().Set("Location", "/podman/workspaces/jobs/"+job.ID)
+		return re.JSON(http.StatusAccepted, job)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotWorkspaceAndCreateFromSnapshot(t *testing.T) {
+	stubWorkspaceClone(t)
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	old := createRebuildableWorkspace(t, rt, svc)
+	writeWorkspaceRepoFiles(t, filepath.Join("volumes", "user-1", "workspaces", old.Labels[labelWorkspaceDir]))
+
+	snapshot, err := svc.createWorkspaceSnapshot(containerAccess{UserID: "user-1"}, old.ID, createWorkspaceSnapshotPayload{Name: "toolchains"})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(rt.commits, []string{snapshot.Image}) || snapshot.Image != workspaceSnapshotImage("user-1", snapshot.ID) {
+		t.Fatalf("expected container committed to %q, got %v", snapshot.Image, rt.commits)
+	}
+	if snapshot.Workspace != "ws-one" || snapshot.BaseImage != defaultWorkspaceImage || snapshot.SizeBytes == 0 {
+		t.Fatalf("unexpected snapshot %+v", snapshot)
+	}
+	if snapshots, err := listWorkspaceSnapshots("user-1"); err != nil || len(snapshots) != 1 || snapshots[0].ID != snapshot.ID {
+		t.Fatalf("expected one snapshot, got %+v (%v)", snapshots, err)
+	}
+	if snapshots, err := listWorkspaceSnapshots("user-2"); err != nil || len(snapshots) != 0 {
+		t.Fatalf("expected other users to see no snapshots, got %+v (%v)", snapshots, err)
+	}
+	if _, err := svc.startWorkspaceFromSnapshot("user-2", snapshot.ID, createWorkspaceFromSnapshotPayload{Name: "stolen"}); !errors.Is(err, errWorkspaceSnapshotNotFound) {
+		t.Fatalf("expected other users not to find the snapshot, got %v", err)
+	}
+
+	rt.pulls, rt.pullPolicies = nil, nil
+	started, err := svc.startWorkspaceFromSnapshot("user-1", snapshot.ID, createWorkspaceFromSnapshotPayload{Name: "ws-two"})
+	if err != nil {
+		t.Fatalf("start from snapshot: %v", err)
+	}
+	job := waitForWorkspaceJob(t, svc, started.ID)
+	if job.Status != workspaceJobStatusSucceeded || job.Kind != workspaceJobKindCreate {
+		t.Fatalf("expected succeeded create job, got %+v", job)
+	}
+	if !reflect.DeepEqual(rt.pullPolicies, []string{imagePullMissing}) {
+		t.Fatalf("expected the local snapshot image not to be refreshed, got %v", rt.pullPolicies)
+	}
+
+	spec := rt.created[len(rt.created)-1]
+	if spec.Name != "ws-two" || spec.Image != snapshot.Image || spec.Env["APP_ENV"] != "dev" {
+		t.Fatalf("expected ws-two on the snapshot image, got %+v", spec)
+	}
+	if spec.Labels[labelWorkspaceSnapshot] != snapshot.ID || spec.Labels[labelWorkspaceDir] != "ws-two" {
+		t.Fatalf("expected snapshot and directory labels, got %v", spec.Labels)
+	}
+	repoPath := filepath.Join("volumes", "user-1", "workspaces", "ws-two")
+	if link, err := os.Readlink(filepath.Join(repoPath, "start")); err != nil || link != "run.sh" {
+		t.Fatalf("expected repository restored into ws-two, got %q (%v)", link, err)
+	}
+
+	if err := svc.deleteWorkspaceSnapshot("user-1", snapshot.ID); !errors.Is(err, errImageInUse) {
+		t.Fatalf("expected snapshot in use, got %v", err)
+	}
+	if _, err := svc.deleteContainer(containerAccess{UserID: "user-1"}, job.ContainerID, workspaceDataKeep); err != nil {
+		t.Fatalf("delete workspace: %v", err)
+	}
+	if err := svc.deleteWorkspaceSnapshot("user-1", snapshot.ID); err != nil {
+		t.Fatalf("delete snapshot: %v", err)
+	}
+	if _, err := os.Stat(workspaceSnapshotTarballPath("user-1", snapshot.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected tarball removed, got %v", err)
+	}
+	if rt.images[snapshot.Image] {
+		t.Fatalf("expected snapshot image removed")
+	}
+}
+
+func TestSnapshotWorkspaceEnforcesLimit(t *testing.T) {
+	stubWorkspaceClone(t)
+	t.Setenv("WORKSPACE_SNAPSHOT_LIMIT", "1")
+	rt := newFakeRuntime()
+	svc := newTestPodmanService(rt)
+	t.Cleanup(func() {
+		for _, container := range rt.containers {
+			svc.stopTunnelMonitor(container.ID)
+		}
+	})
+
+	old := createRebuildableWorkspace(t, rt, svc)
+	if _, err := svc.createWorkspaceSnapshot(containerAccess{UserID: "user-2"}, old.ID, createWorkspaceSnapshotPayload{}); !errors.Is(err, errContainerForbidden) {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+	if _, err := svc.createWorkspaceSnapshot(containerAccess{UserID: "user-1"}, old.ID, createWorkspaceSnapshotPayload{}); err != nil {
+		t.Fatalf("first snapshot: %v", err)
+	}
+	if _, err := svc.createWorkspaceSnapshot(containerAccess{UserID: "user-1"}, old.ID, createWorkspaceSnapshotPayload{}); !errors.Is(err, errWorkspaceSnapshotLimit) {
+		t.Fatalf("expected snapshot limit, got %v", err)
+	}
+	if len(rt.commits) != 1 {
+		t.Fatalf("expected one commit, got %v", rt.commits)
+	}
+}
+
+func TestWorkspaceSnapshotRedacted(t *testing.T) {
+	snapshot := workspaceSnapshot{Env: map[string]string{"APP_ENV": "dev", "NPM_TOKEN": "npm_secret"}}
+	if redacted := snapshot.redacted(); redacted.Env["APP_ENV"] != "dev" || redacted.Env["NPM_TOKEN"] != redactedEnvValue {
+		t.Fatalf("expected token redacted, got %v", redacted.Env)
+	}
+	if snapshot.Env["NPM_TOKEN"] != "npm_secret" {
+		t.Fatalf("expected the stored snapshot untouched, got %v", snapshot.Env)
+	}
+}
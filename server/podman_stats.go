@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const podmanStatsInterval = 5 * time.Second
+
+type containerStats struct {
+	ID            string  `json:"id"`
+	CPUPercent    float64 `json:"cpuPercent"`
+	MemoryUsage   uint64  `json:"memoryUsage"`
+	MemoryLimit   uint64  `json:"memoryLimit"`
+	MemoryPercent float64 `json:"memoryPercent"`
+	NetworkRx     uint64  `json:"networkRx"`
+	NetworkTx     uint64  `json:"networkTx"`
+	BlockRead     uint64  `json:"blockRead"`
+	BlockWrite    uint64  `json:"blockWrite"`
+	PIDs          uint64  `json:"pids"`
+}
+
+var humanBytesPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([a-zA-Z]*)$`)
+
+var humanByteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1e3,
+	"kb":  1e3,
+	"m":   1e6,
+	"mb":  1e6,
+	"g":   1e9,
+	"gb":  1e9,
+	"t":   1e12,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+func (s *podmanService) runStatsSampler(ctx context.Context) {
+	ticker := time.NewTicker(podmanStatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if s.clientCount() == 0 {
+				continue
+			}
+			s.sampleStats(ctx)
+		}
+	}
+}
+
+func (s *podmanService) sampleStats(ctx context.Context) {
+	stats, err := s.runtime.Stats(ctx)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	s.stats = stats
+	s.mu.Unlock()
+
+	s.hubMu.Lock()
+	clients := make([]*podmanClient, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.hubMu.Unlock()
+
+	for _, c := range clients {
+		c.trySend(s.statsMessageFor(c.access))
+	}
+}
+
+func (s *podmanService) statsMessageFor(access containerAccess) podmanStreamMessage {
+	s.mu.RLock()
+	visible := filterContainersForAccess(s.containers, access)
+	stats := make([]containerStats, 0, len(s.stats))
+	for _, sample := range s.stats {
+		for _, container := range visible {
+			if isContainerIDMatch(container.ID, sample.ID) {
+				sample.ID = container.ID
+				stats = append(stats, sample)
+				break
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	return podmanStreamMessage{Type: "stats", Data: []podmanContainer{}, Stats: stats}
+}
+
+func (s *podmanService) clientCount() int {
+	s.hubMu.Lock()
+	defer s.hubMu.Unlock()
+	return len(s.clients)
+}
+
+func parsePercent(value string) float64 {
+	parsed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil {
+		return 0
+	}
+	return parsed
+}
+
+func parseHumanBytesPair(value string) (uint64, uint64) {
+	left, right, _ := strings.Cut(value, "/")
+	return parseHumanBytes(left), parseHumanBytes(right)
+}
+
+func parseHumanBytes(value string) uint64 {
+	match := humanBytesPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0
+	}
+	multiplier, ok := humanByteUnits[strings.ToLower(match[2])]
+	if !ok {
+		return 0
+	}
+	return uint64(math.Round(number * multiplier))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestParseHumanBytes(t *testing.T) {
+	tests := map[string]uint64{
+		"0B":      0,
+		"648B":    648,
+		"1.2kB":   1200,
+		"10.5MB":  10500000,
+		"2.05GB":  2050000000,
+		"1GiB":    1 << 30,
+		"garbage": 0,
+		"":        0,
+	}
+	for input, want := range tests {
+		if got := parseHumanBytes(input); got != want {
+			t.Fatalf("%q: expected %d, got %d", input, want, got)
+		}
+	}
+}
+
+func TestParsePodmanCLIStats(t *testing.T) {
+	output := `[{"id":"abc123","name":"ws-one","cpu_percent":"12.50%","mem_usage":"10.5MB / 2.05GB","mem_percent":"0.51%","net_io":"1.2kB / 648B","block_io":"4MB / 0B","pids":"3"}]`
+
+	stats, err := parsePodmanCLIStats([]byte(output))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	want := containerStats{
+		ID:            "abc123",
+		CPUPercent:    12.5,
+		MemoryUsage:   10500000,
+		MemoryLimit:   2050000000,
+		MemoryPercent: 0.51,
+		NetworkRx:     1200,
+		NetworkTx:     648,
+		BlockRead:     4000000,
+		PIDs:          3,
+	}
+	if len(stats) != 1 || stats[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+
+	if empty, err := parsePodmanCLIStats([]byte("null\n")); err != nil || len(empty) != 0 {
+		t.Fatalf("expected empty stats, got %+v %v", empty, err)
+	}
+}
+
+func TestDockerStatsCalculations(t *testing.T) {
+	raw := `{
+		"id": "abc",
+		"cpu_stats": {"cpu_usage": {"total_usage": 400}, "system_cpu_usage": 2000, "online_cpus": 2},
+		"precpu_stats": {"cpu_usage": {"total_usage": 300}, "system_cpu_usage": 1000},
+		"memory_stats": {"usage": 1500, "limit": 10000, "stats": {"inactive_file": 500}},
+		"networks": {"eth0": {"rx_bytes": 10, "tx_bytes": 20}, "eth1": {"rx_bytes": 1, "tx_bytes": 2}},
+		"blkio_stats": {"io_service_bytes_recursive": [{"op": "Read", "value": 7}, {"op": "Write", "value": 9}]},
+		"pids_stats": {"current": 4}
+	}`
+	var response dockerStatsResponse
+	if err := json.Unmarshal([]byte(raw), &response); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	stats := response.toContainerStats()
+	if math.Abs(stats.CPUPercent-20) > 1e-9 || stats.MemoryUsage != 1000 || math.Abs(stats.MemoryPercent-10) > 1e-9 {
+		t.Fatalf("unexpected cpu/memory: %+v", stats)
+	}
+	if stats.NetworkRx != 11 || stats.NetworkTx != 22 || stats.BlockRead != 7 || stats.BlockWrite != 9 || stats.PIDs != 4 {
+		t.Fatalf("unexpected io: %+v", stats)
+	}
+}
+
+func TestLibpodRuntimeStats(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v4.0.0/libpod/containers/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("stream") != "false" {
+			t.Errorf("expected stream=false, got %q", r.URL.RawQuery)
+		}
+		_, _ = w.Write([]byte(`{"Error":null,"Stats":[{"ContainerID":"abc","CPU":1.5,"MemUsage":100,"MemLimit":1000,"MemPerc":10,"NetInput":1,"NetOutput":2,"BlockInput":3,"BlockOutput":4,"PIDs":5}]}`))
+	})
+
+	rt := newLibpodRuntime(serveEngineAPI(t, mux))
+	stats, err := rt.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	want := containerStats{ID: "abc", CPUPercent: 1.5, MemoryUsage: 100, MemoryLimit: 1000, MemoryPercent: 10, NetworkRx: 1, NetworkTx: 2, BlockRead: 3, BlockWrite: 4, PIDs: 5}
+	if len(stats) != 1 || stats[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+}
+
+func TestSampleStatsSendsVisibleStatsOnly(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{
+		{ID: "abc123456789", Status: "running", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+		{ID: "def456456789", Status: "running", Labels: map[string]string{labelWorkspaceOwner: "user-2"}},
+	}
+	rt.stats = []containerStats{
+		{ID: "abc123", CPUPercent: 1},
+		{ID: "def456", CPUPercent: 2},
+	}
+	svc := newTestPodmanService(rt)
+	svc.poll()
+	hash := svc.hash
+
+	client := &podmanClient{
+		access:  containerAccess{UserID: "user-1"},
+		sendCh:  make(chan podmanStreamMessage, podmanClientBufferSize),
+		closeCh: make(chan struct{}),
+	}
+	svc.clients[client] = struct{}{}
+
+	svc.sampleStats(context.Background())
+
+	msg := <-client.sendCh
+	if msg.Type != "stats" || len(msg.Stats) != 1 || msg.Stats[0].ID != "abc123456789" || msg.Stats[0].CPUPercent != 1 {
+		t.Fatalf("unexpected stats message: %+v", msg)
+	}
+	if svc.hash != hash {
+		t.Fatal("expected stats to leave the containers hash untouched")
+	}
+}
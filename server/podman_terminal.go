@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	podmanTerminalFailedMessage = "Failed to open terminal."
+	podmanTerminalNoUserMessage = "No non-root user found in container."
+
+	terminalReadBufferSize = 32 * 1024
+	terminalMaxDimension   = 1000
+)
+
+var terminalShellCommand = []string{
+	"sh", "-c",
+	`cd "$HOME" 2>/dev/null; if command -v bash >/dev/null 2>&1; then exec bash -l; fi; exec sh -l`,
+}
+
+var errTerminalUserMissing = errors.New("no non-root user in container")
+
+type terminalControlMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
+
+func (s *podmanService) openContainerTerminal(ctx context.Context, access containerAccess, containerID string, cols uint16, rows uint16) (containerTerminal, error) {
+	inspected, err := s.authorizeContainer(access, containerID)
+	if err != nil {
+		return nil, err
+	}
+	if !inspected.State.Running {
+		return nil, errContainerNotRunning
+	}
+
+	execUser, err := resolveWorkspaceExecUser(s.runtime, containerID, inspected.Config.Labels)
+	if err != nil {
+		if errors.Is(err, errPodmanUnavailable) || errors.Is(err, errPodmanContainerNotFound) {
+			return nil, err
+		}
+		return nil, errTerminalUserMissing
+	}
+
+	env := resolveRemoteEnv(inspected.Config.Labels, inspected.Config.Env)
+	if env == nil {
+		env = map[string]string{}
+	}
+	env["TERM"] = "xterm-256color"
+
+	return s.runtime.Terminal(ctx, containerID, containerTerminalOptions{
+		User: execUser.Name,
+		Cmd:  terminalShellCommand,
+		Env:  env,
+		Cols: cols,
+		Rows: rows,
+	})
+}
+
+func bridgeTerminalWebSocket(conn *websocket.Conn, term containerTerminal) {
+	defer conn.Close()
+	defer term.Close()
+
+	var writeMu sync.Mutex
+	write := func(messageType int, data []byte) error {
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		if err := conn.SetWriteDeadline(time.Now().Add(podmanWriteTimeout)); err != nil {
+			return err
+		}
+		return conn.WriteMessage(messageType, data)
+	}
+
+	go func() {
+		buf := make([]byte, terminalReadBufferSize)
+		for {
+			n, err := term.Read(buf)
+			if n > 0 {
+				if writeErr := write(websocket.BinaryMessage, buf[:n]); writeErr != nil {
+					conn.Close()
+					return
+				}
+			}
+			if err != nil {
+				_ = write(websocket.TextMessage, []byte(`{"type":"exit"}`))
+				writeMu.Lock()
+				_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(podmanWriteTimeout))
+				writeMu.Unlock()
+				conn.Close()
+				return
+			}
+		}
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		switch messageType {
+		case websocket.BinaryMessage:
+			if _, err := term.Write(data); err != nil {
+				return
+			}
+		case websocket.TextMessage:
+			var msg terminalControlMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				if _, err := term.Write([]byte(msg.Data)); err != nil {
+					return
+				}
+			case "resize":
+				if validTerminalSize(msg.Cols, msg.Rows) {
+					_ = term.Resize(msg.Cols, msg.Rows)
+				}
+			}
+		}
+	}
+}
+
+func validTerminalSize(cols uint16, rows uint16) bool {
+	return cols > 0 && rows > 0 && cols <= terminalMaxDimension && rows <= terminalMaxDimension
+}
+
+func parseTerminalDimension(raw string) uint16 {
+	value, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || value <= 0 || value > terminalMaxDimension {
+		return 0
+	}
+	return uint16(value)
+}
+
+func registerContainerTerminalRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/containers/{id}/terminal", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		containerID := strings.TrimSpace(re.Request.PathValue("id"))
+		if containerID == "" {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Container id is required.",
+			})
+		}
+
+		if !websocket.IsWebSocketUpgrade(re.Request) {
+			return re.JSON(http.StatusBadRequest, map[string]string{
+				"message": "Terminal requires a websocket connection.",
+			})
+		}
+		if !podmanStreamUpgrader.CheckOrigin(re.Request) {
+			return re.JSON(http.StatusForbidden, map[string]string{
+				"message": "Origin not allowed.",
+			})
+		}
+
+		query := re.Request.URL.Query()
+		cols := parseTerminalDimension(query.Get("cols"))
+		rows := parseTerminalDimension(query.Get("rows"))
+
+		// The exec session outlives the upgrade request, so it is bound to a
+		// context cancelled when the bridge returns.
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		term, err := svc.openContainerTerminal(ctx, newContainerAccess(re.Auth), containerID, cols, rows)
+		if err != nil {
+			switch {
+			case errors.Is(err, errPodmanUnavailable):
+				return re.JSON(http.StatusServiceUnavailable, map[string]string{
+					"message": podmanUnavailableMessage,
+				})
+			case errors.Is(err, errPodmanContainerNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": podmanContainerNotFoundMessage,
+				})
+			case errors.Is(err, errContainerForbidden):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerForbiddenMessage,
+				})
+			case errors.Is(err, errContainerUnmanaged):
+				return re.JSON(http.StatusForbidden, map[string]string{
+					"message": podmanContainerUnmanagedMessage,
+				})
+			case errors.Is(err, errContainerNotRunning):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": podmanContainerNotRunningMessage,
+				})
+			case errors.Is(err, errTerminalUserMissing):
+				return re.JSON(http.StatusConflict, map[string]string{
+					"message": podmanTerminalNoUserMessage,
+				})
+			default:
+				return re.JSON(http.StatusInternalServerError, map[string]string{
+					"message": podmanTerminalFailedMessage,
+				})
+			}
+		}
+
+		conn, err := podmanStreamUpgrader.Upgrade(re.Response, re.Request, nil)
+		if err != nil {
+			term.Close()
+			return err
+		}
+
+		bridgeTerminalWebSocket(conn, term)
+		return nil
+	})
+}
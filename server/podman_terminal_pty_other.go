@@ -0,0 +1,19 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+var errPTYUnsupported = errors.New("pty terminals are only supported on linux")
+
+func startPTYCommand(_ *exec.Cmd, _ uint16, _ uint16) (*os.File, error) {
+	return nil, errPTYUnsupported
+}
+
+func setPTYSize(_ *os.File, _ uint16, _ uint16) error {
+	return errPTYUnsupported
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOpenContainerTerminalRunsAsNonRootUser(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.containers = []podmanContainer{
+		{ID: "abc123", Status: "running", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+		{ID: "def456", Status: "exited", Labels: map[string]string{labelWorkspaceOwner: "user-1"}},
+	}
+	svc := newTestPodmanService(rt)
+	owner := containerAccess{UserID: "user-1"}
+
+	term, err := svc.openContainerTerminal(context.Background(), owner, "abc123", 120, 40)
+	if err != nil {
+		t.Fatalf("open terminal: %v", err)
+	}
+	defer term.Close()
+
+	opts := rt.terminals[0].opts
+	if opts.User != "ubuntu" || opts.Cols != 120 || opts.Rows != 40 || opts.Env["TERM"] == "" {
+		t.Fatalf("unexpected terminal options: %+v", opts)
+	}
+
+	if _, err := svc.openContainerTerminal(context.Background(), containerAccess{UserID: "user-2"}, "abc123", 0, 0); !errors.Is(err, errContainerForbidden) {
+		t.Fatalf("expected forbidden, got %v", err)
+	}
+	if _, err := svc.openContainerTerminal(context.Background(), owner, "def456", 0, 0); !errors.Is(err, errContainerNotRunning) {
+		t.Fatalf("expected not running, got %v", err)
+	}
+
+	rt.passwd = "root:x:0:0:root:/root:/bin/bash"
+	if _, err := svc.openContainerTerminal(context.Background(), owner, "abc123", 0, 0); !errors.Is(err, errTerminalUserMissing) {
+		t.Fatalf("expected missing user, got %v", err)
+	}
+}
+
+func TestBridgeTerminalWebSocket(t *testing.T) {
+	term := newFakeTerminal(containerTerminalOptions{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := podmanStreamUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		bridgeTerminalWebSocket(conn, term)
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	if err := conn.WriteMessage(websocket.BinaryMessage, []byte("ls\n")); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	messageType, data, err := conn.ReadMessage()
+	if err != nil || messageType != websocket.BinaryMessage || string(data) != "ls\n" {
+		t.Fatalf("expected echoed output, got %d %q %v", messageType, data, err)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"input","data":"pwd\n"}`)); err != nil {
+		t.Fatalf("write text input: %v", err)
+	}
+	if _, data, err := conn.ReadMessage(); err != nil || string(data) != "pwd\n" {
+		t.Fatalf("expected echoed text input, got %q %v", data, err)
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","cols":100,"rows":30}`)); err != nil {
+		t.Fatalf("write resize: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","cols":0,"rows":30}`)); err != nil {
+		t.Fatalf("write resize: %v", err)
+	}
+
+	// Wait for the resize to land before ending the shell.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		term.mu.Lock()
+		resizes := len(term.resizes)
+		term.mu.Unlock()
+		if resizes > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	term.mu.Lock()
+	if len(term.resizes) != 1 || term.resizes[0] != [2]uint16{100, 30} {
+		t.Fatalf("unexpected resizes: %v", term.resizes)
+	}
+	term.mu.Unlock()
+
+	_ = term.writer.CloseWithError(io.EOF)
+	messageType, data, err = conn.ReadMessage()
+	if err != nil || messageType != websocket.TextMessage || string(data) != `{"type":"exit"}` {
+		t.Fatalf("expected exit message, got %d %q %v", messageType, data, err)
+	}
+}
+
+func TestDockerRuntimeTerminalHijacksExec(t *testing.T) {
+	resized := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1.41/containers/abc/exec", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Id":"exec1"}`))
+	})
+	mux.HandleFunc("POST /v1.41/exec/exec1/start", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "tcp" {
+			t.Errorf("expected upgrade header, got %v", r.Header)
+		}
+		_, _ = io.Copy(io.Discard, r.Body)
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n$ ")
+		_ = buf.Flush()
+		line := make([]byte, 5)
+		if _, err := io.ReadFull(buf, line); err == nil {
+			_, _ = conn.Write(line)
+		}
+	})
+	mux.HandleFunc("POST /v1.41/exec/exec1/resize", func(w http.ResponseWriter, r *http.Request) {
+		resized <- r.URL.Query().Get("w") + "x" + r.URL.Query().Get("h")
+	})
+
+	rt := newDockerRuntime(serveEngineAPI(t, mux))
+	term, err := rt.Terminal(context.Background(), "abc", containerTerminalOptions{User: "ubuntu", Cmd: []string{"sh"}, Cols: 80, Rows: 24})
+	if err != nil {
+		t.Fatalf("terminal: %v", err)
+	}
+	defer term.Close()
+
+	if size := <-resized; size != "80x24" {
+		t.Fatalf("unexpected initial size %q", size)
+	}
+
+	prompt := make([]byte, 2)
+	if _, err := io.ReadFull(term, prompt); err != nil || string(prompt) != "$ " {
+		t.Fatalf("unexpected prompt %q %v", prompt, err)
+	}
+	if _, err := term.Write([]byte("echo\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	echoed, err := io.ReadAll(term)
+	if err != nil || string(echoed) != "echo\n" {
+		t.Fatalf("unexpected output %q %v", echoed, err)
+	}
+}
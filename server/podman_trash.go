@@ -0,0 +1,459 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/router"
+)
+
+const (
+	workspaceDataKeep    = "keep"
+	workspaceDataArchive = "archive"
+	workspaceDataPurge   = "purge"
+
+	workspaceDataModeInvalidMessage = "Data must be keep, archive or purge."
+	workspaceArchiveNotFoundMessage = "Workspace archive not found."
+	workspaceArchiveFailedMessage   = "Failed to load workspace archives."
+	workspaceArchiveDeleteMessage   = "Failed to delete workspace archive."
+)
+
+var (
+	errWorkspaceDataModeInvalid = errors.New("invalid workspace data mode")
+	errWorkspaceArchiveNotFound = errors.New("workspace archive not found")
+	errWorkspaceDirInvalid      = errors.New("invalid workspace directory")
+
+	workspaceArchiveIDPattern = regexp.MustCompile(`^[0-9]+-[0-9a-f]{8}$`)
+)
+
+type workspaceArchive struct {
+	ID         string            `json:"id"`
+	Owner      string            `json:"owner"`
+	Name       string            `json:"name"`
+	RepoURL    string            `json:"repoUrl"`
+	Ref        string            `json:"ref,omitempty"`
+	Dir        string            `json:"dir"`
+	Image      string            `json:"image"`
+	SizeBytes  int64             `json:"sizeBytes"`
+	ArchivedAt time.Time         `json:"archivedAt"`
+	Labels     map[string]string `json:"labels"`
+	Env        map[string]string `json:"env,omitempty"`
+	Mounts     []string          `json:"mounts,omitempty"`
+}
+
+func (a workspaceArchive) redacted() workspaceArchive {
+	a.Env = redactEnvMap(a.Env)
+	a.Labels = redactContainerLabels(a.Labels)
+	return a
+}
+
+func redactEnvMap(env map[string]string) map[string]string {
+	if env == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(env))
+	for key, value := range env {
+		if isSecretEnvKey(key) {
+			value = redactedEnvValue
+		} else {
+			value, _ = redactURLPassword(value)
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+func (a *workspaceArchive) rebuild() *workspaceRebuild {
+	labels := make(map[string]string, len(a.Labels))
+	for key, value := range a.Labels {
+		labels[key] = value
+	}
+	return &workspaceRebuild{
+		Name:   a.Name,
+		Owner:  a.Owner,
+		Labels: labels,
+		Env:    a.Env,
+		Mounts: a.Mounts,
+		Image:  a.Image,
+	}
+}
+
+type deleteContainerResult struct {
+	Status   string            `json:"status"`
+	Data     string            `json:"data,omitempty"`
+	Archive  *workspaceArchive `json:"archive,omitempty"`
+	Warnings []string          `json:"warnings,omitempty"`
+}
+
+func parseWorkspaceDataMode(value string) (string, error) {
+	switch mode := strings.ToLower(strings.TrimSpace(value)); mode {
+	case "":
+		return workspaceDataKeep, nil
+	case workspaceDataKeep, workspaceDataArchive, workspaceDataPurge:
+		return mode, nil
+	default:
+		return "", errWorkspaceDataModeInvalid
+	}
+}
+
+func resolveWorkspaceRepoPath(owner string, dir string) (string, error) {
+	if dir == "" || dir == "." || dir == ".." || invalidDirNameChars.MatchString(dir) {
+		return "", errWorkspaceDirInvalid
+	}
+	base, err := ensureWorkspaceRepoBasePath(owner)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(base, dir), nil
+}
+
+func workspaceTrashPath(owner string) string {
+	return filepath.Join(".", "volumes", owner, "trash")
+}
+
+func workspaceArchiveRecordPath(owner string, id string) string {
+	return filepath.Join(workspaceTrashPath(owner), id+".json")
+}
+
+func workspaceArchiveTarballPath(owner string, id string) string {
+	return filepath.Join(workspaceTrashPath(owner), id+".tar.gz")
+}
+
+func archiveWorkspaceData(rebuild *workspaceRebuild) (*workspaceArchive, error) {
+	labels := rebuild.Labels
+	repoPath, err := resolveWorkspaceRepoPath(rebuild.Owner, labels[labelWorkspaceDir])
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(repoPath); err != nil {
+		return nil, err
+	}
+
+	archive := &workspaceArchive{
+		ID:         generateSessionID(),
+		Owner:      rebuild.Owner,
+		Name:       rebuild.Name,
+		RepoURL:    labels[labelWorkspaceRepo],
+		Ref:        labels[labelWorkspaceRef],
+		Dir:        labels[labelWorkspaceDir],
+		Image:      rebuild.Image,
+		ArchivedAt: time.Now().UTC(),
+		Labels:     labels,
+		Env:        rebuild.Env,
+		Mounts:     rebuild.Mounts,
+	}
+	if err := os.MkdirAll(workspaceTrashPath(archive.Owner), 0o755); err != nil {
+		return nil, err
+	}
+
+	tarballPath := workspaceArchiveTarballPath(archive.Owner, archive.ID)
+	if err := writeWorkspaceTarball(tarballPath, repoPath); err != nil {
+		_ = os.Remove(tarballPath)
+		return nil, err
+	}
+	if info, err := os.Stat(tarballPath); err == nil {
+		archive.SizeBytes = info.Size()
+	}
+	if err := writeWorkspaceArchiveRecord(archive); err != nil {
+		_ = os.Remove(tarballPath)
+		return nil, err
+	}
+	if err := os.RemoveAll(repoPath); err != nil {
+		return archive, fmt.Errorf("remove archived repository: %w", err)
+	}
+	return archive, nil
+}
+
+func writeWorkspaceTarball(tarballPath string, dir string) error {
+	file, err := os.OpenFile(tarballPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	if err := writeDirectoryTar(gz, dir, nil); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func writeWorkspaceArchiveRecord(archive *workspaceArchive) error {
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(workspaceArchiveRecordPath(archive.Owner, archive.ID), data, 0o600)
+}
+
+func purgeWorkspaceData(rebuild *workspaceRebuild) error {
+	repoPath, err := resolveWorkspaceRepoPath(rebuild.Owner, rebuild.Labels[labelWorkspaceDir])
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(repoPath)
+}
+
+func loadWorkspaceArchive(owner string, id string) (*workspaceArchive, error) {
+	if !workspaceArchiveIDPattern.MatchString(id) {
+		return nil, errWorkspaceArchiveNotFound
+	}
+	data, err := os.ReadFile(workspaceArchiveRecordPath(owner, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errWorkspaceArchiveNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var archive workspaceArchive
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+func listWorkspaceArchives(owner string) ([]workspaceArchive, error) {
+	entries, err := os.ReadDir(workspaceTrashPath(owner))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []workspaceArchive{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	archives := []workspaceArchive{}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		archive, err := loadWorkspaceArchive(owner, id)
+		if err != nil {
+			continue
+		}
+		archives = append(archives, *archive)
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].ArchivedAt.After(archives[j].ArchivedAt)
+	})
+	return archives, nil
+}
+
+func deleteWorkspaceArchive(owner string, id string) error {
+	if _, err := loadWorkspaceArchive(owner, id); err != nil {
+		return err
+	}
+	if err := os.Remove(workspaceArchiveTarballPath(owner, id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Remove(workspaceArchiveRecordPath(owner, id))
+}
+
+func extractWorkspaceTarball(tarballPath string, repoPath string) error {
+	if _, err := os.Lstat(repoPath); err == nil {
+		return errWorkspaceDirConflict
+	}
+	file, err := os.Open(tarballPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	return extractDirectoryTar(gz, repoPath)
+}
+
+func (s *podmanService) startWorkspaceRecreate(job *workspaceJob, run func() (*createWorkspaceResponse, error)) (*workspaceJob, error) {
+	s.jobAdmitMu.Lock()
+	defer s.jobAdmitMu.Unlock()
+
+	if err := s.checkWorkspaceAdmission(job.Owner, job.limits); err != nil {
+		return nil, err
+	}
+
+	s.jobsMu.Lock()
+	for _, other := range s.jobs {
+		if job.sourceID != "" && other.Status == workspaceJobStatusRunning && other.sourceID == job.sourceID {
+			s.jobsMu.Unlock()
+			return nil, errWorkspaceRebuildBusy
+		}
+	}
+	s.pruneWorkspaceJobsLocked(job.StartedAt)
+	s.jobs[job.ID] = job
+	snapshot := job.snapshot()
+	s.jobsMu.Unlock()
+
+	s.publishWorkspaceJob(snapshot)
+	go s.runWorkspaceJob(job, run)
+	return snapshot, nil
+}
+
+func (s *podmanService) checkWorkspaceAdmission(owner string, limits containerLimits) error {
+	if !s.runtime.Available() {
+		return errPodmanUnavailable
+	}
+	quotaStatus, err := s.workspaceQuotaStatus(owner)
+	if err != nil {
+		return err
+	}
+	quotaStatus.Usage = s.pendingWorkspaceUsage(quotaStatus.Usage, owner, quotaStatus.Quota, nil)
+	return checkWorkspaceCreate(quotaStatus, limits)
+}
+
+func (s *podmanService) recreateWorkspace(tarballPath string, rebuild *workspaceRebuild, imageRequested bool, job *workspaceJob) (*createWorkspaceResponse, error) {
+	s.enterWorkspaceJobPhase(job, workspaceJobPhaseRestoring)
+	repoPath, err := resolveWorkspaceRepoPath(rebuild.Owner, rebuild.Labels[labelWorkspaceDir])
+	if err != nil {
+		return nil, err
+	}
+	if err := extractWorkspaceTarball(tarballPath, repoPath); err != nil {
+		if !errors.Is(err, errWorkspaceDirConflict) {
+			_ = os.RemoveAll(repoPath)
+		}
+		return nil, err
+	}
+
+	result, err := s.rebuildWorkspace(rebuild, imageRequested, job)
+	if err != nil {
+		s.jobsMu.Lock()
+		containerID := job.ContainerID
+		s.jobsMu.Unlock()
+		if containerID != "" {
+			s.stopTunnelMonitor(containerID)
+			s.clearTunnelState(containerID)
+			_ = s.runtime.Remove(context.Background(), containerID, true)
+			s.setWorkspaceJobContainer(job, "")
+		}
+		_ = os.RemoveAll(repoPath)
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *podmanService) startWorkspaceRestore(userID string, id string) (*workspaceJob, error) {
+	archive, err := loadWorkspaceArchive(userID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &workspaceJob{
+		ID:        generateSessionID(),
+		Kind:      workspaceJobKindRestore,
+		Owner:     userID,
+		Name:      archive.Name,
+		RepoURL:   archive.RepoURL,
+		Ref:       archive.Ref,
+		Status:    workspaceJobStatusRunning,
+		Phases:    []workspaceJobPhase{},
+		StartedAt: time.Now().UTC(),
+		limits:    containerLimitsFromLabels(archive.Labels),
+		sourceID:  archive.ID,
+	}
+	return s.startWorkspaceRecreate(job, func() (*createWorkspaceResponse, error) {
+		return s.restoreWorkspace(archive, job)
+	})
+}
+
+func (s *podmanService) restoreWorkspace(archive *workspaceArchive, job *workspaceJob) (*createWorkspaceResponse, error) {
+	result, err := s.recreateWorkspace(workspaceArchiveTarballPath(archive.Owner, archive.ID), archive.rebuild(), false, job)
+	if err != nil {
+		return nil, err
+	}
+	if err := deleteWorkspaceArchive(archive.Owner, archive.ID); err != nil && s.app != nil {
+		s.app.Logger().Warn("Failed to remove restored workspace archive", "archive", archive.ID, "error", err)
+	}
+	return result, nil
+}
+
+func registerWorkspaceTrashRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
+	rtr.GET("/podman/workspaces/trash", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		archives, err := listWorkspaceArchives(re.Auth.Id)
+		if err != nil {
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": workspaceArchiveFailedMessage,
+			})
+		}
+
+		for i := range archives {
+			archives[i] = archives[i].redacted()
+		}
+		return re.JSON(http.StatusOK, archives)
+	})
+
+	rtr.POST("/podman/workspaces/trash/{id}/restore", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		job, err := svc.startWorkspaceRestore(re.Auth.Id, strings.TrimSpace(re.Request.PathValue("id")))
+		if err != nil {
+			var quotaErr *workspaceQuotaError
+			switch {
+			case errors.As(err, &quotaErr):
+				return re.JSON(quotaErrorStatus(quotaErr), quotaErr.response())
+			case errors.Is(err, errWorkspaceArchiveNotFound):
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": workspaceArchiveNotFoundMessage,
+				})
+			}
+			status, message := workspaceCreateErrorStatus(err)
+			return re.JSON(status, map[string]string{
+				"message": message,
+			})
+		}
+
+		re.Response.Header().Set("Location", "/podman/workspaces/jobs/"+job.ID)
+		return re.JSON(http.StatusAccepted, job)
+	})
+
+	rtr.DELETE("/podman/workspaces/trash/{id}", func(re *core.RequestEvent) error {
+		if re.Auth == nil {
+			return re.JSON(http.StatusUnauthorized, map[string]string{
+				"message": "Unauthorized.",
+			})
+		}
+
+		if err := deleteWorkspaceArchive(re.Auth.Id, strings.TrimSpace(re.Request.PathValue("id"))); err != nil {
+			if errors.Is(err, errWorkspaceArchiveNotFound) {
+				return re.JSON(http.StatusNotFound, map[string]string{
+					"message": workspaceArchiveNotFoundMessage,
+				})
+			}
+			return re.JSON(http.StatusInternalServerError, map[string]string{
+				"message": workspaceArchiveDeleteMessage,
+			})
+		}
+
+		return re.JSON(http.StatusOK, map[string]string{
+			"status": "deleted",
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -90,8 +91,17 @@ func tunnelLogFile(sessionID string) string {
 	return fmt.Sprintf("/tmp/pocketpod-tunnel-%s.log", sessionID)
 }
 
-func (s *podmanService) bootstrapTunnel(containerID string, workspaceName string, sessionID string) podmanTunnelState {
-	execUser, err := resolveFirstNonRootUser(containerID)
+func buildTunnelPIDCheckCommand(sessionID string) string {
+	return fmt.Sprintf("kill -0 $(cat %s 2>/dev/null) 2>/dev/null && echo alive || echo dead", tunnelPIDFile(sessionID))
+}
+
+func (s *podmanService) bootstrapTunnel(containerID string, workspaceName string, sessionID string, job *workspaceJob) podmanTunnelState {
+	s.enterWorkspaceJobPhase(job, workspaceJobPhaseInstallingCLI)
+	var labels map[string]string
+	if inspected, err := s.runtime.Inspect(context.Background(), containerID); err == nil {
+		labels = inspected.Config.Labels
+	}
+	execUser, err := resolveWorkspaceExecUser(s.runtime, containerID, labels)
 	if err != nil {
 		return podmanTunnelState{
 			Status:  tunnelStatusFailed,
@@ -116,15 +126,9 @@ func (s *podmanService) bootstrapTunnel(containerID string, workspaceName string
 		}
 	}
 
-	_, _ = runPodmanCommand("exec", containerID, "sh", "-lc", buildTunnelLogPrepareCommand(execUser.Name, sessionID))
+	_, _ = execContainerShell(s.runtime, containerID, buildTunnelLogPrepareCommand(execUser.Name, sessionID))
 
-	installOutput, installErr := runPodmanCommand(
-		"exec",
-		containerID,
-		"sh",
-		"-lc",
-		installCommand,
-	)
+	installOutput, installErr := execContainerShell(s.runtime, containerID, installCommand)
 	debug.InstallOutput = firstNonEmptyLine(string(installOutput))
 	if installErr != nil {
 		return podmanTunnelState{
@@ -134,7 +138,12 @@ func (s *podmanService) bootstrapTunnel(containerID string, workspaceName string
 		}
 	}
 
-	startOutput, startErr := runPodmanCommand("exec", "-d", "--user", execUser.Name, containerID, "sh", "-lc", startCommand)
+	s.enterWorkspaceJobPhase(job, workspaceJobPhaseStartingTunnel)
+	startOutput, startErr := s.runtime.Exec(context.Background(), containerID, containerExecOptions{
+		User:   execUser.Name,
+		Detach: true,
+		Cmd:    []string{"sh", "-lc", startCommand},
+	})
 	debug.StartOutput = firstNonEmptyLine(string(startOutput))
 	if startErr != nil {
 		return podmanTunnelState{
@@ -150,6 +159,30 @@ func (s *podmanService) bootstrapTunnel(containerID string, workspaceName string
 	}
 }
 
+func (s *podmanService) rebootstrapTunnel(containerID string, inspected podmanInspectSummary, sessionID string) {
+	s.stopTunnelMonitor(containerID)
+	if s.setTunnelState(containerID, podmanTunnelState{Status: tunnelStatusStarting, Message: "Restarting VS Code tunnel."}) {
+		s.schedulePoll(podmanPollDebounce)
+	}
+
+	name := strings.TrimSpace(strings.TrimPrefix(inspected.Name, "/"))
+	if name == "" {
+		name = containerID
+	}
+
+	state := s.bootstrapTunnel(containerID, name, sessionID, nil)
+	if state.Status == "" {
+		state.Status = tunnelStatusStarting
+	}
+	if s.setTunnelState(containerID, state) {
+		s.schedulePoll(podmanPollDebounce)
+	}
+	if state.Status == tunnelStatusStarting {
+		hostVSCodeDir := deriveHostVSCodeDirFromContainer(podmanContainer{Labels: inspected.Config.Labels})
+		s.startTunnelMonitor(containerID, sessionID, hostVSCodeDir)
+	}
+}
+
 func buildTunnelLogPrepareCommand(execUser string, sessionID string) string {
 	trimmedUser := strings.TrimSpace(execUser)
 	logPath := tunnelLogFile(sessionID)
@@ -173,8 +206,8 @@ type tunnelExecUser struct {
 	Home string
 }
 
-func resolveFirstNonRootUser(containerID string) (tunnelExecUser, error) {
-	output, err := runPodmanCommand("exec", containerID, "sh", "-lc", "cat /etc/passwd 2>/dev/null || true")
+func resolveFirstNonRootUser(rt ContainerRuntime, containerID string) (tunnelExecUser, error) {
+	output, err := execContainerShell(rt, containerID, "cat /etc/passwd 2>/dev/null || true")
 	if err != nil {
 		return tunnelExecUser{}, err
 	}
@@ -185,6 +218,38 @@ func resolveFirstNonRootUser(containerID string) (tunnelExecUser, error) {
 	return tunnelExecUser{Name: name, Home: home}, nil
 }
 
+func resolveWorkspaceExecUser(rt ContainerRuntime, containerID string, labels map[string]string) (tunnelExecUser, error) {
+	remoteUser := strings.TrimSpace(labels[labelWorkspaceRemoteUser])
+	if remoteUser == "" {
+		return resolveFirstNonRootUser(rt, containerID)
+	}
+
+	output, err := execContainerShell(rt, containerID, "cat /etc/passwd 2>/dev/null || true")
+	if err != nil {
+		return tunnelExecUser{}, err
+	}
+	home, ok := findPasswdUserHome(string(output), remoteUser)
+	if !ok {
+		return tunnelExecUser{}, fmt.Errorf("user %q not found", remoteUser)
+	}
+	return tunnelExecUser{Name: remoteUser, Home: home}, nil
+}
+
+func findPasswdUserHome(passwdContents string, userName string) (string, bool) {
+	for _, line := range strings.Split(passwdContents, "\n") {
+		parts := strings.Split(strings.TrimSpace(line), ":")
+		if len(parts) < 7 || strings.TrimSpace(parts[0]) != userName {
+			continue
+		}
+		home := strings.TrimRight(strings.TrimSpace(parts[5]), "/")
+		if home == "" {
+			home = "/"
+		}
+		return home, true
+	}
+	return "", false
+}
+
 func selectFirstNonRootUser(passwdContents string) (string, string, bool) {
 	fallbackName := ""
 	fallbackHome := ""
@@ -421,13 +486,7 @@ func buildTunnelStateFromHealth(state string, health tunnelHealth) podmanTunnelS
 func (s *podmanService) checkTunnelHealth(containerID string, sessionID string, hostVSCodeDir string) tunnelHealth {
 	health := tunnelHealth{}
 
-	pidOutput, pidErr := runPodmanCommand(
-		"exec",
-		containerID,
-		"sh",
-		"-lc",
-		fmt.Sprintf("kill -0 $(cat %s 2>/dev/null) 2>/dev/null && echo alive || echo dead", tunnelPIDFile(sessionID)),
-	)
+	pidOutput, pidErr := execContainerShell(s.runtime, containerID, buildTunnelPIDCheckCommand(sessionID))
 	if pidErr == nil && strings.TrimSpace(string(pidOutput)) == "alive" {
 		health.processAlive = true
 	}
@@ -451,7 +510,7 @@ func (s *podmanService) checkTunnelHealth(containerID string, sessionID string,
 
 func (s *podmanService) readSessionLog(containerID string, sessionID string) (string, error) {
 	logPath := tunnelLogFile(sessionID)
-	output, err := runPodmanCommand("exec", containerID, "sh", "-lc", fmt.Sprintf("cat %s 2>/dev/null || true", logPath))
+	output, err := execContainerShell(s.runtime, containerID, fmt.Sprintf("cat %s 2>/dev/null || true", logPath))
 	if err != nil {
 		return "", err
 	}
@@ -478,7 +537,7 @@ func (m *tunnelMonitor) stop() {
 }
 
 func (s *podmanService) reconcileTunnelSessions() {
-	containers, err := listPodmanContainers()
+	containers, err := s.runtime.List(context.Background())
 	if err != nil {
 		return
 	}
@@ -512,23 +571,11 @@ func (s *podmanService) reconcileTunnelSessions() {
 }
 
 func deriveHostVSCodeDirFromContainer(container podmanContainer) string {
-	labels := container.Labels
-	if len(labels) == 0 {
-		return ""
-	}
-	workspaceHome := strings.TrimSpace(labels[labelWorkspaceHome])
-	if workspaceHome == "" {
+	owner := strings.TrimSpace(container.Labels[labelWorkspaceOwner])
+	if owner == "" {
 		return ""
 	}
-	idx := strings.Index(workspaceHome, "/")
-	if idx < 0 {
-		return ""
-	}
-	userPath := workspaceHome[:idx]
-	if userPath == "" {
-		return ""
-	}
-	return filepath.Join(".", "volumes", userPath, ".vscode")
+	return filepath.Join(".", "volumes", owner, ".vscode")
 }
 
 func latestNonEmptyLine(value string) string {
@@ -766,7 +813,7 @@ func isContainerIDMatch(left string, right string) bool {
 	return left == right || strings.HasPrefix(left, right) || strings.HasPrefix(right, left)
 }
 
-func discoverTunnelStatesForContainers(containers []podmanContainer) map[string]podmanTunnelState {
+func discoverTunnelStatesForContainers(rt ContainerRuntime, containers []podmanContainer) map[string]podmanTunnelState {
 	discovered := make(map[string]podmanTunnelState)
 	for _, container := range containers {
 		containerID := strings.TrimSpace(container.ID)
@@ -777,7 +824,7 @@ func discoverTunnelStatesForContainers(containers []podmanContainer) map[string]
 		if sessionID == "" {
 			continue
 		}
-		state, ok := discoverTunnelStateFromContainer(containerID, sessionID)
+		state, ok := discoverTunnelStateFromContainer(rt, containerID, sessionID)
 		if !ok || strings.TrimSpace(state.Status) == "" {
 			continue
 		}
@@ -786,17 +833,11 @@ func discoverTunnelStatesForContainers(containers []podmanContainer) map[string]
 	return discovered
 }
 
-func discoverTunnelStateFromContainer(containerID string, sessionID string) (podmanTunnelState, bool) {
-	pidOutput, pidErr := runPodmanCommand(
-		"exec",
-		containerID,
-		"sh",
-		"-lc",
-		fmt.Sprintf("kill -0 $(cat %s 2>/dev/null) 2>/dev/null && echo alive || echo dead", tunnelPIDFile(sessionID)),
-	)
+func discoverTunnelStateFromContainer(rt ContainerRuntime, containerID string, sessionID string) (podmanTunnelState, bool) {
+	pidOutput, pidErr := execContainerShell(rt, containerID, buildTunnelPIDCheckCommand(sessionID))
 	processAlive := pidErr == nil && strings.TrimSpace(string(pidOutput)) == "alive"
 
-	logOutput, logErr := runPodmanCommand("exec", containerID, "sh", "-lc", fmt.Sprintf("cat %s 2>/dev/null || true", tunnelLogFile(sessionID)))
+	logOutput, logErr := execContainerShell(rt, containerID, fmt.Sprintf("cat %s 2>/dev/null || true", tunnelLogFile(sessionID)))
 	if logErr != nil {
 		if !processAlive {
 			return podmanTunnelState{Status: tunnelStatusFailed, Message: "Tunnel process not running."}, true
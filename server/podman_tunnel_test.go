@@ -6,17 +6,17 @@ import (
 	"testing"
 )
 
-func TestEvaluateTunnelStateAuthRequiredExtractsCode(t *testing.T) {
-	logOutput := "To sign in, use a web browser to open https://github.com/login/device and enter the code ABCD-EFGH"
+func TestEvaluateHealthBlockedWhenAuthRequired(t *testing.T) {
+	logLine := "To sign in, use a web browser to open https://github.com/login/device and enter the code ABCD-EFGH"
+	health := tunnelHealth{processAlive: true, authRequired: true, deviceCode: extractDeviceCode(logLine)}
 
-	state, terminal := evaluateTunnelState(logOutput, false, nil, false)
-
-	if !terminal {
-		t.Fatal("expected auth-required state to be terminal")
-	}
-	if state.Status != tunnelStatusBlocked {
-		t.Fatalf("expected blocked status, got %q", state.Status)
+	m := &tunnelMonitor{}
+	status := m.evaluateHealth(health)
+	if status != tunnelStatusBlocked {
+		t.Fatalf("expected blocked status, got %q", status)
 	}
+
+	state := buildTunnelStateFromHealth(status, health)
 	if state.Code != "ABCD-EFGH" {
 		t.Fatalf("expected device code extraction, got %q", state.Code)
 	}
@@ -25,101 +25,75 @@ func TestEvaluateTunnelStateAuthRequiredExtractsCode(t *testing.T) {
 	}
 }
 
-func TestEvaluateTunnelStateReadyWhenTokenPresent(t *testing.T) {
-	state, terminal := evaluateTunnelState("", true, nil, true)
+func TestEvaluateHealthReadyWhenTokenPresent(t *testing.T) {
+	health := tunnelHealth{processAlive: true, tokenPresent: true}
 
-	if !terminal {
-		t.Fatal("expected token-ready state to be terminal")
+	m := &tunnelMonitor{}
+	status := m.evaluateHealth(health)
+	if status != tunnelStatusReady {
+		t.Fatalf("expected ready status, got %q", status)
 	}
-	if state.Status != tunnelStatusReady {
-		t.Fatalf("expected ready status, got %q", state.Status)
-	}
-	if state.Code != "" {
+	if state := buildTunnelStateFromHealth(status, health); state.Code != "" {
 		t.Fatalf("expected code cleared on ready state, got %q", state.Code)
 	}
 }
 
-func TestEvaluateTunnelStateFailureFallback(t *testing.T) {
-	state, terminal := evaluateTunnelState("error creating tunnel session", false, nil, false)
-
-	if !terminal {
-		t.Fatal("expected failure state to be terminal")
-	}
-	if state.Status != tunnelStatusFailed {
-		t.Fatalf("expected failed status, got %q", state.Status)
-	}
-	if state.Message == "" {
-		t.Fatal("expected failure message")
+func TestEvaluateHealthFailedWhenProcessDead(t *testing.T) {
+	m := &tunnelMonitor{}
+	if status := m.evaluateHealth(tunnelHealth{tokenPresent: true}); status != tunnelStatusFailed {
+		t.Fatalf("expected failed status, got %q", status)
 	}
 }
 
-func TestEvaluateTunnelStateStartingWhenNoSignal(t *testing.T) {
-	state, terminal := evaluateTunnelState("", false, nil, false)
-
-	if terminal {
-		t.Fatal("expected starting state to remain non-terminal")
-	}
-	if state.Status != tunnelStatusStarting {
-		t.Fatalf("expected starting status, got %q", state.Status)
+func TestEvaluateHealthStartingWhenNoSignal(t *testing.T) {
+	m := &tunnelMonitor{}
+	if status := m.evaluateHealth(tunnelHealth{processAlive: true}); status != tunnelStatusStarting {
+		t.Fatalf("expected starting status, got %q", status)
 	}
 }
 
-func TestEvaluateTunnelStateReadyWhenOpenLinkAppearsAfterAuthPrompt(t *testing.T) {
-	logOutput := strings.Join([]string{
+func TestDiscoverTunnelStateStartingWhenOpenLinkAppearsAfterAuthPrompt(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.setTunnelSession("abc", "s1", true, strings.Join([]string{
 		"To grant access to the server, please log into https://github.com/login/device and use code ABCD-EFGH",
 		"Open this link in your browser https://vscode.dev/tunnel/cool_ishizaka",
-	}, "\n")
-
-	state, terminal := evaluateTunnelState(logOutput, false, nil, true)
-	if !terminal {
-		t.Fatal("expected terminal state")
-	}
-	if state.Status != tunnelStatusReady {
-		t.Fatalf("expected ready status, got %q", state.Status)
-	}
-	if state.Code != "" {
-		t.Fatalf("expected no code in ready status, got %q", state.Code)
-	}
-}
+	}, "\n"))
 
-func TestEvaluateTunnelStateReadyLineWithoutProcessRemainsStarting(t *testing.T) {
-	logOutput := "Open this link in your browser https://vscode.dev/tunnel/cool_ishizaka"
-	state, terminal := evaluateTunnelState(logOutput, false, nil, false)
-	if terminal {
-		t.Fatal("expected non-terminal state when tunnel process is not running")
+	state, ok := discoverTunnelStateFromContainer(rt, "abc", "s1")
+	if ok {
+		t.Fatal("expected non-authoritative state")
 	}
 	if state.Status != tunnelStatusStarting {
 		t.Fatalf("expected starting status, got %q", state.Status)
 	}
+	if state.Code != "" {
+		t.Fatalf("expected no code in starting state, got %q", state.Code)
+	}
 }
 
-func TestEvaluateTunnelStateOpenLinkAfterAuthWithoutRunningRemainsStarting(t *testing.T) {
-	logOutput := strings.Join([]string{
-		"To grant access to the server, please log into https://github.com/login/device and use code ABCD-EFGH",
-		"Open this link in your browser https://vscode.dev/tunnel/cool_ishizaka",
-	}, "\n")
+func TestDiscoverTunnelStateFailedWhenProcessDead(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.setTunnelSession("abc", "s1", false, "Open this link in your browser https://vscode.dev/tunnel/cool_ishizaka")
 
-	state, terminal := evaluateTunnelState(logOutput, false, nil, false)
-	if terminal {
-		t.Fatal("expected non-terminal state")
-	}
-	if state.Status != tunnelStatusStarting {
-		t.Fatalf("expected starting status, got %q", state.Status)
+	state, ok := discoverTunnelStateFromContainer(rt, "abc", "s1")
+	if !ok {
+		t.Fatal("expected authoritative state")
 	}
-	if state.Code != "" {
-		t.Fatalf("expected no code in starting state, got %q", state.Code)
+	if state.Status != tunnelStatusFailed {
+		t.Fatalf("expected failed status, got %q", state.Status)
 	}
 }
 
-func TestEvaluateTunnelStateBlockedWhenLatestLineIsAuthPrompt(t *testing.T) {
-	logOutput := strings.Join([]string{
+func TestDiscoverTunnelStateBlockedWhenLatestLineIsAuthPrompt(t *testing.T) {
+	rt := newFakeRuntime()
+	rt.setTunnelSession("abc", "s1", true, strings.Join([]string{
 		"Open this link in your browser https://vscode.dev/tunnel/cool_ishizaka",
 		"To grant access to the server, please log into https://github.com/login/device and use code ABCD-EFGH",
-	}, "\n")
+	}, "\n"))
 
-	state, terminal := evaluateTunnelState(logOutput, false, nil, true)
-	if !terminal {
-		t.Fatal("expected terminal state")
+	state, ok := discoverTunnelStateFromContainer(rt, "abc", "s1")
+	if !ok {
+		t.Fatal("expected authoritative state")
 	}
 	if state.Status != tunnelStatusBlocked {
 		t.Fatalf("expected blocked status, got %q", state.Status)
@@ -198,11 +172,11 @@ func TestEnrichContainersWithTunnelStateOmitsConnectURLWhileStarting(t *testing.
 }
 
 func TestBuildTunnelStartCommand(t *testing.T) {
-	cmd := buildTunnelStartCommand("my-workspace", "/home/dev")
+	cmd := buildTunnelStartCommand("s1", "my-workspace", "/home/dev", "dev")
 	if !strings.Contains(cmd, "code tunnel --accept-server-license-terms --name 'my-workspace'") {
 		t.Fatalf("unexpected command: %s", cmd)
 	}
-	if !strings.Contains(cmd, tunnelLogPath) {
+	if !strings.Contains(cmd, tunnelLogFile("s1")) {
 		t.Fatalf("expected tunnel log path in command: %s", cmd)
 	}
 	if !strings.Contains(cmd, "HOME='/home/dev'") {
@@ -263,8 +237,8 @@ func TestSelectFirstNonRootUserReturnsFalseWhenOnlyRootExists(t *testing.T) {
 }
 
 func TestBuildTunnelLogPrepareCommandIncludesChownForExecUser(t *testing.T) {
-	cmd := buildTunnelLogPrepareCommand("ubuntu")
-	if !strings.Contains(cmd, "chown 'ubuntu' "+tunnelLogPath) {
+	cmd := buildTunnelLogPrepareCommand("ubuntu", "s1")
+	if !strings.Contains(cmd, "chown 'ubuntu' "+tunnelLogFile("s1")) {
 		t.Fatalf("expected chown to tunnel log path: %s", cmd)
 	}
 	if !strings.Contains(cmd, tunnelBootstrapLogPath) {
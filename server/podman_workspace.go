@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,7 +10,6 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
 
 	"github.com/pocketbase/pocketbase/core"
@@ -29,6 +28,7 @@ const (
 
 	workspaceCreateFailedMessage = "Failed to create workspace container."
 	workspaceStartFailedMessage  = "Failed to start workspace container."
+	workspacePullFailedMessage   = "Failed to pull workspace image."
 
 	maxRepoURLLength         = 2048
 	maxWorkspaceNameLength   = 128
@@ -51,34 +51,49 @@ var (
 	invalidDirNameChars  = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
 )
 
-var runWorkspaceCommand = func(name string, args ...string) ([]byte, error) {
+var runWorkspaceCommand = func(env []string, name string, args ...string) ([]byte, error) {
 	cmd := exec.Command(name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	return cmd.CombinedOutput()
 }
 
 var workspaceLookPath = exec.LookPath
 
 type createWorkspacePayload struct {
-	RepoURL string            `json:"repoUrl"`
-	Name    string            `json:"name"`
-	Ref     string            `json:"ref"`
-	Env     map[string]string `json:"env"`
+	RepoURL   string            `json:"repoUrl"`
+	Name      string            `json:"name"`
+	Ref       string            `json:"ref"`
+	Image     string            `json:"image"`
+	Env       map[string]string `json:"env"`
+	CPUs      float64           `json:"cpus"`
+	Memory    string            `json:"memory"`
+	PidsLimit int64             `json:"pidsLimit"`
+	ShmSize   string            `json:"shmSize"`
+
+	Depth        int    `json:"depth"`
+	SingleBranch bool   `json:"singleBranch"`
+	Submodules   bool   `json:"submodules"`
+	LFS          bool   `json:"lfs"`
+	Branch       string `json:"branch"`
+
+	limits containerLimits
+	clone  workspaceCloneOptions
 }
 
 type createWorkspaceResponse struct {
-	Name    string                  `json:"name"`
-	Status  string                  `json:"status"`
-	RepoURL string                  `json:"repoUrl"`
-	Ref     string                  `json:"ref,omitempty"`
-	Tunnel  workspaceTunnelSnapshot `json:"tunnel"`
-}
-
-type podmanInspectSummary struct {
-	Name  string `json:"Name"`
-	State struct {
-		Status  string `json:"Status"`
-		Running bool   `json:"Running"`
-	} `json:"State"`
+	Name         string                  `json:"name"`
+	Status       string                  `json:"status"`
+	RepoURL      string                  `json:"repoUrl"`
+	Ref          string                  `json:"ref,omitempty"`
+	Branch       string                  `json:"branch,omitempty"`
+	Image        string                  `json:"image"`
+	Resources    *containerLimits        `json:"resources,omitempty"`
+	Build        *workspaceBuild         `json:"build,omitempty"`
+	ForwardPorts []string                `json:"forwardPorts,omitempty"`
+	Tunnel       workspaceTunnelSnapshot `json:"tunnel"`
+	Warnings     []string                `json:"warnings,omitempty"`
 }
 
 func registerWorkspaceRoutes(rtr *router.Router[*core.RequestEvent], svc *podmanService) {
@@ -102,114 +117,301 @@ func registerWorkspaceRoutes(rtr *router.Router[*core.RequestEvent], svc *podman
 			})
 		}
 
-		result, err := svc.createWorkspace(re.Auth.Id, payload)
+		job, err := svc.startWorkspaceJob(re.Auth.Id, payload)
 		if err != nil {
-			switch {
-			case errors.Is(err, errPodmanUnavailable):
-				return re.JSON(http.StatusServiceUnavailable, map[string]string{
-					"message": podmanUnavailableMessage,
-				})
-			case errors.Is(err, errWorkspaceNameConflict):
-				return re.JSON(http.StatusConflict, map[string]string{
-					"message": "Workspace name already exists.",
-				})
-			case errors.Is(err, errWorkspaceDirConflict):
-				return re.JSON(http.StatusConflict, map[string]string{
-					"message": "Workspace directory already exists.",
-				})
-			case errors.Is(err, errWorkspaceStartFailed):
-				return re.JSON(http.StatusInternalServerError, map[string]string{
-					"message": workspaceStartFailedMessage,
-				})
-			case errors.Is(err, errWorkspaceGitMissing):
-				return re.JSON(http.StatusInternalServerError, map[string]string{
-					"message": "Git is unavailable on the server.",
-				})
-			case errors.Is(err, errWorkspaceCloneFailed), errors.Is(err, errWorkspaceRefFailed):
-				return re.JSON(http.StatusInternalServerError, map[string]string{
-					"message": "Failed to clone workspace repository.",
-				})
-			default:
-				return re.JSON(http.StatusInternalServerError, map[string]string{
-					"message": workspaceCreateFailedMessage,
-				})
+			var quotaErr *workspaceQuotaError
+			if errors.As(err, &quotaErr) {
+				return re.JSON(quotaErrorStatus(quotaErr), quotaErr.response())
 			}
+			status, message := workspaceCreateErrorStatus(err)
+			return re.JSON(status, map[string]string{
+				"message": message,
+			})
 		}
 
-		return re.JSON(http.StatusCreated, result)
+		re.Response.Header().Set("Location", "/podman/workspaces/jobs/"+job.ID)
+		return re.JSON(http.StatusAccepted, job)
 	})
+
+	registerWorkspaceImageRoutes(rtr, svc)
+	registerWorkspaceBuildRoutes(rtr, svc)
+	registerWorkspaceJobRoutes(rtr, svc)
+	registerGitCredentialRoutes(rtr, svc)
+	registerWorkspaceIdentityRoutes(rtr, svc)
+	registerWorkspaceMirrorRoutes(rtr, svc)
+	registerWorkspaceRebuildRoutes(rtr, svc)
+	registerWorkspaceTrashRoutes(rtr, svc)
+	registerWorkspaceSnapshotRoutes(rtr, svc)
+	registerWorkspaceExportRoutes(rtr, svc)
+}
+
+func workspaceCreateErrorStatus(err error) (int, string) {
+	var quotaErr *workspaceQuotaError
+	var buildErr *workspaceBuildError
+	switch {
+	case errors.As(err, &quotaErr):
+		return quotaErrorStatus(quotaErr), workspaceQuotaExceededMessage + " " + quotaErr.Reason
+	case errors.As(err, &buildErr):
+		return http.StatusInternalServerError, workspaceBuildFailedMessage
+	case errors.Is(err, errWorkspaceImageNotAllowed):
+		return http.StatusBadRequest, workspaceImageNotAllowedMessage
+	case errors.Is(err, errPodmanUnavailable):
+		return http.StatusServiceUnavailable, podmanUnavailableMessage
+	case errors.Is(err, errWorkspaceNameConflict):
+		return http.StatusConflict, "Workspace name already exists."
+	case errors.Is(err, errWorkspaceDirConflict):
+		return http.StatusConflict, "Workspace directory already exists."
+	case errors.Is(err, errWorkspaceNotRebuildable):
+		return http.StatusConflict, workspaceNotRebuildableMessage
+	case errors.Is(err, errWorkspaceRebuildBusy):
+		return http.StatusConflict, workspaceRebuildBusyMessage
+	case errors.Is(err, errWorkspaceRepoMissing):
+		return http.StatusConflict, workspaceRepoMissingMessage
+	case errors.Is(err, errWorkspacePullFailed):
+		return http.StatusInternalServerError, workspacePullFailedMessage
+	case errors.Is(err, errWorkspaceStartFailed):
+		return http.StatusInternalServerError, workspaceStartFailedMessage
+	case errors.Is(err, errGitCredentialFailed):
+		return http.StatusInternalServerError, gitCredentialsFailedMessage
+	case errors.Is(err, errWorkspaceGitMissing):
+		return http.StatusInternalServerError, "Git is unavailable on the server."
+	case errors.Is(err, errWorkspaceLFSMissing):
+		return http.StatusInternalServerError, "Git LFS is unavailable on the server."
+	case errors.Is(err, errWorkspaceCloneFailed), errors.Is(err, errWorkspaceRefFailed),
+		errors.Is(err, errWorkspaceSubmodulesFailed), errors.Is(err, errWorkspaceLFSFailed):
+		return http.StatusInternalServerError, "Failed to clone workspace repository."
+	default:
+		return http.StatusInternalServerError, workspaceCreateFailedMessage
+	}
 }
 
-var errWorkspaceStartFailed = errors.New("workspace start failed")
+var (
+	errWorkspaceStartFailed = errors.New("workspace start failed")
+	errWorkspacePullFailed  = errors.New("workspace image pull failed")
+)
+
+func (s *podmanService) admitWorkspace(userID string, payload createWorkspacePayload, job *workspaceJob) (workspaceImage, workspaceQuotaStatus, error) {
+	if !s.runtime.Available() {
+		return workspaceImage{}, workspaceQuotaStatus{}, errPodmanUnavailable
+	}
 
-func (s *podmanService) createWorkspace(userID string, payload createWorkspacePayload) (*createWorkspaceResponse, error) {
-	if _, err := exec.LookPath("podman"); err != nil {
-		return nil, errPodmanUnavailable
+	image, err := s.resolveWorkspaceImage(payload.Image)
+	if err != nil {
+		return workspaceImage{}, workspaceQuotaStatus{}, err
 	}
 
-	workspaceHostPath, workspaceDirName, err := cloneWorkspaceRepository(userID, payload)
+	quotaStatus, err := s.workspaceQuotaStatus(userID)
+	if err != nil {
+		return workspaceImage{}, workspaceQuotaStatus{}, err
+	}
+	quotaStatus.Usage = s.pendingWorkspaceUsage(quotaStatus.Usage, userID, quotaStatus.Quota, job)
+	if err := checkWorkspaceCreate(quotaStatus, payload.limits); err != nil {
+		return workspaceImage{}, workspaceQuotaStatus{}, err
+	}
+	return image, quotaStatus, nil
+}
+
+func (s *podmanService) createWorkspace(userID string, payload createWorkspacePayload, job *workspaceJob) (_ *createWorkspaceResponse, err error) {
+	image, quotaStatus, err := s.admitWorkspace(userID, payload, job)
 	if err != nil {
 		return nil, err
 	}
 
-	volumeHostPath, err := ensureWorkspaceVSCodeVolumePath(userID)
+	rollback := s.newWorkspaceRollback(job)
+	defer func() {
+		err = rollback.release(err)
+	}()
+
+	rollback.enter(workspaceJobPhaseCloning)
+	gitEnv, cleanupGitEnv, err := s.workspaceGitEnv(userID, payload.RepoURL)
 	if err != nil {
 		return nil, err
 	}
-	workspaceHomeTarget := defaultWorkspaceHome
-	if resolvedPath, resolveErr := resolveWorkspaceHomeTarget(defaultWorkspaceImage); resolveErr == nil && strings.TrimSpace(resolvedPath) != "" {
-		workspaceHomeTarget = resolvedPath
+	releaseMirror := func() {}
+	if payload.clone.Depth == 0 {
+		payload.clone.Reference, releaseMirror = prepareWorkspaceMirror(payload.RepoURL, gitEnv)
 	}
-	workspaceMountArg := formatWorkspaceMountArg(workspaceHostPath, strings.TrimRight(workspaceHomeTarget, "/")+"/workspaces")
-	vscodeMountTarget := strings.TrimRight(workspaceHomeTarget, "/") + "/.vscode"
-	vscodeMountArg := formatWorkspaceVSCodeMountArg(volumeHostPath, vscodeMountTarget)
+	workspaceHostPath, workspaceDirName, err := cloneWorkspaceRepository(userID, payload, gitEnv)
+	releaseMirror()
+	cleanupGitEnv()
+	if err != nil {
+		return nil, err
+	}
+	repoPath := filepath.Join(workspaceHostPath, workspaceDirName)
+	rollback.acquired("repository clone", func() error {
+		return os.RemoveAll(repoPath)
+	})
 
-	args := []string{"create", "--pull=missing"}
-	if payload.Name != "" {
-		args = append(args, "--name", payload.Name)
+	volumeHostPath, err := ensureWorkspaceVSCodeVolumePath(userID)
+	if err != nil {
+		return nil, err
 	}
-	args = append(args, "--mount", workspaceMountArg)
-	args = append(args, "--mount", vscodeMountArg)
 
-	keys := make([]string, 0, len(payload.Env))
-	for key := range payload.Env {
-		keys = append(keys, key)
+	devcontainer, warnings := readWorkspaceDevcontainer(repoPath)
+
+	var build *workspaceBuild
+	if buildSpec, specErr := devcontainer.buildSpec(repoPath); specErr != nil {
+		warnings = append(warnings, fmt.Sprintf("devcontainer.json build was ignored: %v.", specErr))
+	} else if buildSpec != nil {
+		switch {
+		case payload.Image != "":
+			warnings = append(warnings, "devcontainer.json build was skipped because an image was requested.")
+		case !resolveWorkspaceBuildsEnabled():
+			warnings = append(warnings, "devcontainer.json build was skipped because image builds are disabled.")
+		default:
+			rollback.enter(workspaceJobPhaseBuilding)
+			build, err = s.buildWorkspaceImage(userID, payload, *buildSpec)
+			if err != nil {
+				return nil, err
+			}
+			image = workspaceImage{Image: build.Image}
+		}
 	}
-	sort.Strings(keys)
-	for _, key := range keys {
-		args = append(args, "-e", fmt.Sprintf("%s=%s", key, payload.Env[key]))
+
+	if build == nil && devcontainer != nil && devcontainer.Image != "" {
+		if payload.Image != "" {
+			if devcontainer.Image != image.Image {
+				warnings = append(warnings, fmt.Sprintf("devcontainer.json image %q was overridden by the requested image.", devcontainer.Image))
+			}
+		} else if devImage, imageErr := s.resolveWorkspaceImage(devcontainer.Image); imageErr == nil {
+			image = devImage
+		} else {
+			warnings = append(warnings, fmt.Sprintf("devcontainer.json image %q is not allowed; using %q instead.", devcontainer.Image, image.Image))
+		}
 	}
 
-	args = append(args, "--label", fmt.Sprintf("%s=%s", labelWorkspaceRepo, payload.RepoURL))
-	args = append(args, "--label", fmt.Sprintf("%s=%s", labelWorkspaceDir, workspaceDirName))
-	args = append(args, "--label", fmt.Sprintf("%s=%s", labelWorkspaceHome, workspaceHomeTarget))
-	if payload.Ref != "" {
-		args = append(args, "--label", fmt.Sprintf("%s=%s", labelWorkspaceRef, payload.Ref))
+	ctx := context.Background()
+	if build == nil {
+		rollback.enter(workspaceJobPhasePulling)
+		if err := s.runtime.Pull(ctx, image.Image, imagePullMissing); err != nil {
+			return nil, fmt.Errorf("%w: %v", errWorkspacePullFailed, err)
+		}
 	}
 
-	sessionID := generateSessionID()
-	args = append(args, "--label", fmt.Sprintf("%s=%s", labelTunnelSession, sessionID))
+	rollback.enter(workspaceJobPhaseCreating)
+	remoteUser, userWarnings := devcontainer.remoteUser()
+	warnings = append(warnings, userWarnings...)
+
+	workspaceHomeTarget := ""
+	if remoteUser != "" {
+		if resolvedPath, resolveErr := resolveWorkspaceHomeTarget(s.runtime, image.Image, remoteUser); resolveErr == nil {
+			workspaceHomeTarget = resolvedPath
+		} else {
+			warnings = append(warnings, fmt.Sprintf("devcontainer.json remoteUser %q could not be found in the image and was ignored.", remoteUser))
+			remoteUser = ""
+		}
+	}
+	if workspaceHomeTarget == "" && image.DefaultHome != "" {
+		workspaceHomeTarget = image.DefaultHome
+	}
+	if workspaceHomeTarget == "" {
+		workspaceHomeTarget = defaultWorkspaceHome
+		if resolvedPath, resolveErr := resolveWorkspaceHomeTarget(s.runtime, image.Image, ""); resolveErr == nil && strings.TrimSpace(resolvedPath) != "" {
+			workspaceHomeTarget = resolvedPath
+		}
+	}
 
-	args = append(args, defaultWorkspaceImage, "sh", "-lc", defaultWorkspaceCommand)
+	localFolder, err := filepath.Abs(repoPath)
+	if err != nil {
+		localFolder = repoPath
+	}
+	resolvedDevcontainer := devcontainer.resolve(devcontainerContext{
+		UserID:          userID,
+		LocalFolder:     localFolder,
+		ContainerFolder: strings.TrimRight(workspaceHomeTarget, "/") + "/workspaces/" + workspaceDirName,
+	})
+	warnings = append(warnings, resolvedDevcontainer.Warnings...)
 
-	createOutput, createErr := runWorkspaceCommand("podman", args...)
-	if createErr != nil {
-		if isPodmanNameConflict(createOutput) {
-			return nil, errWorkspaceNameConflict
+	env := resolvedDevcontainer.Env
+	if devcontainer != nil && len(devcontainer.RunArgs) > 0 {
+		runArgsPayload := payload
+		warnings = append(warnings, applyDevcontainerRunArgs(devcontainer.RunArgs, &runArgsPayload, env)...)
+		limits, limitsErr := validateWorkspaceLimits(&runArgsPayload, resolveWorkspaceLimitMaximums())
+		switch {
+		case limitsErr != nil:
+			warnings = append(warnings, fmt.Sprintf("devcontainer.json runArgs limits were ignored: %v.", limitsErr))
+		case limits != payload.limits:
+			if err := checkWorkspaceCreate(quotaStatus, limits); err != nil {
+				return nil, err
+			}
+			payload.limits = limits
 		}
-		return nil, createErr
+	}
+	for key, value := range payload.Env {
+		env[key] = value
 	}
 
-	containerID := strings.TrimSpace(string(createOutput))
-	if containerID == "" {
-		return nil, errors.New("empty container id")
+	workspaceMountArg := formatWorkspaceMountArg(workspaceHostPath, strings.TrimRight(workspaceHomeTarget, "/")+"/workspaces")
+	vscodeMountTarget := strings.TrimRight(workspaceHomeTarget, "/") + "/.vscode"
+	vscodeMountArg := formatWorkspaceVSCodeMountArg(volumeHostPath, vscodeMountTarget)
+
+	labels := map[string]string{
+		labelWorkspaceOwner: userID,
+		labelWorkspaceRepo:  payload.RepoURL,
+		labelWorkspaceDir:   workspaceDirName,
+		labelWorkspaceHome:  workspaceHomeTarget,
+		labelWorkspaceImage: image.Image,
+	}
+	if payload.Ref != "" {
+		labels[labelWorkspaceRef] = payload.Ref
+	}
+	if remoteUser != "" {
+		labels[labelWorkspaceRemoteUser] = remoteUser
+	}
+	if build != nil {
+		labels[labelWorkspaceBuild] = build.ID
+	}
+	if len(env) > 0 {
+		labels[labelWorkspaceEnvKeys] = strings.Join(sortedMapKeys(env), ",")
+	}
+	for key, value := range payload.limits.labels() {
+		labels[key] = value
+	}
+	for key, value := range payload.clone.labels() {
+		labels[key] = value
+	}
+	devcontainerLabels, err := resolvedDevcontainer.labels()
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range devcontainerLabels {
+		labels[key] = value
+	}
+
+	sessionID := generateSessionID()
+	labels[labelTunnelSession] = sessionID
+
+	containerID, err := s.runtime.Create(ctx, containerCreateSpec{
+		Name:    payload.Name,
+		Image:   image.Image,
+		Pull:    imagePullMissing,
+		Mounts:  append([]string{workspaceMountArg, vscodeMountArg}, resolvedDevcontainer.Mounts...),
+		Env:     env,
+		Labels:  labels,
+		Command: []string{"sh", "-lc", defaultWorkspaceCommand},
+		Limits:  payload.limits,
+	})
+	if err != nil {
+		if errors.Is(err, errContainerNameConflict) {
+			return nil, errWorkspaceNameConflict
+		}
+		return nil, err
 	}
+	s.setWorkspaceJobContainer(job, containerID)
+	rollback.acquired("container", func() error {
+		if err := s.runtime.Remove(context.Background(), containerID, true); err != nil && !errors.Is(err, errPodmanContainerNotFound) {
+			return err
+		}
+		s.schedulePoll(podmanPollDebounce)
+		return nil
+	})
 
-	if _, err := runWorkspaceCommand("podman", "start", containerID); err != nil {
+	rollback.enter(workspaceJobPhaseStarting)
+	if err := s.runtime.Start(ctx, containerID); err != nil && !errors.Is(err, errContainerAlreadyRunning) {
 		return nil, fmt.Errorf("%w: %v", errWorkspaceStartFailed, err)
 	}
 
-	name, status := inspectCreatedContainer(containerID)
+	name, status := inspectCreatedContainer(s.runtime, containerID)
 	if name == "" {
 		if payload.Name != "" {
 			name = payload.Name
@@ -221,10 +423,20 @@ func (s *podmanService) createWorkspace(userID string, payload createWorkspacePa
 		status = "Running"
 	}
 
-	tunnelState := s.bootstrapTunnel(containerID, name, sessionID)
+	if identity, identityErr := lookupWorkspaceIdentity(s.app, userID); identityErr != nil {
+		warnings = append(warnings, fmt.Sprintf("Git identity could not be loaded: %v.", identityErr))
+	} else if !identity.isZero() {
+		rollback.enter(workspaceJobPhaseConfiguringGit)
+		warnings = append(warnings, s.installWorkspaceIdentity(containerID, identity)...)
+	}
+
+	tunnelState := s.bootstrapTunnel(containerID, name, sessionID, job)
 	if tunnelState.Status == "" {
 		tunnelState.Status = tunnelStatusStarting
 	}
+	if tunnelState.Status == tunnelStatusFailed {
+		s.failWorkspaceJobPhase(job, tunnelState.Message)
+	}
 	if s.setTunnelState(containerID, tunnelState) {
 		s.schedulePoll(podmanPollDebounce)
 	}
@@ -232,13 +444,30 @@ func (s *podmanService) createWorkspace(userID string, payload createWorkspacePa
 		s.startTunnelMonitor(containerID, sessionID, volumeHostPath)
 	}
 
-	return &createWorkspaceResponse{
-		Name:    name,
-		Status:  status,
-		RepoURL: payload.RepoURL,
-		Ref:     payload.Ref,
-		Tunnel:  workspaceTunnelSnapshot(tunnelState),
-	}, nil
+	if len(resolvedDevcontainer.PostCreate) > 0 || len(resolvedDevcontainer.PostStart) > 0 {
+		rollback.enter(workspaceJobPhaseRunningHooks)
+	}
+	warnings = append(warnings, s.runDevcontainerCommands(containerID, "postCreateCommand", resolvedDevcontainer.PostCreate)...)
+	warnings = append(warnings, s.runDevcontainerCommands(containerID, "postStartCommand", resolvedDevcontainer.PostStart)...)
+
+	response := &createWorkspaceResponse{
+		Name:         name,
+		Status:       status,
+		RepoURL:      payload.RepoURL,
+		Ref:          payload.Ref,
+		Branch:       payload.clone.Branch,
+		Image:        image.Image,
+		Build:        build,
+		ForwardPorts: resolvedDevcontainer.ForwardPorts,
+		Tunnel:       workspaceTunnelSnapshot(tunnelState),
+		Warnings:     warnings,
+	}
+	if !payload.limits.isZero() {
+		limits := payload.limits
+		response.Resources = &limits
+	}
+
+	return response, nil
 }
 
 func ensureWorkspaceVSCodeVolumePath(userID string) (string, error) {
@@ -275,10 +504,13 @@ func ensureWorkspaceRepoBasePath(userID string) (string, error) {
 	return absolutePath, nil
 }
 
-func cloneWorkspaceRepository(userID string, payload createWorkspacePayload) (string, string, error) {
+func cloneWorkspaceRepository(userID string, payload createWorkspacePayload, env []string) (string, string, error) {
 	if _, err := workspaceLookPath("git"); err != nil {
 		return "", "", errWorkspaceGitMissing
 	}
+	if err := checkWorkspaceLFS(payload.clone); err != nil {
+		return "", "", err
+	}
 
 	repoBasePath, err := ensureWorkspaceRepoBasePath(userID)
 	if err != nil {
@@ -297,13 +529,15 @@ func cloneWorkspaceRepository(userID string, payload createWorkspacePayload) (st
 		return "", "", errWorkspaceDirConflict
 	}
 
-	if cloneOutput, cloneErr := runWorkspaceCommand("git", "clone", "--", payload.RepoURL, repoPath); cloneErr != nil {
+	// A failed clone or checkout removes what it left behind so the next
+	// attempt does not hit errWorkspaceDirConflict.
+	if cloneOutput, cloneErr := runWorkspaceCommand(env, "git", payload.clone.cloneArgs(payload.RepoURL, payload.Ref, repoPath)...); cloneErr != nil {
+		_ = os.RemoveAll(repoPath)
 		return "", "", fmt.Errorf("%w: %s", errWorkspaceCloneFailed, strings.TrimSpace(string(cloneOutput)))
 	}
-	if payload.Ref != "" {
-		if checkoutOutput, checkoutErr := runWorkspaceCommand("git", "-C", repoPath, "checkout", "--detach", payload.Ref); checkoutErr != nil {
-			return "", "", fmt.Errorf("%w: %s", errWorkspaceRefFailed, strings.TrimSpace(string(checkoutOutput)))
-		}
+	if err := checkoutWorkspaceRef(repoPath, payload.Ref, payload.clone, env); err != nil {
+		_ = os.RemoveAll(repoPath)
+		return "", "", err
 	}
 
 	return repoBasePath, dirName, nil
@@ -396,11 +630,36 @@ func formatWorkspaceVSCodeMountArg(volumeHostPath string, mountTarget string) st
 	return formatWorkspaceMountArg(volumeHostPath, target)
 }
 
-func resolveWorkspaceHomeTarget(imageRef string) (string, error) {
-	output, err := runPodmanCommand("run", "--rm", "--entrypoint", "sh", imageRef, "-lc", "cat /etc/passwd 2>/dev/null || true")
+func resolveWorkspaceHomeTarget(rt ContainerRuntime, imageRef string, userName string) (string, error) {
+	ctx := context.Background()
+	containerID, err := rt.Create(ctx, containerCreateSpec{
+		Image:      imageRef,
+		Pull:       imagePullMissing,
+		Entrypoint: "sh",
+		Command:    []string{"-lc", defaultWorkspaceCommand},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = rt.Remove(ctx, containerID, true)
+	}()
+
+	if err := rt.Start(ctx, containerID); err != nil {
+		return "", err
+	}
+
+	output, err := execContainerShell(rt, containerID, "cat /etc/passwd 2>/dev/null || true")
 	if err != nil {
 		return "", err
 	}
+	if userName != "" {
+		home, ok := findPasswdUserHome(string(output), userName)
+		if !ok {
+			return "", fmt.Errorf("user %q not found in image", userName)
+		}
+		return home, nil
+	}
 	return deriveWorkspaceHomeFromPasswd(string(output)), nil
 }
 
@@ -452,6 +711,16 @@ func validateCreateWorkspacePayload(payload *createWorkspacePayload) error {
 		}
 	}
 
+	payload.Image = strings.TrimSpace(payload.Image)
+	if payload.Image != "" {
+		switch {
+		case len(payload.Image) > maxWorkspaceImageLength:
+			return errors.New("image is too long")
+		case strings.Contains(payload.Image, " ") || hasUnsafeControlChars(payload.Image):
+			return errors.New("image contains unsupported characters")
+		}
+	}
+
 	if len(payload.Env) > maxWorkspaceEnvCount {
 		return errors.New("env has too many entries")
 	}
@@ -474,6 +743,18 @@ func validateCreateWorkspacePayload(payload *createWorkspacePayload) error {
 		}
 	}
 
+	limits, err := validateWorkspaceLimits(payload, resolveWorkspaceLimitMaximums())
+	if err != nil {
+		return err
+	}
+	payload.limits = limits
+
+	clone, err := validateWorkspaceCloneOptions(payload)
+	if err != nil {
+		return err
+	}
+	payload.clone = clone
+
 	return nil
 }
 
@@ -524,21 +805,15 @@ func isPodmanNameConflict(output []byte) bool {
 	return false
 }
 
-func inspectCreatedContainer(containerID string) (string, string) {
-	cmd := exec.Command("podman", "inspect", "--format", "json", containerID)
-	output, err := cmd.CombinedOutput()
+func inspectCreatedContainer(rt ContainerRuntime, containerID string) (string, string) {
+	inspected, err := rt.Inspect(context.Background(), containerID)
 	if err != nil {
 		return "", ""
 	}
 
-	var parsed []podmanInspectSummary
-	if err := json.Unmarshal(output, &parsed); err != nil || len(parsed) == 0 {
-		return "", ""
-	}
-
-	name := strings.TrimSpace(strings.TrimPrefix(parsed[0].Name, "/"))
-	status := strings.TrimSpace(parsed[0].State.Status)
-	if parsed[0].State.Running {
+	name := strings.TrimSpace(strings.TrimPrefix(inspected.Name, "/"))
+	status := strings.TrimSpace(inspected.State.Status)
+	if inspected.State.Running {
 		status = "Running"
 	} else if status != "" {
 		status = strings.ToUpper(status[:1]) + status[1:]
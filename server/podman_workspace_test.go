@@ -353,7 +353,7 @@ func TestCloneWorkspaceRepository(t *testing.T) {
 
 		calls := make([][]string, 0)
 		workspaceLookPath = tt.lookPath
-		runWorkspaceCommand = func(name string, args ...string) ([]byte, error) {
+		runWorkspaceCommand = func(_ []string, name string, args ...string) ([]byte, error) {
 			call := append([]string{name}, args...)
 			calls = append(calls, call)
 			if tt.run != nil {
@@ -372,7 +372,7 @@ func TestCloneWorkspaceRepository(t *testing.T) {
 			}
 		}
 
-		_, _, gotErr := cloneWorkspaceRepository("user-1", tt.payload)
+		_, _, gotErr := cloneWorkspaceRepository("user-1", tt.payload, nil)
 		if err := os.Chdir(originalWD); err != nil {
 			t.Fatalf("%s: chdir original: %v", tt.name, err)
 		}
@@ -3,8 +3,12 @@ package main
 import "errors"
 
 const (
-	CollectionUsers   = "users"
-	CollectionInvites = "invites"
+	CollectionUsers              = "users"
+	CollectionInvites            = "invites"
+	CollectionContainerAdoptions = "container_adoptions"
+	CollectionWorkspaceQuotas    = "workspace_quotas"
+	CollectionWorkspaceImages    = "workspace_images"
+	CollectionGitCredentials     = "git_credentials"
 
 	RoleAdmin = "admin"
 	RoleUser  = "user"
@@ -8,25 +8,55 @@ export type CreateWorkspacePayload = {
   ref?: string;
 };
 
-export type CreateWorkspaceResponse = {
+export type WorkspaceTunnel = {
+  status: "ready" | "starting" | "blocked" | "failed";
+  code?: string;
+  message?: string;
+  debug?: {
+    version: string;
+    installCmd?: string;
+    startCmd?: string;
+    installOutput?: string;
+    startOutput?: string;
+  };
+};
+
+export type WorkspaceJobPhase = {
   name: string;
-  status: string;
+  status: "running" | "succeeded" | "failed";
+  error?: string;
+  startedAt: string;
+  finishedAt?: string;
+  durationMs: number;
+};
+
+export type WorkspaceJob = {
+  id: string;
+  owner: string;
+  name?: string;
   repoUrl: string;
   ref?: string;
-  tunnel: {
-    status: "ready" | "starting" | "blocked" | "failed";
-    code?: string;
-    message?: string;
-    debug?: {
-      version: string;
-      installCmd?: string;
-      startCmd?: string;
-      installOutput?: string;
-      startOutput?: string;
-    };
+  status: "running" | "succeeded" | "failed";
+  phase?: string;
+  phases: WorkspaceJobPhase[];
+  containerId?: string;
+  result?: {
+    name: string;
+    status: string;
+    repoUrl: string;
+    ref?: string;
+    tunnel: WorkspaceTunnel;
+    warnings?: string[];
   };
+  error?: string;
+  errorStatus?: number;
+  buildId?: string;
+  startedAt: string;
+  finishedAt?: string;
 };
 
+export type CreateWorkspaceResponse = WorkspaceJob;
+
 export type ContainerActionPayload = {
   containerId: string;
 };
@@ -58,7 +58,7 @@ export default function DashboardPage() {
     onSuccess: (data) => {
       setWorkspaceError(null);
       setWorkspaceSuccess(
-        `Workspace ${data.name} created with status ${data.status}.`,
+        `Creating workspace ${data.name || data.repoUrl} (job ${data.id}).`,
       );
       void refetchContainers();
     },